@@ -1,47 +1,168 @@
 package api
 
 import (
-	"fmt" // Import fmt package
+	"encoding/hex"
+	"errors"
 	"net/http"
-	"time" // Import time package
+	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"aztecs/consensus" // Import consensus package
-	"aztecs/core" // Import core package
-	"aztecs/crypto" // Import crypto package
+	"aztecs/consensus"   // Import consensus package
+	"aztecs/core"        // Import core package
+	"aztecs/core/script" // Import script package
+	"aztecs/crypto"      // Import crypto package
 )
 
 // RegisterRoutes registers the API routes
-func RegisterRoutes(router *gin.Engine, bc *core.Blockchain, wallets *crypto.Wallets) { // Accept Blockchain and Wallets instances
+func RegisterRoutes(router *gin.Engine, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool, minerPubKeyHash []byte) { // Accept Blockchain, Wallets and Mempool instances
 	router.GET("/blockchain", func(c *gin.Context) {
 		getBlockchain(c, bc) // Pass context and blockchain instance
 	})
 	router.POST("/mine", func(c *gin.Context) {
-		mineBlock(c, bc) // Pass context and blockchain instance
+		mineBlock(c, bc, mempool, minerPubKeyHash) // Pass context, blockchain and mempool instances
+	})
+	router.POST("/generate", func(c *gin.Context) {
+		generateBlocks(c, bc) // Pass context and blockchain instance
 	})
 	router.POST("/transactions", func(c *gin.Context) { // Use anonymous function
-		createTransaction(c, bc) // Pass context and blockchain instance
+		createTransaction(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/transactions/bumpfee", func(c *gin.Context) {
+		bumpFee(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/transactions/raw", func(c *gin.Context) {
+		sendRawTransaction(c, bc, mempool) // Pass context, blockchain and mempool instances
+	})
+	router.POST("/multisig", func(c *gin.Context) {
+		createMultisig(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/multisig/spend", func(c *gin.Context) {
+		spendMultisig(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/multisig/sign", func(c *gin.Context) {
+		signMultisig(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.POST("/psbt", func(c *gin.Context) {
+		createPSBT(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/psbt/update", func(c *gin.Context) {
+		updatePSBT(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.POST("/psbt/sign", func(c *gin.Context) {
+		signPSBT(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/psbt/combine", combinePSBT)
+	router.POST("/psbt/finalize", finalizePSBT)
+	router.POST("/tokens", func(c *gin.Context) {
+		issueToken(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/tokens/send", func(c *gin.Context) {
+		sendToken(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.GET("/tokens", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tokens": bc.Tokens()})
+	})
+	router.GET("/tokens/:id", func(c *gin.Context) {
+		getToken(c, bc) // Pass context and blockchain instance
+	})
+	router.POST("/nfts", func(c *gin.Context) {
+		mintNFT(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/nfts/transfer", func(c *gin.Context) {
+		transferNFT(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
 	})
+	router.GET("/nfts/:id", func(c *gin.Context) {
+		getNFT(c, bc) // Pass context and blockchain instance
+	})
+	router.POST("/data", func(c *gin.Context) {
+		publishData(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.GET("/data/:prefix", func(c *gin.Context) {
+		findData(c, bc) // Pass context and blockchain instance
+	})
+	router.POST("/swaps", func(c *gin.Context) {
+		fundSwap(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/swaps/audit", func(c *gin.Context) {
+		auditSwap(c, bc) // Pass context and blockchain instance
+	})
+	router.POST("/swaps/redeem", func(c *gin.Context) {
+		redeemSwap(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.POST("/swaps/refund", func(c *gin.Context) {
+		refundSwap(c, bc, wallets, mempool) // Pass context, blockchain, wallets and mempool instances
+	})
+	router.GET("/mempool", func(c *gin.Context) {
+		getMempool(c, mempool) // Pass context and mempool instance
+	})
+	router.POST("/messages/sign", func(c *gin.Context) {
+		signMessage(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/messages/verify", verifyMessage)
 	router.POST("/wallets", func(c *gin.Context) { // Use anonymous function
 		createWallet(c, wallets) // Pass context and wallets instance
 	})
 	router.GET("/wallets", func(c *gin.Context) { // Add get wallets route
 		getWallets(c, wallets) // Pass context and wallets instance
 	})
-	router.GET("/wallets/:address", getWallet) // TODO: Pass wallets instance
+	router.POST("/wallets/encrypt", func(c *gin.Context) {
+		encryptWallet(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/wallets/passphrase", func(c *gin.Context) {
+		walletPassphrase(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/wallets/passphrasechange", func(c *gin.Context) {
+		walletPassphraseChange(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/wallets/lock", func(c *gin.Context) {
+		walletLock(c, wallets) // Pass context and wallets instance
+	})
+	router.POST("/wallets/restore", func(c *gin.Context) {
+		restoreWallet(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.POST("/wallets/importprivkey", func(c *gin.Context) {
+		importPrivKey(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.POST("/wallets/import", func(c *gin.Context) {
+		importAddress(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.GET("/wallets/:address", func(c *gin.Context) {
+		getWallet(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
 	router.GET("/wallets/:address/balance", func(c *gin.Context) { // Add get wallet balance route
-		getWalletBalance(c, bc) // Pass context and blockchain instance
+		getWalletBalance(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.GET("/wallets/:address/history", func(c *gin.Context) {
+		getWalletHistory(c, bc, wallets) // Pass context, blockchain and wallets instances
+	})
+	router.GET("/wallets/:address/nfts", func(c *gin.Context) {
+		getWalletNFTs(c, bc) // Pass context and blockchain instance
 	})
 }
 
 // getWallets handles the request to get all wallets
 func getWallets(c *gin.Context, wallets *crypto.Wallets) { // Accept Wallets instance
-	addresses := []string{}
-	for address := range wallets.Wallets {
-		addresses = append(addresses, address)
+	format, ok := addressFormat(c)
+	if !ok {
+		return
+	}
+	entries := []gin.H{}
+	add := func(addresses []string, watchOnly bool) bool {
+		for _, address := range addresses {
+			formatted, err := crypto.FormatAddress(address, format)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return false
+			}
+			entries = append(entries, gin.H{"address": formatted, "watchOnly": watchOnly})
+		}
+		return true
+	}
+	if !add(wallets.GetAddresses(), false) || !add(wallets.GetWatchOnlyAddresses(), true) {
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"wallets": addresses})
+	c.JSON(http.StatusOK, gin.H{"wallets": entries, "encrypted": wallets.IsEncrypted(), "locked": wallets.IsLocked()})
 }
 
 // getBlockchain handles the request to get the blockchain
@@ -49,76 +170,1134 @@ func getBlockchain(c *gin.Context, bc *core.Blockchain) { // Accept Blockchain i
 	c.JSON(http.StatusOK, bc.Blocks) // Return the blockchain blocks
 }
 
-// mineBlock handles the request to mine a new block
-func mineBlock(c *gin.Context, bc *core.Blockchain) { // Accept Blockchain instance
-	// Create a new block with empty transactions
-	newBlock := core.NewBlock(int64(len(bc.Blocks)), time.Now(), []*core.Transaction{}, bc.Blocks[len(bc.Blocks)-1].Hash)
+// mineBlock handles the request to mine a new block with the mempool transactions
+func mineBlock(c *gin.Context, bc *core.Blockchain, mempool *core.Mempool, minerPubKeyHash []byte) { // Accept Blockchain and Mempool instances
+	// Reward the miner with the subsidy and fees when a miner address is configured
+	transactions := []*core.Transaction{}
+	if len(minerPubKeyHash) > 0 {
+		transactions = append(transactions, core.NewCoinbaseTXWithFees(minerPubKeyHash, "", bc.Height()+1, mempool.Fees()))
+	}
+	transactions = append(transactions, mempool.Transactions()...)
 
-	// Perform Proof of Work
-	pow := consensus.NewProofOfWork(newBlock)
-	nonce, hash := pow.Run()
+	// Perform Proof of Work and add the mined block to the blockchain
+	newBlock, err := consensus.MineBlock(bc, transactions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	mempool.RemoveBlock(newBlock)
 
-	newBlock.Hash = hash
-	newBlock.Nonce = nonce
+	c.JSON(http.StatusOK, gin.H{"message": "Block mined successfully", "block": newBlock})
+}
+
+// generateBlocks handles the request to mine blocks on demand on networks that allow it
+func generateBlocks(c *gin.Context, bc *core.Blockchain) {
+	var req struct {
+		Blocks  int    `json:"blocks"`
+		Address string `json:"address"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pubKeyHash, err := crypto.DecodeKeyAddress(req.Address)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Add the mined block to the blockchain
-	bc.Blocks = append(bc.Blocks, newBlock)
+	blocks, err := consensus.GenerateBlocks(bc, pubKeyHash, req.Blocks)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hashes := []string{}
+	for _, block := range blocks {
+		hashes = append(hashes, block.Hash)
+	}
+	c.JSON(http.StatusOK, gin.H{"blocks": hashes})
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Block mined successfully", "block": newBlock})
+// createTransaction handles the request to build, sign and submit a payment from a wallet
+func createTransaction(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) { // Accept Blockchain, Wallets and Mempool instances
+	var req struct {
+		From        string  `json:"fromAddress" binding:"required"`
+		To          string  `json:"toAddress" binding:"required"`
+		Amount      float64 `json:"amount" binding:"required"`
+		FeeRate     float64 `json:"feeRate"`     // Coins per 1000 bytes, the default rate when 0
+		LockUntil   int64   `json:"lockUntil"`   // Block height or Unix time the recipient can spend from, 0 for none
+		Replaceable bool    `json:"replaceable"` // Signal replace-by-fee so the fee can be bumped
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	recipient, err := core.NewLockedRecipient(req.To, req.Amount, req.LockUntil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+
+	tx, change, err := newTxBuilder(bc, wallets, mempool, req.Replaceable).Build(req.From, []core.Recipient{recipient}, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fee, _ := bc.TransactionFee(tx)
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "transaction": tx, "fee": fee})
+}
+
+// newTxBuilder returns a builder spending coins of wallets, whose
+// transactions signal replace-by-fee when replaceable is set
+func newTxBuilder(bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool, replaceable bool) *core.TxBuilder {
+	builder := core.NewTxBuilder(bc, wallets, mempool)
+	if replaceable {
+		builder.WithSequence(core.SequenceReplaceable)
+	}
+	return builder
+}
+
+// bumpFee handles the request to replace a mempool transaction of the
+// wallet by one paying a higher fee rate out of its change
+func bumpFee(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		TxID    string  `json:"txid" binding:"required"`
+		FeeRate float64 `json:"feeRate" binding:"required"` // New fee rate in coins per 1000 bytes
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tx, err := mempool.Transaction(req.TxID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	oldFee, _ := bc.TransactionFee(tx)
+	bumped, change, err := core.NewTxBuilder(bc, wallets, mempool).BumpFee(tx, mempool.Change(tx.ID), req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, bumped, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fee, _ := bc.TransactionFee(bumped)
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction replaced in the mempool", "replaced": tx.ID, "oldFee": oldFee, "transaction": bumped, "fee": fee})
+}
+
+// sendRawTransaction handles the request to add a signed hex transaction to the mempool
+func sendRawTransaction(c *gin.Context, bc *core.Blockchain, mempool *core.Mempool) {
+	var req struct {
+		Transaction string `json:"transaction" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tx, ok := decodeTransaction(c, req.Transaction)
+	if !ok {
+		return
+	}
+	if err := tx.CheckID(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.Add(bc, tx); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fee, _ := bc.TransactionFee(tx)
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "txid": tx.ID, "fee": fee})
+}
+
+// createMultisig handles the request to add an M-of-N multisig address to the wallet
+func createMultisig(c *gin.Context, wallets *crypto.Wallets) {
+	var req struct {
+		Required int      `json:"required" binding:"required"`
+		Keys     []string `json:"keys" binding:"required"` // Hex public keys or wallet addresses
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format, ok := addressFormat(c)
+	if !ok {
+		return
+	}
+	address, redeemScript, err := core.AddMultisig(wallets, req.Required, req.Keys)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wallets.SaveToFile()
+	address, _ = crypto.FormatAddress(address, format)
+	c.JSON(http.StatusOK, gin.H{"address": address, "redeemScript": hex.EncodeToString(redeemScript)})
+}
+
+// spendMultisig handles the request to build an unsigned transaction from a multisig address
+func spendMultisig(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From    string  `json:"fromAddress" binding:"required"`
+		To      string  `json:"toAddress" binding:"required"`
+		Amount  float64 `json:"amount" binding:"required"`
+		FeeRate float64 `json:"feeRate"` // Coins per 1000 bytes, the default rate when 0
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recipient, err := core.NewRecipient(req.To, req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+
+	tx, _, err := core.NewTxBuilder(bc, wallets, mempool).BuildMultisig(req.From, []core.Recipient{recipient}, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transaction": hex.EncodeToString(tx.Serialize())})
+}
+
+// signMultisig handles the request to add the wallet's signatures to a multisig transaction
+func signMultisig(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
+	var req struct {
+		Transaction string `json:"transaction" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tx, ok := decodeTransaction(c, req.Transaction)
+	if !ok {
+		return
+	}
+	progress, err := bc.SignMultisig(tx, wallets)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"transaction": hex.EncodeToString(tx.Serialize()),
+		"added":       progress.Added,
+		"inputs":      progress.Inputs,
+		"complete":    progress.Complete == progress.Inputs,
+	})
+}
+
+// createPSBT handles the request to build a PSBT spending from a wallet, watch-only or multisig address
+func createPSBT(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From      string  `json:"fromAddress" binding:"required"`
+		To        string  `json:"toAddress" binding:"required"`
+		Amount    float64 `json:"amount" binding:"required"`
+		FeeRate   float64 `json:"feeRate"`   // Coins per 1000 bytes, the default rate when 0
+		LockTime  int64   `json:"lockTime"`  // Block height or Unix time the transaction can be mined from, 0 for none
+		LockUntil int64   `json:"lockUntil"` // Block height or Unix time the recipient can spend from, 0 for none
+		Sequence  uint32  `json:"sequence"`  // Sequence number of the inputs
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recipient, err := core.NewLockedRecipient(req.To, req.Amount, req.LockUntil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+
+	tx, _, err := core.NewTxBuilder(bc, wallets, mempool).WithLockTime(req.LockTime).WithSequence(req.Sequence).BuildUnsigned(req.From, []core.Recipient{recipient}, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	p, err := core.NewPSBT(tx)
+	if err == nil {
+		err = bc.UpdatePSBT(p, wallets)
+	}
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"psbt": p.Encode()})
+}
+
+// updatePSBT handles the request to add the spent outputs, redeem scripts and key paths to a PSBT
+func updatePSBT(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
+	p, ok := bindPSBT(c)
+	if !ok {
+		return
+	}
+	if err := bc.UpdatePSBT(p, wallets); err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"psbt": p.Encode()})
+}
+
+// signPSBT handles the request to add the wallet's signatures to a PSBT
+func signPSBT(c *gin.Context, wallets *crypto.Wallets) {
+	p, ok := bindPSBT(c)
+	if !ok {
+		return
+	}
+	added, err := p.Sign(wallets)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"psbt": p.Encode(), "added": added})
+}
+
+// combinePSBT handles the request to merge the signatures of several PSBTs
+func combinePSBT(c *gin.Context) {
+	var req struct {
+		PSBTs []string `json:"psbts" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var psbts []*core.PSBT
+	for _, encoded := range req.PSBTs {
+		p, err := core.DecodePSBT(encoded)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		psbts = append(psbts, p)
+	}
+	combined, err := core.CombinePSBTs(psbts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"psbt": combined.Encode()})
+}
+
+// finalizePSBT handles the request to finalize a PSBT, returning the signed
+// hex transaction once every input is complete
+func finalizePSBT(c *gin.Context) {
+	p, ok := bindPSBT(c)
+	if !ok {
+		return
+	}
+	if !p.Finalize() {
+		c.JSON(http.StatusOK, gin.H{"psbt": p.Encode(), "complete": false})
+		return
+	}
+	tx, err := p.Extract()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"psbt": p.Encode(), "complete": true, "transaction": hex.EncodeToString(tx.Serialize())})
+}
+
+// issueToken handles the request to create a token paying its supply to the issuing wallet
+func issueToken(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From        string  `json:"fromAddress" binding:"required"`
+		Name        string  `json:"name" binding:"required"`
+		Symbol      string  `json:"symbol"`
+		Supply      uint64  `json:"supply" binding:"required"`
+		Metadata    string  `json:"metadata"`
+		FeeRate     float64 `json:"feeRate"`     // Coins per 1000 bytes, the default rate when 0
+		Replaceable bool    `json:"replaceable"` // Signal replace-by-fee so the fee can be bumped
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+	issuance := core.TokenIssuance{Name: req.Name, Symbol: req.Symbol, Supply: req.Supply, Metadata: req.Metadata}
+	tx, change, err := newTxBuilder(bc, wallets, mempool, req.Replaceable).IssueToken(req.From, issuance, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "tokenId": tx.IssuedTokenID(), "transaction": tx})
+}
+
+// sendToken handles the request to pay token units from a wallet
+func sendToken(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From        string  `json:"fromAddress" binding:"required"`
+		To          string  `json:"toAddress" binding:"required"`
+		TokenID     string  `json:"tokenId" binding:"required"`
+		Amount      uint64  `json:"amount" binding:"required"`
+		FeeRate     float64 `json:"feeRate"`     // Coins per 1000 bytes, the default rate when 0
+		Replaceable bool    `json:"replaceable"` // Signal replace-by-fee so the fee can be bumped
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+	tx, change, err := newTxBuilder(bc, wallets, mempool, req.Replaceable).SendToken(req.From, req.To, req.TokenID, req.Amount, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "transaction": tx})
+}
+
+// getToken handles the request to get the issuance of a token
+func getToken(c *gin.Context, bc *core.Blockchain) {
+	token, err := bc.FindToken(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// mintNFT handles the request to mint an NFT to a wallet
+func mintNFT(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From        string  `json:"fromAddress" binding:"required"`
+		Name        string  `json:"name" binding:"required"`
+		ContentHash string  `json:"contentHash" binding:"required"` // Hex SHA-256 of the content
+		URI         string  `json:"uri"`                            // Location of the NFT metadata
+		FeeRate     float64 `json:"feeRate"`                        // Coins per 1000 bytes, the default rate when 0
+		Replaceable bool    `json:"replaceable"`                    // Signal replace-by-fee so the fee can be bumped
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	contentHash, err := hex.DecodeString(req.ContentHash)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+	tx, change, err := newTxBuilder(bc, wallets, mempool, req.Replaceable).MintNFT(req.From, req.Name, contentHash, req.URI, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "nftId": tx.IssuedTokenID(), "transaction": tx})
+}
+
+// transferNFT handles the request to send an NFT of a wallet to an address or burn it
+func transferNFT(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From        string  `json:"fromAddress" binding:"required"`
+		To          string  `json:"toAddress"` // Empty when burning
+		NFTID       string  `json:"nftId" binding:"required"`
+		Burn        bool    `json:"burn"`
+		FeeRate     float64 `json:"feeRate"`     // Coins per 1000 bytes, the default rate when 0
+		Replaceable bool    `json:"replaceable"` // Signal replace-by-fee so the fee can be bumped
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.To == "") == !req.Burn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set either toAddress or burn"})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	token, err := bc.FindToken(req.NFTID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !token.IsNFT() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": core.ErrNotNFT.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+
+	builder := newTxBuilder(bc, wallets, mempool, req.Replaceable)
+	var tx *core.Transaction
+	var change int
+	if req.Burn {
+		tx, change, err = builder.BurnToken(req.From, req.NFTID, 1, req.FeeRate)
+	} else {
+		tx, change, err = builder.SendToken(req.From, req.To, req.NFTID, 1, req.FeeRate)
+	}
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "transaction": tx})
+}
+
+// getNFT handles the request to get an NFT with its ownership history
+func getNFT(c *gin.Context, bc *core.Blockchain) {
+	history, err := bc.NFTHistory(c.Param("id"))
+	if errors.Is(err, core.ErrNotNFT) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	token, _ := bc.FindToken(c.Param("id"))
+	nft := nftJSON(token)
+	nft["history"] = history
+	c.JSON(http.StatusOK, nft)
+}
+
+// getWalletNFTs handles the request to list the NFTs held by an address
+func getWalletNFTs(c *gin.Context, bc *core.Blockchain) {
+	address := c.Param("address")
+	pubKeyHash, ok := decodeAddress(c, address)
+	if !ok {
+		return
+	}
+	nfts := []gin.H{}
+	for _, token := range bc.NFTsOf(pubKeyHash) {
+		nfts = append(nfts, nftJSON(token))
+	}
+	c.JSON(http.StatusOK, gin.H{"address": address, "nfts": nfts})
+}
+
+// nftJSON describes an NFT with its content hash in hex
+func nftJSON(token *core.Token) gin.H {
+	return gin.H{
+		"id":          token.ID,
+		"name":        token.Name,
+		"contentHash": hex.EncodeToString(token.ContentHash),
+		"uri":         token.Metadata,
+		"mintTx":      token.TxID,
+		"mintHeight":  token.Height,
+	}
+}
+
+// fundSwap handles the request to fund a swap contract. Without a secret
+// hash it initiates the swap with a new secret, otherwise it participates.
+func fundSwap(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From       string  `json:"fromAddress" binding:"required"` // Funds the contract and receives refunds
+		To         string  `json:"toAddress" binding:"required"`   // Redeems the contract with the secret
+		Amount     float64 `json:"amount" binding:"required"`
+		SecretHash string  `json:"secretHash"`                  // Hex hash of the initiator's secret, empty to initiate
+		LockTime   int64   `json:"lockTime" binding:"required"` // Block height or Unix time the refund opens at
+		FeeRate    float64 `json:"feeRate"`                     // Coins per 1000 bytes, the default rate when 0
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	var secret, secretHash []byte
+	var err error
+	if req.SecretHash == "" {
+		secret, secretHash, err = core.NewSwapSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else if secretHash, err = hex.DecodeString(req.SecretHash); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+
+	address, contract, err := core.AddHTLC(wallets, req.To, req.From, secretHash, req.LockTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recipient, err := core.NewRecipient(address, req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tx, change, err := core.NewTxBuilder(bc, wallets, mempool).Build(req.From, []core.Recipient{recipient}, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wallets.SaveToFile()
+	resp := gin.H{"contract": hex.EncodeToString(contract), "address": address, "secretHash": hex.EncodeToString(secretHash), "transaction": tx}
+	if secret != nil {
+		resp["secret"] = hex.EncodeToString(secret)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// auditSwap handles the request to check the terms and coins of a swap contract
+func auditSwap(c *gin.Context, bc *core.Blockchain) {
+	contract, ok := bindContract(c)
+	if !ok {
+		return
+	}
+	sc, err := bc.AuditSwap(contract.Contract)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp := gin.H{
+		"address":    sc.Address,
+		"value":      sc.Value,
+		"recipient":  crypto.EncodeAddress(sc.Recipient, crypto.AddressBase58),
+		"refund":     crypto.EncodeAddress(sc.Refund, crypto.AddressBase58),
+		"secretHash": hex.EncodeToString(sc.SecretHash),
+		"lockTime":   sc.LockTime,
+	}
+	if sc.Secret != nil {
+		resp["secret"] = hex.EncodeToString(sc.Secret)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// redeemSwap handles the request to claim the coins of a swap contract with its secret
+func redeemSwap(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	contract, ok := bindContract(c)
+	if !ok {
+		return
+	}
+	secret, err := hex.DecodeString(contract.Secret)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tx, err := core.NewTxBuilder(bc, wallets, mempool).RedeemSwap(contract.Contract, secret, contract.FeeRate)
+	submitSwapSpend(c, bc, mempool, tx, err)
+}
+
+// refundSwap handles the request to take back the coins of an expired swap contract
+func refundSwap(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	contract, ok := bindContract(c)
+	if !ok {
+		return
+	}
+	tx, err := core.NewTxBuilder(bc, wallets, mempool).RefundSwap(contract.Contract, contract.FeeRate)
+	submitSwapSpend(c, bc, mempool, tx, err)
+}
+
+// submitSwapSpend adds a redeem or refund transaction to the mempool
+func submitSwapSpend(c *gin.Context, bc *core.Blockchain, mempool *core.Mempool, tx *core.Transaction, err error) {
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.Add(bc, tx); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fee, _ := bc.TransactionFee(tx)
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "transaction": tx, "fee": fee})
+}
+
+// swapRequest is a parsed redeem, refund or audit request
+type swapRequest struct {
+	Contract []byte
+	Secret   string  // Hex secret, for redeems
+	FeeRate  float64 // Coins per 1000 bytes, the default rate when 0
+}
+
+// bindContract parses a request carrying a hex swap contract, responding 400 when it is malformed
+func bindContract(c *gin.Context) (*swapRequest, bool) {
+	var req struct {
+		Contract string  `json:"contract" binding:"required"`
+		Secret   string  `json:"secret"`
+		FeeRate  float64 `json:"feeRate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	contract, err := hex.DecodeString(req.Contract)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+	return &swapRequest{Contract: contract, Secret: req.Secret, FeeRate: req.FeeRate}, true
+}
+
+// bindPSBT parses a request carrying one base64 PSBT, responding 400 when it is malformed
+func bindPSBT(c *gin.Context) (*core.PSBT, bool) {
+	var req struct {
+		PSBT string `json:"psbt" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	p, err := core.DecodePSBT(req.PSBT)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return p, true
+}
+
+// decodeTransaction parses a hex transaction, responding 400 when it is malformed
+func decodeTransaction(c *gin.Context, txHex string) (*core.Transaction, bool) {
+	data, err := hex.DecodeString(txHex)
+	if err == nil {
+		var tx *core.Transaction
+		if tx, err = core.DeserializeTransaction(data); err == nil {
+			return tx, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	return nil, false
+}
+
+// publishData handles the request to embed data in an unspendable output
+// paid for by a wallet
+func publishData(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets, mempool *core.Mempool) {
+	var req struct {
+		From        string  `json:"fromAddress" binding:"required"`
+		Data        string  `json:"data" binding:"required"` // Hex data, such as a document hash
+		FeeRate     float64 `json:"feeRate"`                 // Coins per 1000 bytes, the default rate when 0
+		Replaceable bool    `json:"replaceable"`             // Signal replace-by-fee so the fee can be bumped
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := decodeAddress(c, req.From); !ok {
+		return
+	}
+	data, err := hex.DecodeString(req.Data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FeeRate == 0 {
+		req.FeeRate = core.DefaultFeeRate
+	}
+	tx, change, err := newTxBuilder(bc, wallets, mempool, req.Replaceable).PublishData(req.From, data, req.FeeRate)
+	if err != nil {
+		c.JSON(transactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := mempool.AddWithChange(bc, tx, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction added to the mempool", "transaction": tx})
+}
+
+// findData handles the request to list the data outputs on the chain whose
+// data starts with a hex prefix
+func findData(c *gin.Context, bc *core.Blockchain) {
+	prefix, err := hex.DecodeString(c.Param("prefix"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries := []gin.H{}
+	for _, entry := range bc.FindData(prefix) {
+		entries = append(entries, gin.H{
+			"data":      hex.EncodeToString(entry.Data),
+			"txid":      entry.TxID,
+			"index":     entry.Index,
+			"height":    entry.Height,
+			"timestamp": bc.Blocks[entry.Height].Timestamp,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"prefix": c.Param("prefix"), "entries": entries})
 }
 
-// createTransaction handles the request to create a new transaction
-func createTransaction(c *gin.Context, bc *core.Blockchain) { // Accept Blockchain instance
-	// 使用临时结构体接收前端数据
-	type TempTx struct {
-		From   string  `json:"fromAddress"`
-		To     string  `json:"toAddress"`
-		Amount float64 `json:"amount"`
+// transactionErrorStatus maps transaction building errors to HTTP status codes
+func transactionErrorStatus(err error) int {
+	var insufficient *core.InsufficientFundsError
+	if errors.As(err, &insufficient) || errors.Is(err, core.ErrNotMultisig) || errors.Is(err, core.ErrNonFinal) || errors.Is(err, core.ErrSequenceLock) ||
+		errors.Is(err, core.ErrNotHTLC) || errors.Is(err, core.ErrWrongSecret) || errors.Is(err, core.ErrNoContractCoins) ||
+		errors.Is(err, core.ErrInvalidToken) || errors.Is(err, core.ErrInsufficientTokens) || errors.Is(err, script.ErrDataTooLarge) ||
+		errors.Is(err, core.ErrNotReplaceable) || errors.Is(err, core.ErrReplacementFee) || errors.Is(err, core.ErrNoChangeOutput) {
+		return http.StatusBadRequest
 	}
-	
-	var tempTx TempTx
-	if err := c.ShouldBindJSON(&tempTx); err != nil {
+	return walletErrorStatus(err)
+}
+
+// signMessage handles the request to sign a message with the key of a wallet address
+func signMessage(c *gin.Context, wallets *crypto.Wallets) {
+	var req struct {
+		Address string `json:"address" binding:"required"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if _, ok := decodeAddress(c, req.Address); !ok {
+		return
+	}
+	wallet, err := wallets.GetWallet(req.Address)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	signature, err := wallet.SignMessage(req.Message)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"address": req.Address, "signature": signature})
+}
 
-	// 创建实际交易对象（简化版）
-	tx := &core.Transaction{
-		Vin: []core.TxInput{
-			{Txid: "prev_tx", Vout: 0, PubKey: []byte(tempTx.From)},
-		},
-		Vout: []core.TxOutput{
-			{Value: tempTx.Amount, PubKeyHash: []byte(tempTx.To)},
-		},
+// verifyMessage handles the request to check a message signature against an address
+func verifyMessage(c *gin.Context) {
+	var req struct {
+		Address   string `json:"address" binding:"required"`
+		Signature string `json:"signature" binding:"required"`
+		Message   string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	valid, err := crypto.VerifyMessage(req.Address, req.Signature, req.Message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	tx.SetID()
+	c.JSON(http.StatusOK, gin.H{"address": req.Address, "valid": valid})
+}
 
-	// TODO: 实际实现应添加交易到交易池
-	c.JSON(http.StatusOK, gin.H{"message": "Transaction received (placeholder)", "transaction": tx})
+// getMempool handles the request to list the transactions waiting to be mined
+func getMempool(c *gin.Context, mempool *core.Mempool) {
+	c.JSON(http.StatusOK, gin.H{"transactions": mempool.Transactions(), "fees": mempool.Fees()})
 }
 
 // createWallet handles the request to create a new wallet
 func createWallet(c *gin.Context, wallets *crypto.Wallets) { // Accept Wallets instance
-	wallet := crypto.NewWallet() // Create a new wallet
-	address := wallet.GetAddress() // Get wallet address
+	format, ok := addressFormat(c)
+	if !ok {
+		return
+	}
+	keyType, err := crypto.ParseKeyType(c.Query("keytype"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	address, err := wallets.AddWalletOfType(keyType) // Create a new wallet and add it to the manager
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	wallets.SaveToFile()
+	if address, err = crypto.FormatAddress(address, format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": address})
+}
+
+// encryptWallet handles the request to encrypt the wallet file with a passphrase
+func encryptWallet(c *gin.Context, wallets *crypto.Wallets) {
+	var req struct {
+		Passphrase string `json:"passphrase" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := wallets.EncryptWallet(req.Passphrase); err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Wallet encrypted and locked"})
+}
+
+// walletPassphrase handles the request to unlock the wallet for a number of seconds
+func walletPassphrase(c *gin.Context, wallets *crypto.Wallets) {
+	var req struct {
+		Passphrase string `json:"passphrase" binding:"required"`
+		Timeout    int    `json:"timeout"` // Seconds until the wallet locks again, 0 for never
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Timeout < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must not be negative"})
+		return
+	}
+	if err := wallets.Unlock(req.Passphrase, time.Duration(req.Timeout)*time.Second); err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Wallet unlocked", "timeout": req.Timeout})
+}
+
+// walletPassphraseChange handles the request to change the wallet passphrase
+func walletPassphraseChange(c *gin.Context, wallets *crypto.Wallets) {
+	var req struct {
+		OldPassphrase string `json:"oldPassphrase" binding:"required"`
+		NewPassphrase string `json:"newPassphrase" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := wallets.ChangePassphrase(req.OldPassphrase, req.NewPassphrase); err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Wallet passphrase changed"})
+}
 
-	wallets.Wallets[string(address)] = wallet // Add wallet to manager
+// walletLock handles the request to lock the wallet
+func walletLock(c *gin.Context, wallets *crypto.Wallets) {
+	if !wallets.IsEncrypted() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": crypto.ErrWalletNotEncrypted.Error()})
+		return
+	}
+	wallets.Lock()
+	c.JSON(http.StatusOK, gin.H{"message": "Wallet locked"})
+}
 
-	// TODO: Save wallets to file
+// restoreWallet handles the request to restore an HD wallet from its mnemonic and rescan the chain
+func restoreWallet(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
+	var req struct {
+		Mnemonic   string `json:"mnemonic" binding:"required"`
+		Passphrase string `json:"passphrase"` // Optional passphrase the mnemonic was created with
+		GapLimit   int    `json:"gapLimit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	seed, err := crypto.MnemonicToSeed(req.Mnemonic, req.Passphrase)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := wallets.SetHDSeed(seed); err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	used := bc.UsedPubKeyHashes()
+	found, err := wallets.ScanHD(func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	}, req.GapLimit)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	wallets.SaveToFile()
+	c.JSON(http.StatusOK, gin.H{"found": found, "wallets": wallets.GetAddresses()})
+}
 
-	c.JSON(http.StatusOK, gin.H{"address": string(address)})
+// walletErrorStatus maps wallet errors to HTTP status codes
+func walletErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, crypto.ErrWrongPassphrase):
+		return http.StatusUnauthorized
+	case errors.Is(err, crypto.ErrWalletLocked), errors.Is(err, crypto.ErrWatchOnly):
+		return http.StatusForbidden
+	case errors.Is(err, crypto.ErrWalletNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, crypto.ErrInvalidMnemonic), errors.Is(err, crypto.ErrMnemonicChecksum), errors.Is(err, crypto.ErrUnknownKeyType),
+		errors.Is(err, crypto.ErrPrivateKeyFormat), errors.Is(err, crypto.ErrPrivateKeyChecksum), errors.Is(err, crypto.ErrPrivateKeyNetwork),
+		errors.Is(err, crypto.ErrScriptAddress):
+		return http.StatusBadRequest
+	case errors.Is(err, crypto.ErrWalletNotEncrypted), errors.Is(err, crypto.ErrWalletAlreadyEncrypted), errors.Is(err, crypto.ErrHDChainExists), errors.Is(err, crypto.ErrAddressExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 // getWallet handles the request to get wallet details
-// TODO: Implement actual logic to get wallet details
-func getWallet(c *gin.Context) {
+func getWallet(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
 	address := c.Param("address")
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Get wallet endpoint for address %s (placeholder)", address)})
+	pubKeyHash, ok := decodeAddress(c, address)
+	if !ok {
+		return
+	}
+	owned := wallets.HasAddress(address)
+	_, watchOnly := wallets.GetWatchOnly(address)
+	pubKey, _ := wallets.FindPublicKey(address)
+	balance := bc.BalanceFrom(pubKeyHash, wallets.HistoryStart(address))
+	c.JSON(http.StatusOK, gin.H{"address": address, "pubKeyHash": hex.EncodeToString(pubKeyHash), "pubKey": hex.EncodeToString(pubKey), "owned": owned, "watchOnly": watchOnly, "balance": balance, "tokens": bc.GetTokenBalances(pubKeyHash)})
 }
 
 // getWalletBalance handles the request to get wallet balance
-func getWalletBalance(c *gin.Context, bc *core.Blockchain) { // Accept Blockchain instance
+func getWalletBalance(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) { // Accept Blockchain and Wallets instances
 	address := c.Param("address")
-	balance := bc.GetBalance([]byte(address)) // Convert address to []byte
-	c.JSON(http.StatusOK, gin.H{"address": address, "balance": balance})
-}
\ No newline at end of file
+	pubKeyHash, ok := decodeAddress(c, address)
+	if !ok {
+		return
+	}
+	balance := bc.BalanceFrom(pubKeyHash, wallets.HistoryStart(address))
+	c.JSON(http.StatusOK, gin.H{"address": address, "balance": balance, "tokens": bc.GetTokenBalances(pubKeyHash)})
+}
+
+// getWalletHistory handles the request to list the transactions touching an address
+func getWalletHistory(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
+	address := c.Param("address")
+	pubKeyHash, ok := decodeAddress(c, address)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"address": address, "history": bc.History(pubKeyHash, wallets.HistoryStart(address))})
+}
+
+// importPrivKey handles the request to import an exported private key and rescan its coins
+func importPrivKey(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
+	var req struct {
+		PrivateKey string `json:"privateKey" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	address, err := wallets.ImportPrivateKey(req.PrivateKey)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	wallets.SaveToFile()
+
+	_, pubKeyHash, _ := crypto.DecodeAddress(address)
+	c.JSON(http.StatusOK, gin.H{
+		"address": address,
+		"utxos":   len(bc.UTXOSet.FindUTXOs(pubKeyHash)),
+		"balance": bc.GetBalance(pubKeyHash),
+	})
+}
+
+// importAddress handles the request to watch an address or public key without its private key
+func importAddress(c *gin.Context, bc *core.Blockchain, wallets *crypto.Wallets) {
+	var req struct {
+		Address    string `json:"address"`
+		PubKey     string `json:"pubKey"` // Hex encoded, instead of address
+		Rescan     *bool  `json:"rescan"` // Count blocks already in the chain, true when omitted
+		FromHeight int64  `json:"fromHeight"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Address == "") == (req.PubKey == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of address and pubKey is required"})
+		return
+	}
+
+	fromHeight := req.FromHeight
+	if req.Rescan != nil && !*req.Rescan {
+		fromHeight = bc.Height() + 1
+	}
+	var address string
+	var err error
+	if req.PubKey != "" {
+		pubKey, decodeErr := hex.DecodeString(req.PubKey)
+		if decodeErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pubKey is not valid hex"})
+			return
+		}
+		address, err = wallets.ImportPublicKey(pubKey, fromHeight)
+	} else {
+		if _, ok := decodeAddress(c, req.Address); !ok {
+			return
+		}
+		address, err = wallets.ImportAddress(req.Address, fromHeight)
+	}
+	if err != nil {
+		status := walletErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest // Invalid heights
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	wallets.SaveToFile()
+
+	_, pubKeyHash, _ := crypto.DecodeAddress(address)
+	c.JSON(http.StatusOK, gin.H{
+		"address":      address,
+		"watchOnly":    true,
+		"fromHeight":   fromHeight,
+		"transactions": len(bc.History(pubKeyHash, fromHeight)),
+		"balance":      bc.BalanceFrom(pubKeyHash, fromHeight),
+	})
+}
+
+// decodeAddress extracts the public key hash of an address, responding 400 when it is invalid
+func decodeAddress(c *gin.Context, address string) ([]byte, bool) {
+	_, pubKeyHash, err := crypto.DecodeAddress(address)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return pubKeyHash, true
+}
+
+// addressFormat reads the optional ?format= query parameter, responding 400 when it is unknown
+func addressFormat(c *gin.Context) (crypto.AddressFormat, bool) {
+	format, err := crypto.ParseAddressFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return format, true
+}
@@ -1,30 +1,39 @@
 package api
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/gin-gonic/gin" // Using Gin framework
 
-	"aztecs/core" // Import core package
+	"aztecs/config" // Import config package
+	"aztecs/core"   // Import core package
 	"aztecs/crypto" // Import crypto package
 )
 
-// StartServer starts the HTTP API server
-func StartServer(bc *core.Blockchain) { // Accept Blockchain instance
+// StartServer starts the HTTP API server on the configured listen address.
+// Transactions submitted to it wait in its mempool until POST /mine, whose
+// blocks pay their reward to minerPubKeyHash, or carry no coinbase when it is empty.
+func StartServer(bc *core.Blockchain, cfg *config.Config, minerPubKeyHash []byte) error { // Accept Blockchain, config and miner key
 	router := gin.Default()
 
+	// Require HTTP basic auth when RPC credentials are configured
+	if cfg.RPCUser != "" {
+		router.Use(gin.BasicAuth(gin.Accounts{cfg.RPCUser: cfg.RPCPassword}))
+	}
+
 	// Initialize wallet manager with error handling
-	wallets, err := crypto.NewWallets()
+	wallets, err := crypto.NewWallets(cfg.DataDir)
 	if err != nil {
-		log.Fatalf("Failed to initialize wallets: %v", err)
+		return fmt.Errorf("failed to initialize wallets: %w", err)
 	}
 
+	// Transactions submitted through the API wait here until a block is mined
+	mempool := core.NewMempool()
+
 	// Define API routes
-	RegisterRoutes(router, bc, wallets) // Pass Blockchain and Wallets instances to routes
+	RegisterRoutes(router, bc, wallets, mempool, minerPubKeyHash) // Pass Blockchain, Wallets and Mempool instances to routes
 
-	log.Println("Starting API server on :8080")
-	err = router.Run(":8080")
-	if err != nil {
-		log.Panic(err)
-	}
-}
\ No newline at end of file
+	log.Printf("Starting API server on %s", cfg.APIListen)
+	return router.Run(cfg.APIListen)
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"aztecs/config"
+	"aztecs/core"
+)
+
+// bumpFee asks the running node to replace a wallet transaction in its
+// mempool by one paying a higher fee rate out of the change
+func (cli *CLI) bumpFee(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, true)
+	txid := fs.String("txid", "", "ID of the mempool transaction to replace")
+	feeRate := fs.Float64("feerate", 2*core.DefaultFeeRate, "new fee in coins per 1000 bytes")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *txid == "" {
+			return usageError("-txid is required")
+		}
+		if *feeRate <= 0 {
+			return usageError("-feerate must be positive")
+		}
+		body := map[string]interface{}{"txid": *txid, "feeRate": *feeRate}
+		reply, err := callNode(cfg, http.MethodPost, "/transactions/bumpfee", body)
+		if err != nil {
+			return err
+		}
+		tx, _ := reply["transaction"].(map[string]interface{})
+		fmt.Fprintf(cli.Stdout, "Replaced %v (fee %.8f) by %v (fee %.8f)\n", reply["replaced"], reply["oldFee"], tx["ID"], reply["fee"])
+		return nil
+	}
+}
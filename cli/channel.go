@@ -0,0 +1,329 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// channelLockTime is how long a payee has to settle a channel before the
+// payer can take its coins back
+const channelLockTime = 7 * 24 * time.Hour
+
+// openChannel funds a payment channel to a payee and mines the funding transaction
+func (cli *CLI) openChannel(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address paying through the channel")
+	to := fs.String("to", "", "payee's hex public key, or an address whose key the wallet knows")
+	amount := fs.Float64("amount", 0, "capacity of the channel")
+	lockTime := fs.Int64("locktime", 0, "block height or Unix time the refund opens at (default in 7 days)")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" || *to == "" {
+			return usageError("-from and -to are required")
+		}
+		if *amount <= 0 {
+			return usageError("-amount must be positive")
+		}
+		if *lockTime == 0 {
+			*lockTime = time.Now().Add(channelLockTime).Unix()
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		payee, err := decodePubKey(wallets, *to)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		ch, tx, err := core.NewTxBuilder(bc, wallets, nil).OpenChannel(*from, payee, *amount, *lockTime, *feeRate)
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+		block, err := mineTransaction(bc, tx, fromPubKeyHash)
+		if err != nil {
+			return err
+		}
+		channels.Add(ch)
+		channels.SaveToFile()
+
+		fmt.Fprintf(cli.Stdout, "Opened channel %s with %.8f in block #%d\n", ch.ID(), ch.Capacity, block.Index)
+		fmt.Fprintf(cli.Stdout, "Channel for the payee: %s\n", ch.Encode())
+		return nil
+	}
+}
+
+// acceptChannel stores a channel opened to this wallet after checking its funding
+func (cli *CLI) acceptChannel(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("channel", "", "channel printed by openchannel")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *encoded == "" {
+			return usageError("-channel is required")
+		}
+		ch, err := core.DecodePaymentChannel(strings.TrimSpace(*encoded))
+		if err != nil {
+			return err
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		payee := crypto.EncodeAddress(crypto.PublicKeyHash(ch.Payee), crypto.AddressBase58)
+		if !wallets.HasAddress(payee) {
+			return fmt.Errorf("%w: channel pays %s", crypto.ErrWalletNotFound, payee)
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		if err := bc.CheckChannelFunding(ch); err != nil {
+			return err
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		if _, err := channels.Get(ch.ID()); err == nil {
+			return fmt.Errorf("channel %s is already stored", ch.ID())
+		}
+		channels.Add(ch)
+		channels.SaveToFile()
+
+		fmt.Fprintf(cli.Stdout, "Accepted channel %s of %.8f to %s\n", ch.ID(), ch.Capacity, payee)
+		fmt.Fprintf(cli.Stdout, "Payable: %.8f, settle before lock time %d\n", ch.Remaining(), ch.LockTime)
+		return nil
+	}
+}
+
+// payChannel signs a payment through a channel and prints the update for the payee
+func (cli *CLI) payChannel(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	id := fs.String("channel", "", "channel ID")
+	amount := fs.Float64("amount", 0, "amount to pay")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *id == "" {
+			return usageError("-channel is required")
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		ch, err := channels.Get(*id)
+		if err != nil {
+			return err
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		payer, err := wallets.GetWallet(crypto.EncodeAddress(crypto.PublicKeyHash(ch.Payer), crypto.AddressBase58))
+		if err != nil {
+			return err
+		}
+		update, err := ch.Pay(*amount, payer)
+		if err != nil {
+			return err
+		}
+		channels.SaveToFile()
+
+		fmt.Fprintf(cli.Stdout, "Paid %.8f in total, %.8f left\n", ch.Paid, ch.Remaining())
+		fmt.Fprintf(cli.Stdout, "Update for the payee: %s\n", update.Encode())
+		return nil
+	}
+}
+
+// receiveChannel checks and countersigns a channel update from the payer
+func (cli *CLI) receiveChannel(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("update", "", "update printed by paychannel")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *encoded == "" {
+			return usageError("-update is required")
+		}
+		update, err := core.DecodeChannelUpdate(strings.TrimSpace(*encoded))
+		if err != nil {
+			return err
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		ch, err := channels.Get(update.ChannelID)
+		if err != nil {
+			return err
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		payee, err := wallets.GetWallet(crypto.EncodeAddress(crypto.PublicKeyHash(ch.Payee), crypto.AddressBase58))
+		if err != nil {
+			return err
+		}
+		received, err := ch.Receive(update, payee)
+		if err != nil {
+			return err
+		}
+		channels.SaveToFile()
+
+		fmt.Fprintf(cli.Stdout, "Received %.8f, %.8f in total over %d updates\n", received, ch.Paid, ch.Updates)
+		return nil
+	}
+}
+
+// closeChannel settles a channel with its latest commitment and mines it
+func (cli *CLI) closeChannel(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	id := fs.String("channel", "", "channel ID")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *id == "" {
+			return usageError("-channel is required")
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		ch, err := channels.Get(*id)
+		if err != nil {
+			return err
+		}
+		tx, err := ch.CloseTransaction()
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		block, err := mineTransaction(bc, tx, crypto.PublicKeyHash(ch.Payee))
+		if err != nil {
+			return err
+		}
+		ch.ClosingTxID = tx.ID
+		channels.SaveToFile()
+
+		fmt.Fprintf(cli.Stdout, "Settled channel %s paying %.8f in transaction %s (block #%d)\n", ch.ID(), ch.Paid, tx.ID, block.Index)
+		return nil
+	}
+}
+
+// refundChannel takes back the coins of a channel the payee did not settle in time
+func (cli *CLI) refundChannel(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	id := fs.String("channel", "", "channel ID")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *id == "" {
+			return usageError("-channel is required")
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		ch, err := channels.Get(*id)
+		if err != nil {
+			return err
+		}
+		var refund *core.Transaction
+		err = cli.spendContract(cfg, *passphrase, func(b *core.TxBuilder) (*core.Transaction, error) {
+			refund, err = b.RefundChannel(ch, *feeRate)
+			return refund, err
+		})
+		if err != nil {
+			return err
+		}
+		ch.ClosingTxID = refund.ID
+		channels.SaveToFile()
+		return nil
+	}
+}
+
+// listChannels prints the payment channels of the node
+func (cli *CLI) listChannels(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		channels, err := core.NewChannels(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		for _, ch := range channels.List() {
+			state := "open"
+			if ch.ClosingTxID != "" {
+				state = "closed by " + ch.ClosingTxID
+			}
+			fmt.Fprintf(cli.Stdout, "%s %s -> %s: %.8f of %.8f paid in %d updates, lock time %d, %s\n", ch.ID(),
+				crypto.EncodeAddress(crypto.PublicKeyHash(ch.Payer), crypto.AddressBase58),
+				crypto.EncodeAddress(crypto.PublicKeyHash(ch.Payee), crypto.AddressBase58),
+				ch.Paid, ch.Capacity, ch.Updates, ch.LockTime, state)
+		}
+		return nil
+	}
+}
+
+// decodePubKey resolves a hex public key, or an address whose key the wallet knows
+func decodePubKey(wallets *crypto.Wallets, key string) ([]byte, error) {
+	if pubKey, ok := wallets.FindPublicKey(key); ok {
+		return pubKey, nil
+	}
+	pubKey, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %q is neither a hex public key nor a wallet address", key)
+	}
+	if _, err := crypto.KeyTypeOf(pubKey); err != nil {
+		return nil, fmt.Errorf("key %q: %w", key, err)
+	}
+	return pubKey, nil
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK    = 0 // Command succeeded
+	ExitError = 1 // Command failed
+	ExitUsage = 2 // Command line could not be parsed
+)
+
+// errUsage signals that the command line was invalid and help should be shown
+var errUsage = errors.New("invalid usage")
+
+// command describes a single CLI subcommand
+type command struct {
+	name    string
+	summary string
+	usage   string                              // Argument synopsis shown in help
+	setup   func(fs *flag.FlagSet) func() error // Registers flags and returns the action
+}
+
+// CLI parses command line arguments and runs subcommands
+type CLI struct {
+	Stdout   io.Writer
+	Stderr   io.Writer
+	commands map[string]*command
+}
+
+// New creates a CLI writing to the process stdout and stderr
+func New() *CLI {
+	cli := &CLI{Stdout: os.Stdout, Stderr: os.Stderr, commands: make(map[string]*command)}
+	for _, cmd := range []*command{
+		{"createwallet", "Create a new wallet and print its address", "[-keytype p256|secp256k1|schnorr] [-format base58|bech32m]", cli.createWallet},
+		{"createhdwallet", "Add an HD seed from a new mnemonic to the wallet", "[-words N] [-mnemonic-passphrase PASSPHRASE] [-seed HEX]", cli.createHDWallet},
+		{"restorewallet", "Restore an HD wallet from its mnemonic and rescan the chain", "[-mnemonic WORDS] [-mnemonic-passphrase PASSPHRASE] [-gaplimit N]", cli.restoreWallet},
+		{"getnewaddress", "Derive the next address of an HD wallet", "[-change] [-format base58|bech32m]", cli.getNewAddress},
+		{"scanhdwallet", "Add the HD wallet addresses used on the chain", "[-gaplimit N]", cli.scanHDWallet},
+		{"encryptwallet", "Encrypt the private keys in the wallet file", "[-passphrase PASSPHRASE]", cli.encryptWallet},
+		{"walletpassphrase", "Unlock the wallet of the running node", "[-passphrase PASSPHRASE] [-timeout SECONDS]", cli.walletPassphrase},
+		{"walletlock", "Lock the wallet of the running node", "", cli.walletLock},
+		{"walletpassphrasechange", "Change the wallet passphrase", "[-old PASSPHRASE] [-new PASSPHRASE]", cli.walletPassphraseChange},
+		{"listaddresses", "List the addresses of all wallets", "[-format base58|bech32m]", cli.listAddresses},
+		{"dumpprivkey", "Print the private key of an address", "-address ADDRESS", cli.dumpPrivKey},
+		{"importprivkey", "Import a private key from dumpprivkey and rescan its coins", "[-privkey KEY]", cli.importPrivKey},
+		{"importaddress", "Watch an address or public key without its private key", "-address ADDRESS | -pubkey HEX [-rescan=false] [-from HEIGHT]", cli.importAddress},
+		{"signmessage", "Sign a message with the key of an address", "-address ADDRESS -message MESSAGE", cli.signMessage},
+		{"verifymessage", "Verify a message signature against an address", "-address ADDRESS -signature BASE64 -message MESSAGE", cli.verifyMessage},
+		{"decodescript", "Print the class and opcodes of a script", "-hex HEX | -asm ASM", cli.decodeScript},
+		{"getpubkey", "Print the public key of a wallet address", "-address ADDRESS", cli.getPubKey},
+		{"createmultisig", "Add an M-of-N multisig address to the wallet", "-required M -keys KEY,KEY,... [-format base58|bech32m]", cli.createMultisig},
+		{"spendmultisig", "Print an unsigned transaction spending from a multisig address", "-from ADDRESS -to ADDRESS -amount AMOUNT [-feerate RATE]", cli.spendMultisig},
+		{"signmultisig", "Add the wallet's signatures to a multisig transaction", "-tx HEX", cli.signMultisig},
+		{"createpsbt", "Print a PSBT spending from an address whose keys may be elsewhere", "-from ADDRESS -to ADDRESS -amount AMOUNT [-feerate RATE] [-locktime N] [-lockuntil N] [-sequence N]", cli.createPSBT},
+		{"updatepsbt", "Add the spent outputs, redeem scripts and key paths to a PSBT", "-psbt BASE64", cli.updatePSBT},
+		{"signpsbt", "Add the wallet's signatures to a PSBT, works offline", "-psbt BASE64", cli.signPSBT},
+		{"combinepsbt", "Merge the signatures of several PSBTs", "-psbts BASE64,BASE64,...", cli.combinePSBT},
+		{"finalizepsbt", "Finalize a PSBT and print the signed transaction", "-psbt BASE64", cli.finalizePSBT},
+		{"decodepsbt", "Print the inputs, outputs and signatures of a PSBT", "-psbt BASE64", cli.decodePSBTCommand},
+		{"issuetoken", "Create a token and mine its supply to the issuing address", "-from ADDRESS -name NAME -supply N [-symbol SYMBOL] [-metadata TEXT] [-feerate RATE]", cli.issueToken},
+		{"sendtoken", "Send token units to an address", "-from ADDRESS -to ADDRESS -token ID -amount N [-feerate RATE]", cli.sendToken},
+		{"listtokens", "List the tokens issued on the chain", "", cli.listTokens},
+		{"mintnft", "Mint an NFT for a content hash and mine it", "-from ADDRESS -name NAME -contenthash HEX | -file PATH [-uri URI] [-feerate RATE]", cli.mintNFT},
+		{"transfernft", "Send an NFT to an address or burn it", "-from ADDRESS -nft ID -to ADDRESS | -burn [-feerate RATE]", cli.transferNFT},
+		{"nfthistory", "Print the content and ownership history of an NFT", "-nft ID", cli.nftHistory},
+		{"listnfts", "List the NFTs held by an address", "-address ADDRESS", cli.listNFTs},
+		{"publishdata", "Embed data or a file hash in an unspendable output and mine it", "-from ADDRESS -data HEX | -text TEXT | -file PATH [-feerate RATE]", cli.publishData},
+		{"finddata", "List the data outputs whose data starts with a prefix", "[-prefix HEX]", cli.findData},
+		{"openchannel", "Fund a payment channel to a payee and mine it", "-from ADDRESS -to KEY -amount AMOUNT [-locktime N] [-feerate RATE]", cli.openChannel},
+		{"acceptchannel", "Store a payment channel opened to this wallet after checking its funding", "-channel CHANNEL", cli.acceptChannel},
+		{"paychannel", "Sign a payment through a channel and print the update for the payee", "-channel ID -amount AMOUNT", cli.payChannel},
+		{"receivechannel", "Check and countersign a channel update from the payer", "-update UPDATE", cli.receiveChannel},
+		{"closechannel", "Settle a channel with its latest commitment", "-channel ID", cli.closeChannel},
+		{"refundchannel", "Take back the coins of a channel not settled before its lock time", "-channel ID [-feerate RATE]", cli.refundChannel},
+		{"listchannels", "List the payment channels of this node", "", cli.listChannels},
+		{"initiateswap", "Create a swap secret and fund a contract paying the participant for it", "-from ADDRESS -to ADDRESS -amount AMOUNT [-locktime N] [-feerate RATE]", cli.initiateSwap},
+		{"participateswap", "Fund a contract paying the initiator for the secret behind a hash", "-from ADDRESS -to ADDRESS -amount AMOUNT -secrethash HEX [-locktime N] [-feerate RATE]", cli.participateSwap},
+		{"auditswap", "Print the terms of a swap contract and its coins on this chain", "-contract HEX", cli.auditSwap},
+		{"redeemswap", "Claim the coins of a swap contract with its secret", "-contract HEX -secret HEX [-feerate RATE]", cli.redeemSwap},
+		{"refundswap", "Take back the coins of an expired swap contract", "-contract HEX [-feerate RATE]", cli.refundSwap},
+		{"extractsecret", "Print the secret revealed by the redeem of a swap contract", "-contract HEX", cli.extractSecret},
+		{"sendrawtransaction", "Verify a signed transaction and mine a block containing it", "-tx HEX -address ADDRESS", cli.sendRawTransaction},
+		{"getbalance", "Print the balance of an address", "-address ADDRESS", cli.getBalance},
+		{"gethistory", "Print the transactions touching an address", "-address ADDRESS", cli.getHistory},
+		{"send", "Send coins, mined at once on regtest and through the node's mempool elsewhere", "-from ADDRESS -to ADDRESS -amount AMOUNT [-feerate RATE] [-lockuntil N]", cli.send},
+		{"bumpfee", "Replace a wallet transaction in the node's mempool by one paying a higher fee", "-txid ID [-feerate RATE]", cli.bumpFee},
+		{"generate", "Mine blocks on demand (regtest only)", "-blocks N -address ADDRESS", cli.generate},
+		{"printchain", "Print all blocks of the chain", "", cli.printChain},
+		{"reindex", "Rebuild the UTXO set from the chain", "", cli.reindex},
+		{"startnode", "Start the API and peer servers", "[-port PORT] [-miner-address ADDRESS]", cli.startNode},
+		{"validate", "Check block links, proof of work and signatures", "", cli.validate},
+	} {
+		cli.commands[cmd.name] = cmd
+	}
+	return cli
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit code
+func (cli *CLI) Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		if len(args) > 1 {
+			if cmd, ok := cli.commands[args[1]]; ok {
+				fs := cli.commandFlags(cmd)
+				cmd.setup(fs) // Register the flags so they are listed
+				fs.Usage()
+				return ExitOK
+			}
+		}
+		cli.printUsage()
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+
+	cmd, ok := cli.commands[args[0]]
+	if !ok {
+		fmt.Fprintf(cli.Stderr, "Unknown command %q\n\n", args[0])
+		cli.printUsage()
+		return ExitUsage
+	}
+
+	fs := cli.commandFlags(cmd)
+	action := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(cli.Stderr, "Unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return ExitUsage
+	}
+
+	if err := action(); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(cli.Stderr, err)
+			fs.Usage()
+			return ExitUsage
+		}
+		fmt.Fprintln(cli.Stderr, "Error:", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// commandFlags creates the flag set for a subcommand
+func (cli *CLI) commandFlags(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(cli.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(cli.Stderr, "Usage: aztecs %s %s\n\n%s\n", cmd.name, cmd.usage, cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(cli.Stderr, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// printUsage lists all subcommands
+func (cli *CLI) printUsage() {
+	names := make([]string, 0, len(cli.commands))
+	for name := range cli.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(cli.Stderr, "Usage: aztecs <command> [flags]")
+	fmt.Fprintln(cli.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(cli.Stderr, "  %-14s %s\n", name, cli.commands[name].summary)
+	}
+	fmt.Fprintln(cli.Stderr, "\nRun 'aztecs help <command>' for the flags of a command.")
+}
+
+// usageError reports an invalid command line
+func usageError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,396 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"aztecs/api"
+	"aztecs/config"
+	"aztecs/consensus"
+	"aztecs/core"
+	"aztecs/core/script"
+	"aztecs/crypto"
+	"aztecs/p2p"
+	"aztecs/params"
+	"aztecs/storage"
+)
+
+// createWallet creates a wallet and saves it to the wallet file
+func (cli *CLI) createWallet(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	formatName := fs.String("format", "base58", "address format: base58 or bech32m")
+	keyTypeName := fs.String("keytype", "p256", "key type: p256, secp256k1 or schnorr")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		format, err := crypto.ParseAddressFormat(*formatName)
+		if err != nil {
+			return usageError("%v", err)
+		}
+		keyType, err := crypto.ParseKeyType(*keyTypeName)
+		if err != nil {
+			return usageError("%v", err)
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		address, err := wallets.AddWalletOfType(keyType)
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		if address, err = crypto.FormatAddress(address, format); err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "New wallet address: %s\n", address)
+		return nil
+	}
+}
+
+// listAddresses prints every wallet address, watch-only ones last
+func (cli *CLI) listAddresses(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	formatName := fs.String("format", "base58", "address format: base58 or bech32m")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		format, err := crypto.ParseAddressFormat(*formatName)
+		if err != nil {
+			return usageError("%v", err)
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		for _, address := range wallets.GetAddresses() {
+			if address, err = crypto.FormatAddress(address, format); err != nil {
+				return err
+			}
+			fmt.Fprintln(cli.Stdout, address)
+		}
+		for _, address := range wallets.GetWatchOnlyAddresses() {
+			if address, err = crypto.FormatAddress(address, format); err != nil {
+				return err
+			}
+			fmt.Fprintf(cli.Stdout, "%s (watch-only)\n", address)
+		}
+		for _, address := range wallets.GetScriptAddresses() {
+			redeemScript, _ := wallets.GetScript(address)
+			if address, err = crypto.FormatAddress(address, format); err != nil {
+				return err
+			}
+			if m, pubKeys, ok := script.ExtractMultiSig(redeemScript); ok {
+				fmt.Fprintf(cli.Stdout, "%s (multisig %d-of-%d)\n", address, m, len(pubKeys))
+			} else {
+				fmt.Fprintf(cli.Stdout, "%s (script)\n", address)
+			}
+		}
+		return nil
+	}
+}
+
+// getBalance prints the balance of an address
+func (cli *CLI) getBalance(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "address to query")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		_, pubKeyHash, err := crypto.DecodeAddress(*address)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		balance := bc.BalanceFrom(pubKeyHash, wallets.HistoryStart(*address))
+		fmt.Fprintf(cli.Stdout, "Balance of %s: %.8f\n", *address, balance)
+		cli.printTokenBalances(bc, pubKeyHash)
+		return nil
+	}
+}
+
+// send pays an address from a wallet. On networks that mine on demand, such
+// as regtest, it signs the transaction and mines it into a new block whose
+// reward goes to the sender. Elsewhere the running node builds and signs it
+// with its wallet and keeps it in its mempool until a block is mined.
+func (cli *CLI) send(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, true)
+	from := fs.String("from", "", "source wallet address")
+	to := fs.String("to", "", "destination address")
+	amount := fs.Float64("amount", 0, "amount to send")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	lockUntil := fs.Int64("lockuntil", 0, "block height or Unix time before which the recipient cannot spend the payment")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" || *to == "" {
+			return usageError("-from and -to are required")
+		}
+		if *amount <= 0 {
+			return usageError("-amount must be positive")
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+		recipient, err := core.NewLockedRecipient(*to, *amount, *lockUntil)
+		if err != nil {
+			return err
+		}
+		if !params.Active.GenerateAllowed {
+			body := map[string]interface{}{"fromAddress": *from, "toAddress": *to, "amount": *amount, "feeRate": *feeRate, "lockUntil": *lockUntil}
+			reply, err := callNode(cfg, http.MethodPost, "/transactions", body)
+			if err != nil {
+				return err
+			}
+			tx, _ := reply["transaction"].(map[string]interface{})
+			fmt.Fprintf(cli.Stdout, "Sent %.8f from %s to %s with fee %.8f in transaction %v (in the node's mempool)\n", *amount, *from, *to, reply["fee"], tx["ID"])
+			return nil
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		builder := core.NewTxBuilder(bc, wallets, nil)
+		tx, _, err := builder.Build(*from, []core.Recipient{recipient}, *feeRate)
+		if err != nil {
+			return err
+		}
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			return err
+		}
+		coinbase := core.NewCoinbaseTXWithFees(fromPubKeyHash, "", bc.Height()+1, fee)
+		block, err := consensus.MineBlock(bc, []*core.Transaction{coinbase, tx})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Sent %.8f from %s to %s with fee %.8f in transaction %s (block #%d)\n", *amount, *from, *to, fee, tx.ID, block.Index)
+		return nil
+	}
+}
+
+// generate mines blocks on demand on networks that allow it, such as regtest
+func (cli *CLI) generate(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	blocks := fs.Int("blocks", 1, "number of blocks to mine")
+	address := fs.String("address", "", "address that receives the block rewards")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		pubKeyHash, err := crypto.DecodeKeyAddress(*address)
+		if err != nil {
+			return err
+		}
+
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		generated, err := consensus.GenerateBlocks(bc, pubKeyHash, *blocks)
+		for _, block := range generated {
+			fmt.Fprintln(cli.Stdout, block.Hash)
+		}
+		return err
+	}
+}
+
+// printChain prints every block and its transactions
+func (cli *CLI) printChain(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		for _, block := range bc.Blocks {
+			fmt.Fprintf(cli.Stdout, "============ Block #%d ============\n", block.Index)
+			fmt.Fprintf(cli.Stdout, "Hash:      %s\n", block.Hash)
+			fmt.Fprintf(cli.Stdout, "Prev hash: %s\n", block.PrevHash)
+			fmt.Fprintf(cli.Stdout, "Timestamp: %s\n", block.Timestamp)
+			fmt.Fprintf(cli.Stdout, "Nonce:     %d\n", block.Nonce)
+			for _, tx := range block.Transactions {
+				fmt.Fprintf(cli.Stdout, "  Transaction %s\n", tx.ID)
+				if tx.LockTime != 0 {
+					fmt.Fprintf(cli.Stdout, "    Lock time: %d\n", tx.LockTime)
+				}
+				if id := tx.IssuedTokenID(); id != "" {
+					fmt.Fprintf(cli.Stdout, "    Issues token %s: %s (%s), supply %d\n", id, tx.Issuance.Name, tx.Issuance.Symbol, tx.Issuance.Supply)
+				}
+				for i, vin := range tx.Vin {
+					if tx.IsCoinbase() {
+						fmt.Fprintf(cli.Stdout, "    Input %d: coinbase\n", i)
+						continue
+					}
+					fmt.Fprintf(cli.Stdout, "    Input %d: %s:%d\n", i, vin.Txid, vin.Vout)
+					if vin.Sequence != 0 {
+						fmt.Fprintf(cli.Stdout, "      Sequence: %#x\n", vin.Sequence)
+					}
+				}
+				for i, vout := range tx.Vout {
+					if data, ok := script.ExtractNullData(vout.Script); ok {
+						fmt.Fprintf(cli.Stdout, "    Output %d: data %x\n", i, data)
+						if vout.TokenID != "" {
+							fmt.Fprintf(cli.Stdout, "      Burns: %d of %s\n", vout.TokenAmount, vout.TokenID)
+						}
+						continue
+					}
+					fmt.Fprintf(cli.Stdout, "    Output %d: %.8f to %x\n", i, vout.Value, vout.PubKeyHash)
+					if vout.TokenID != "" {
+						fmt.Fprintf(cli.Stdout, "      Token: %d of %s\n", vout.TokenAmount, vout.TokenID)
+					}
+					if len(vout.Script) > 0 {
+						asm, _ := script.Disasm(vout.Script)
+						fmt.Fprintf(cli.Stdout, "      Script: %s\n", asm)
+					}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// reindex rebuilds the UTXO set from the blocks on disk
+func (cli *CLI) reindex(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc.UTXOSet.BuildFromBlockchain(bc)
+		bc.UTXOSet.SaveToFile()
+
+		count := 0
+		for _, vouts := range bc.UTXOSet.UTXOs {
+			count += len(vouts)
+		}
+		fmt.Fprintf(cli.Stdout, "Reindexed %d blocks, %d unspent outputs\n", len(bc.Blocks), count)
+		return nil
+	}
+}
+
+// validate checks the whole chain and fails if any block is invalid
+func (cli *CLI) validate(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		if err := consensus.ValidateChain(bc); err != nil {
+			return fmt.Errorf("chain is invalid: %w", err)
+		}
+		fmt.Fprintf(cli.Stdout, "Chain of %d blocks is valid\n", len(bc.Blocks))
+		return nil
+	}
+}
+
+// startNode runs the API and peer servers until the process is interrupted
+func (cli *CLI) startNode(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, true)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+
+		var minerPubKeyHash []byte
+		if cfg.MinerAddress != "" {
+			if minerPubKeyHash, err = crypto.DecodeKeyAddress(cfg.MinerAddress); err != nil {
+				return fmt.Errorf("miner address: %w", err)
+			}
+		}
+
+		// Initialize database
+		db := storage.NewBlockchainDB(cfg.DataDir)
+		defer db.Close()
+
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+
+		addrManager, err := p2p.NewAddrManager(cfg.DataDir, cfg.Seeds)
+		if err != nil {
+			return err
+		}
+		server := p2p.NewServer(cfg.P2PListen, addrManager)
+		if cfg.P2PEncrypt || len(cfg.P2PAllow) > 0 {
+			nodeKey, err := p2p.LoadOrCreateNodeKey(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+			server.Transport = p2p.NewSecureTransport(nodeKey, cfg.P2PAllow)
+			fmt.Fprintln(cli.Stdout, "Node identity:", server.Transport.NodeID())
+		}
+		if err := server.Start(); err != nil {
+			return err
+		}
+		defer server.Stop()
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- api.StartServer(bc, cfg, minerPubKeyHash)
+		}()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		select {
+		case err := <-errc:
+			return err
+		case <-interrupt:
+			fmt.Fprintln(cli.Stdout, "Shutting down")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// publishData embeds data in an OP_RETURN output and mines the transaction
+func (cli *CLI) publishData(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address paying the fee")
+	dataHex := fs.String("data", "", "hex data to embed")
+	text := fs.String("text", "", "text to embed, instead of -data")
+	file := fs.String("file", "", "file whose SHA-256 to embed, instead of -data")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" {
+			return usageError("-from is required")
+		}
+		set := 0
+		for _, source := range []string{*dataHex, *text, *file} {
+			if source != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return usageError("use exactly one of -data, -text and -file")
+		}
+		var data []byte
+		switch {
+		case *file != "":
+			content, err := os.ReadFile(*file)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(content)
+			data = sum[:]
+		case *text != "":
+			data = []byte(*text)
+		default:
+			if data, err = hex.DecodeString(strings.TrimSpace(*dataHex)); err != nil {
+				return usageError("-data is not valid hex: %v", err)
+			}
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		tx, _, err := core.NewTxBuilder(bc, wallets, nil).PublishData(*from, data, *feeRate)
+		if err != nil {
+			return err
+		}
+		block, err := mineTransaction(bc, tx, fromPubKeyHash)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Published %x in transaction %s (block #%d)\n", data, tx.ID, block.Index)
+		return nil
+	}
+}
+
+// findData prints the data outputs whose data starts with a prefix
+func (cli *CLI) findData(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	prefixHex := fs.String("prefix", "", "hex prefix of the data, empty to list all data outputs")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		prefix, err := hex.DecodeString(strings.TrimSpace(*prefixHex))
+		if err != nil {
+			return usageError("-prefix is not valid hex: %v", err)
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range bc.FindData(prefix) {
+			fmt.Fprintf(cli.Stdout, "%x in %s:%d (block #%d, %s)\n", entry.Data, entry.TxID, entry.Index,
+				entry.Height, bc.Blocks[entry.Height].Timestamp.UTC().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	}
+}
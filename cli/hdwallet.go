@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// createHDWallet adds an HD seed to the wallet file, generated from a new
+// mnemonic unless a raw seed is given
+func (cli *CLI) createHDWallet(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	words := fs.Int("words", 12, "number of mnemonic words: 12, 15, 18, 21 or 24")
+	mnemonicPassphrase := fs.String("mnemonic-passphrase", "", "optional passphrase extending the mnemonic")
+	seedHex := fs.String("seed", "", "hex encoded seed to restore instead of creating a mnemonic")
+	gapLimit := fs.Int("gaplimit", crypto.DefaultGapLimit, "unused addresses scanned past the last used one when restoring")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		restore := *seedHex != ""
+		var seed []byte
+		var mnemonic string
+		if restore {
+			if seed, err = hex.DecodeString(*seedHex); err != nil {
+				return usageError("-seed is not valid hex: %v", err)
+			}
+		} else {
+			if *words < 12 || *words > 24 || *words%3 != 0 {
+				return usageError("-words must be 12, 15, 18, 21 or 24")
+			}
+			if mnemonic, err = crypto.NewMnemonic(*words / 3 * 32); err != nil {
+				return err
+			}
+			if seed, err = crypto.MnemonicToSeed(mnemonic, *mnemonicPassphrase); err != nil {
+				return err
+			}
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		if err := wallets.SetHDSeed(seed); err != nil {
+			return err
+		}
+		if restore {
+			bc, err := core.NewBlockchain(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+			found, err := scanHD(bc, wallets, *gapLimit)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cli.Stdout, "Restored %d used addresses\n", found)
+		} else {
+			fmt.Fprintf(cli.Stdout, "Mnemonic (write it down, it restores the wallet): %s\n", mnemonic)
+		}
+		address, err := wallets.AddWallet()
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		accountKey, _ := wallets.HDAccountKey()
+		fmt.Fprintf(cli.Stdout, "Account public key: %s\n", accountKey)
+		fmt.Fprintf(cli.Stdout, "New wallet address: %s\n", address)
+		return nil
+	}
+}
+
+// restoreWallet rebuilds an HD wallet from its mnemonic by scanning the chain
+// for addresses derived from it
+func (cli *CLI) restoreWallet(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	mnemonic := fs.String("mnemonic", "", "mnemonic words (prompted if empty)")
+	mnemonicPassphrase := fs.String("mnemonic-passphrase", "", "passphrase the mnemonic was created with")
+	gapLimit := fs.Int("gaplimit", crypto.DefaultGapLimit, "unused addresses scanned past the last used one")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		words, err := readPassphrase(*mnemonic, "Mnemonic: ")
+		if err != nil {
+			return err
+		}
+		seed, err := crypto.MnemonicToSeed(words, *mnemonicPassphrase)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		if err := wallets.SetHDSeed(seed); err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		found, err := scanHD(bc, wallets, *gapLimit)
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		balance := 0.0
+		for _, address := range wallets.GetAddresses() {
+			if _, pubKeyHash, err := crypto.DecodeAddress(address); err == nil {
+				balance += bc.GetBalance(pubKeyHash)
+			}
+		}
+		fmt.Fprintf(cli.Stdout, "Restored %d used addresses with a balance of %.8f\n", found, balance)
+		return nil
+	}
+}
+
+// getNewAddress derives the next receive or change address of an HD wallet
+func (cli *CLI) getNewAddress(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	change := fs.Bool("change", false, "derive a change address instead of a receive address")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	formatName := fs.String("format", "base58", "address format: base58 or bech32m")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		format, err := crypto.ParseAddressFormat(*formatName)
+		if err != nil {
+			return usageError("%v", err)
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		if !wallets.IsHD() {
+			return crypto.ErrNoHDChain
+		}
+
+		var address string
+		if *change {
+			address, err = wallets.NewChangeAddress()
+		} else {
+			address, err = wallets.AddWallet()
+		}
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		if address, err = crypto.FormatAddress(address, format); err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, address)
+		return nil
+	}
+}
+
+// scanHDWallet adds the HD addresses the chain has paid to
+func (cli *CLI) scanHDWallet(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	gapLimit := fs.Int("gaplimit", crypto.DefaultGapLimit, "unused addresses scanned past the last used one")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		found, err := scanHD(bc, wallets, *gapLimit)
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		fmt.Fprintf(cli.Stdout, "Found %d used addresses\n", found)
+		return nil
+	}
+}
+
+// scanHD runs the gap-limit scan of wallets against the chain
+func scanHD(bc *core.Blockchain, wallets *crypto.Wallets, gapLimit int) (int, error) {
+	if gapLimit <= 0 {
+		return 0, usageError("-gaplimit must be positive")
+	}
+	used := bc.UsedPubKeyHashes()
+	return wallets.ScanHD(func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	}, gapLimit)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+
+	"aztecs/config"
+	"aztecs/crypto"
+)
+
+// signMessage signs a message with the key of a wallet address
+func (cli *CLI) signMessage(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "wallet address whose key signs")
+	message := fs.String("message", "", "message to sign")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		wallet, err := wallets.GetWallet(*address)
+		if err != nil {
+			return err
+		}
+		signature, err := wallet.SignMessage(*message)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, signature)
+		return nil
+	}
+}
+
+// verifyMessage checks a message signature against an address
+func (cli *CLI) verifyMessage(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "address that supposedly signed")
+	signature := fs.String("signature", "", "base64 signature from signmessage")
+	message := fs.String("message", "", "signed message")
+	return func() error {
+		if _, err := flags.Load(); err != nil {
+			return err
+		}
+		if *address == "" || *signature == "" {
+			return usageError("-address and -signature are required")
+		}
+		valid, err := crypto.VerifyMessage(*address, *signature, *message)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("signature does not match %s", *address)
+		}
+		fmt.Fprintln(cli.Stdout, "Signature is valid")
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// getPubKey prints the public key of a wallet address, to share with cosigners
+func (cli *CLI) getPubKey(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "wallet address")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		pubKey, ok := wallets.FindPublicKey(*address)
+		if !ok {
+			return fmt.Errorf("%w: %s", crypto.ErrWalletNotFound, *address)
+		}
+		fmt.Fprintf(cli.Stdout, "%x\n", pubKey)
+		return nil
+	}
+}
+
+// createMultisig adds an m-of-n multisig address to the wallet
+func (cli *CLI) createMultisig(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	required := fs.Int("required", 0, "number of signatures required")
+	keys := fs.String("keys", "", "comma separated hex public keys or wallet addresses")
+	formatName := fs.String("format", "base58", "address format: base58 or bech32m")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *required <= 0 || *keys == "" {
+			return usageError("-required and -keys are required")
+		}
+		format, err := crypto.ParseAddressFormat(*formatName)
+		if err != nil {
+			return usageError("%v", err)
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		address, redeemScript, err := core.AddMultisig(wallets, *required, strings.Split(*keys, ","))
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		if address, err = crypto.FormatAddress(address, format); err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Multisig address: %s\n", address)
+		fmt.Fprintf(cli.Stdout, "Redeem script: %x\n", redeemScript)
+		return nil
+	}
+}
+
+// spendMultisig prints an unsigned transaction spending from a multisig address
+func (cli *CLI) spendMultisig(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "multisig address to spend from")
+	to := fs.String("to", "", "destination address")
+	amount := fs.Float64("amount", 0, "amount to send")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" || *to == "" {
+			return usageError("-from and -to are required")
+		}
+		if *amount <= 0 {
+			return usageError("-amount must be positive")
+		}
+		recipient, err := core.NewRecipient(*to, *amount)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		tx, _, err := core.NewTxBuilder(bc, wallets, nil).BuildMultisig(*from, []core.Recipient{recipient}, *feeRate)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, hex.EncodeToString(tx.Serialize()))
+		return nil
+	}
+}
+
+// signMultisig adds the signatures of the wallet keys to a multisig spend
+func (cli *CLI) signMultisig(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	txHex := fs.String("tx", "", "hex transaction from spendmultisig or another cosigner")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		tx, err := decodeTransaction(*txHex)
+		if err != nil {
+			return err
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		progress, err := bc.SignMultisig(tx, wallets)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cli.Stdout, hex.EncodeToString(tx.Serialize()))
+		fmt.Fprintf(cli.Stdout, "Added %d signatures, %d of %d multisig inputs complete\n", progress.Added, progress.Complete, progress.Inputs)
+		return nil
+	}
+}
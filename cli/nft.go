@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// mintNFT mints an NFT for a piece of content and mines it
+func (cli *CLI) mintNFT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address minting and receiving the NFT")
+	name := fs.String("name", "", "NFT name")
+	contentHash := fs.String("contenthash", "", "hex SHA-256 of the content")
+	file := fs.String("file", "", "file to hash as the content, instead of -contenthash")
+	uri := fs.String("uri", "", "URI of the NFT metadata")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" {
+			return usageError("-from is required")
+		}
+		var hash []byte
+		switch {
+		case *file != "" && *contentHash != "":
+			return usageError("use either -contenthash or -file")
+		case *file != "":
+			data, err := os.ReadFile(*file)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			hash = sum[:]
+		default:
+			if hash, err = hex.DecodeString(*contentHash); err != nil || len(hash) != sha256.Size {
+				return usageError("-contenthash must be a hex SHA-256 hash")
+			}
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		tx, _, err := core.NewTxBuilder(bc, wallets, nil).MintNFT(*from, *name, hash, *uri, *feeRate)
+		if err != nil {
+			return err
+		}
+		block, err := mineTransaction(bc, tx, fromPubKeyHash)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Minted %s to %s in transaction %s (block #%d)\n", *name, *from, tx.ID, block.Index)
+		fmt.Fprintf(cli.Stdout, "NFT ID: %s\n", tx.IssuedTokenID())
+		return nil
+	}
+}
+
+// transferNFT moves an NFT to an address, or burns it, and mines the transaction
+func (cli *CLI) transferNFT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address holding the NFT")
+	to := fs.String("to", "", "destination address")
+	id := fs.String("nft", "", "NFT ID")
+	burn := fs.Bool("burn", false, "destroy the NFT instead of sending it")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" || *id == "" {
+			return usageError("-from and -nft are required")
+		}
+		if (*to == "") == !*burn {
+			return usageError("use either -to or -burn")
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		token, err := bc.FindToken(*id)
+		if err != nil {
+			return err
+		}
+		if !token.IsNFT() {
+			return fmt.Errorf("%w: %s", core.ErrNotNFT, *id)
+		}
+		builder := core.NewTxBuilder(bc, wallets, nil)
+		var tx *core.Transaction
+		if *burn {
+			tx, _, err = builder.BurnToken(*from, *id, 1, *feeRate)
+		} else {
+			tx, _, err = builder.SendToken(*from, *to, *id, 1, *feeRate)
+		}
+		if err != nil {
+			return err
+		}
+		block, err := mineTransaction(bc, tx, fromPubKeyHash)
+		if err != nil {
+			return err
+		}
+
+		if *burn {
+			fmt.Fprintf(cli.Stdout, "Burned %s in transaction %s (block #%d)\n", token.Name, tx.ID, block.Index)
+		} else {
+			fmt.Fprintf(cli.Stdout, "Sent %s to %s in transaction %s (block #%d)\n", token.Name, *to, tx.ID, block.Index)
+		}
+		return nil
+	}
+}
+
+// nftHistory prints the content, metadata and owners of an NFT
+func (cli *CLI) nftHistory(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	id := fs.String("nft", "", "NFT ID")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *id == "" {
+			return usageError("-nft is required")
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		history, err := bc.NFTHistory(*id)
+		if err != nil {
+			return err
+		}
+		token, _ := bc.FindToken(*id)
+
+		fmt.Fprintf(cli.Stdout, "NFT %s: %s\n", token.ID, token.Name)
+		fmt.Fprintf(cli.Stdout, "Content hash: %x\n", token.ContentHash)
+		if token.Metadata != "" {
+			fmt.Fprintf(cli.Stdout, "URI: %s\n", token.Metadata)
+		}
+		for i, owner := range history {
+			switch {
+			case owner.Burned:
+				fmt.Fprintf(cli.Stdout, "  Burned in %s (block #%d)\n", owner.TxID, owner.Height)
+			case i == 0:
+				fmt.Fprintf(cli.Stdout, "  Minted to %s in %s (block #%d)\n", owner.Address, owner.TxID, owner.Height)
+			default:
+				fmt.Fprintf(cli.Stdout, "  Sent to %s in %s (block #%d)\n", owner.Address, owner.TxID, owner.Height)
+			}
+		}
+		return nil
+	}
+}
+
+// listNFTs prints the NFTs held by an address
+func (cli *CLI) listNFTs(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "address to query")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		_, pubKeyHash, err := crypto.DecodeAddress(*address)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		for _, nft := range bc.NFTsOf(pubKeyHash) {
+			fmt.Fprintf(cli.Stdout, "%s %s (content %x)\n", nft.ID, nft.Name, nft.ContentHash)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// dumpPrivKey prints the exported private key of a wallet address
+func (cli *CLI) dumpPrivKey(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "wallet address whose key is exported")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		key, err := wallets.DumpPrivateKey(*address)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, key)
+		return nil
+	}
+}
+
+// importPrivKey adds an exported private key to the wallet file and rescans
+// the UTXO set for its coins
+func (cli *CLI) importPrivKey(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	privKey := fs.String("privkey", "", "private key from dumpprivkey (prompted if empty)")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		encoded, err := readPassphrase(*privKey, "Private key: ")
+		if err != nil {
+			return err
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		address, err := wallets.ImportPrivateKey(encoded)
+		if err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		utxos, balance := rescanUTXOs(bc, address)
+		fmt.Fprintf(cli.Stdout, "Imported %s: %d unspent outputs, balance %.8f\n", address, utxos, balance)
+		return nil
+	}
+}
+
+// rescanUTXOs counts the unspent outputs and balance of address
+func rescanUTXOs(bc *core.Blockchain, address string) (int, float64) {
+	_, pubKeyHash, err := crypto.DecodeAddress(address)
+	if err != nil {
+		return 0, 0
+	}
+	return len(bc.UTXOSet.FindUTXOs(pubKeyHash)), bc.GetBalance(pubKeyHash)
+}
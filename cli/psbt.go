@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// createPSBT prints a PSBT paying from an address whose keys may be elsewhere
+func (cli *CLI) createPSBT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet, watch-only or multisig address to spend from")
+	to := fs.String("to", "", "destination address")
+	amount := fs.Float64("amount", 0, "amount to send")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	lockTime := fs.Int64("locktime", 0, "block height or Unix time before which the transaction cannot be mined")
+	lockUntil := fs.Int64("lockuntil", 0, "block height or Unix time before which the recipient cannot spend the payment")
+	sequence := fs.Uint("sequence", 0, "sequence number of the inputs: blocks the spent coins must be confirmed for")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" || *to == "" {
+			return usageError("-from and -to are required")
+		}
+		if *amount <= 0 {
+			return usageError("-amount must be positive")
+		}
+		recipient, err := core.NewLockedRecipient(*to, *amount, *lockUntil)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		tx, _, err := core.NewTxBuilder(bc, wallets, nil).WithLockTime(*lockTime).WithSequence(uint32(*sequence)).BuildUnsigned(*from, []core.Recipient{recipient}, *feeRate)
+		if err != nil {
+			return err
+		}
+		p, err := core.NewPSBT(tx)
+		if err != nil {
+			return err
+		}
+		if err := bc.UpdatePSBT(p, wallets); err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, p.Encode())
+		return nil
+	}
+}
+
+// updatePSBT adds the spent outputs, redeem scripts and key paths the node knows
+func (cli *CLI) updatePSBT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("psbt", "", "base64 PSBT")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		p, err := decodePSBT(*encoded)
+		if err != nil {
+			return err
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		if err := bc.UpdatePSBT(p, wallets); err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, p.Encode())
+		return nil
+	}
+}
+
+// signPSBT adds the wallet's signatures. It does not read the chain, so it
+// runs on an offline machine holding only the wallet.
+func (cli *CLI) signPSBT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("psbt", "", "base64 PSBT")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		p, err := decodePSBT(*encoded)
+		if err != nil {
+			return err
+		}
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		added, err := p.Sign(wallets)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cli.Stdout, p.Encode())
+		fmt.Fprintf(cli.Stdout, "Added %d signatures\n", added)
+		return nil
+	}
+}
+
+// combinePSBT merges PSBTs signed by different signers
+func (cli *CLI) combinePSBT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("psbts", "", "comma separated base64 PSBTs")
+	return func() error {
+		if _, err := flags.Load(); err != nil {
+			return err
+		}
+		if *encoded == "" {
+			return usageError("-psbts is required")
+		}
+		var psbts []*core.PSBT
+		for _, s := range strings.Split(*encoded, ",") {
+			p, err := decodePSBT(s)
+			if err != nil {
+				return err
+			}
+			psbts = append(psbts, p)
+		}
+		combined, err := core.CombinePSBTs(psbts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, combined.Encode())
+		return nil
+	}
+}
+
+// finalizePSBT builds the unlocking scripts and prints the signed
+// transaction for sendrawtransaction once every input is complete
+func (cli *CLI) finalizePSBT(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("psbt", "", "base64 PSBT")
+	return func() error {
+		if _, err := flags.Load(); err != nil {
+			return err
+		}
+		p, err := decodePSBT(*encoded)
+		if err != nil {
+			return err
+		}
+		if !p.Finalize() {
+			fmt.Fprintln(cli.Stdout, p.Encode())
+			fmt.Fprintln(cli.Stdout, "Incomplete: some inputs still need signatures")
+			return nil
+		}
+		tx, err := p.Extract()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, hex.EncodeToString(tx.Serialize()))
+		return nil
+	}
+}
+
+// decodePSBTCommand prints the contents of a PSBT for review before signing
+func (cli *CLI) decodePSBTCommand(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	encoded := fs.String("psbt", "", "base64 PSBT")
+	return func() error {
+		if _, err := flags.Load(); err != nil {
+			return err
+		}
+		p, err := decodePSBT(*encoded)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Transaction %s\n", p.Tx.ID)
+		if p.Tx.LockTime != 0 {
+			fmt.Fprintf(cli.Stdout, "Lock time: %d\n", p.Tx.LockTime)
+		}
+		var in, out float64
+		known := true
+		for i, vin := range p.Tx.Vin {
+			input := p.Inputs[i]
+			fmt.Fprintf(cli.Stdout, "  Input %d: %s:%d\n", i, vin.Txid, vin.Vout)
+			if vin.Sequence != 0 {
+				fmt.Fprintf(cli.Stdout, "    Sequence: %#x\n", vin.Sequence)
+			}
+			if input.PrevOut == nil {
+				known = false
+				fmt.Fprintln(cli.Stdout, "    Spends: unknown, run updatepsbt")
+				continue
+			}
+			in += input.PrevOut.Value
+			fmt.Fprintf(cli.Stdout, "    Spends: %.8f (%s)\n", input.PrevOut.Value, script.Classify(input.PrevOut.LockingScript()))
+			if input.FinalScriptSig != nil {
+				fmt.Fprintln(cli.Stdout, "    Final")
+				continue
+			}
+			var lines []string
+			for key := range input.PartialSigs {
+				lines = append(lines, "Signed by: "+key)
+			}
+			for key, path := range input.Derivations {
+				lines = append(lines, fmt.Sprintf("Key %s at %s", key, path))
+			}
+			sort.Strings(lines)
+			for _, line := range lines {
+				fmt.Fprintf(cli.Stdout, "    %s\n", line)
+			}
+		}
+		for i, vout := range p.Tx.Vout {
+			out += vout.Value
+			address := crypto.EncodeAddress(vout.PubKeyHash, crypto.AddressBase58)
+			if script.Classify(vout.LockingScript()) == script.ScriptHashTy {
+				address = crypto.EncodeScriptAddress(vout.PubKeyHash, crypto.AddressBase58)
+			}
+			fmt.Fprintf(cli.Stdout, "  Output %d: %.8f to %s\n", i, vout.Value, address)
+		}
+		if known {
+			fmt.Fprintf(cli.Stdout, "Fee: %.8f\n", in-out)
+		}
+		return nil
+	}
+}
+
+// decodePSBT parses the -psbt flag of the PSBT commands
+func decodePSBT(encoded string) (*core.PSBT, error) {
+	if encoded == "" {
+		return nil, usageError("-psbt is required")
+	}
+	return core.DecodePSBT(strings.TrimSpace(encoded))
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"aztecs/config"
+	"aztecs/consensus"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// sendRawTransaction verifies a signed transaction and mines a block containing it
+func (cli *CLI) sendRawTransaction(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	txHex := fs.String("tx", "", "hex transaction")
+	address := fs.String("address", "", "address that receives the block reward and fee")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		tx, err := decodeTransaction(*txHex)
+		if err != nil {
+			return err
+		}
+		if err := tx.CheckID(); err != nil {
+			return err
+		}
+		pubKeyHash, err := crypto.DecodeKeyAddress(*address)
+		if err != nil {
+			return err
+		}
+
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			return err
+		}
+		if err := bc.CheckTransaction(tx, bc.Height()+1, time.Now()); err != nil {
+			return err
+		}
+		coinbase := core.NewCoinbaseTXWithFees(pubKeyHash, "", bc.Height()+1, fee)
+		block, err := consensus.MineBlock(bc, []*core.Transaction{coinbase, tx})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Transaction %s with fee %.8f mined in block #%d\n", tx.ID, fee, block.Index)
+		return nil
+	}
+}
+
+// decodeTransaction parses the -tx flag of the raw transaction commands
+func decodeTransaction(txHex string) (*core.Transaction, error) {
+	if txHex == "" {
+		return nil, usageError("-tx is required")
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(txHex))
+	if err != nil {
+		return nil, usageError("-tx is not valid hex: %v", err)
+	}
+	return core.DeserializeTransaction(data)
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"aztecs/config"
+)
+
+// callNode sends a JSON request to the HTTP API of the running node and decodes the reply
+func callNode(cfg *config.Config, method, path string, body interface{}) (map[string]interface{}, error) {
+	host, port, err := net.SplitHostPort(cfg.APIListen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API listen address %q: %w", cfg.APIListen, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), path)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.RPCUser != "" {
+		req.SetBasicAuth(cfg.RPCUser, cfg.RPCPassword)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach node at %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	reply := make(map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("invalid reply from node: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if msg, ok := reply["error"]; ok {
+			return nil, fmt.Errorf("%v", msg)
+		}
+		return nil, fmt.Errorf("node returned %s", resp.Status)
+	}
+	return reply, nil
+}
+
+// readPassphrase returns value when set, otherwise prompts for a line on stdin
+func readPassphrase(value, prompt string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
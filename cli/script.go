@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"aztecs/config"
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// decodeScript prints the class, opcodes and address of a locking script
+func (cli *CLI) decodeScript(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	hexScript := fs.String("hex", "", "script as hex")
+	asm := fs.String("asm", "", "script as opcode names and hex data")
+	return func() error {
+		if _, err := flags.Load(); err != nil {
+			return err
+		}
+		var raw []byte
+		var err error
+		switch {
+		case *hexScript != "" && *asm == "":
+			raw, err = hex.DecodeString(*hexScript)
+		case *asm != "" && *hexScript == "":
+			raw, err = script.Assemble(*asm)
+		default:
+			return usageError("exactly one of -hex and -asm is required")
+		}
+		if err != nil {
+			return err
+		}
+		disasm, err := script.Disasm(raw)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Hex: %x\n", raw)
+		fmt.Fprintf(cli.Stdout, "Asm: %s\n", disasm)
+		fmt.Fprintf(cli.Stdout, "Class: %s\n", script.Classify(raw))
+		if pubKeyHash := script.ExtractPubKeyHash(raw); pubKeyHash != nil {
+			fmt.Fprintf(cli.Stdout, "Address: %s\n", crypto.EncodeAddress(pubKeyHash, crypto.AddressBase58))
+		}
+		if lockTime, ok := script.ExtractLockTime(raw); ok {
+			fmt.Fprintf(cli.Stdout, "Lock time: %d\n", lockTime)
+		}
+		return nil
+	}
+}
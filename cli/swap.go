@@ -0,0 +1,288 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"aztecs/config"
+	"aztecs/consensus"
+	"aztecs/core"
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// Default refund lock times. The participant's contract expires first, so
+// the initiator has to redeem it, revealing the secret, while the
+// participant still has time to redeem the initiator's contract.
+const (
+	initiatorLockTime   = 48 * time.Hour
+	participantLockTime = 24 * time.Hour
+)
+
+// initiateSwap creates a secret and funds a contract paying the participant for it
+func (cli *CLI) initiateSwap(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address funding the contract and receiving refunds")
+	to := fs.String("to", "", "participant's address on this chain")
+	amount := fs.Float64("amount", 0, "amount to lock in the contract")
+	lockTime := fs.Int64("locktime", 0, "block height or Unix time the refund opens at (default in 48 hours)")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		secret, secretHash, err := core.NewSwapSecret()
+		if err != nil {
+			return err
+		}
+		if *lockTime == 0 {
+			*lockTime = time.Now().Add(initiatorLockTime).Unix()
+		}
+		contract, err := cli.fundContract(cfg, *passphrase, *from, *to, *amount, secretHash, *lockTime, *feeRate)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Secret: %x\n", secret)
+		fmt.Fprintf(cli.Stdout, "Secret hash: %x\n", secretHash)
+		fmt.Fprintf(cli.Stdout, "Contract: %x\n", contract)
+		return nil
+	}
+}
+
+// participateSwap funds a contract paying the initiator for the secret behind a hash
+func (cli *CLI) participateSwap(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address funding the contract and receiving refunds")
+	to := fs.String("to", "", "initiator's address on this chain")
+	amount := fs.Float64("amount", 0, "amount to lock in the contract")
+	secretHash := fs.String("secrethash", "", "hex secret hash from the initiator's contract")
+	lockTime := fs.Int64("locktime", 0, "block height or Unix time the refund opens at (default in 24 hours)")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		hash, err := hex.DecodeString(*secretHash)
+		if err != nil || len(hash) == 0 {
+			return usageError("-secrethash must be a hex hash")
+		}
+		if *lockTime == 0 {
+			*lockTime = time.Now().Add(participantLockTime).Unix()
+		}
+		contract, err := cli.fundContract(cfg, *passphrase, *from, *to, *amount, hash, *lockTime, *feeRate)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Contract: %x\n", contract)
+		return nil
+	}
+}
+
+// fundContract adds the contract of a swap side to the wallet and mines a
+// transaction paying amount to it, like send
+func (cli *CLI) fundContract(cfg *config.Config, passphrase, from, to string, amount float64, secretHash []byte, lockTime int64, feeRate float64) ([]byte, error) {
+	if from == "" || to == "" {
+		return nil, usageError("-from and -to are required")
+	}
+	if amount <= 0 {
+		return nil, usageError("-amount must be positive")
+	}
+	fromPubKeyHash, err := crypto.DecodeKeyAddress(from)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := loadWallets(cfg, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := core.NewBlockchain(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	address, contract, err := core.AddHTLC(wallets, to, from, secretHash, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := core.NewRecipient(address, amount)
+	if err != nil {
+		return nil, err
+	}
+	tx, _, err := core.NewTxBuilder(bc, wallets, nil).Build(from, []core.Recipient{recipient}, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	wallets.SaveToFile()
+	block, err := mineTransaction(bc, tx, fromPubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(cli.Stdout, "Contract address: %s\n", address)
+	fmt.Fprintf(cli.Stdout, "Contract transaction: %s (block #%d)\n", tx.ID, block.Index)
+	return contract, nil
+}
+
+// auditSwap prints the terms of a contract and its state on this chain
+func (cli *CLI) auditSwap(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	contractHex := fs.String("contract", "", "hex contract")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		contract, err := decodeContract(*contractHex)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		sc, err := bc.AuditSwap(contract)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Contract address: %s\n", sc.Address)
+		fmt.Fprintf(cli.Stdout, "Unspent value: %.8f\n", sc.Value)
+		fmt.Fprintf(cli.Stdout, "Recipient: %s\n", crypto.EncodeAddress(sc.Recipient, crypto.AddressBase58))
+		fmt.Fprintf(cli.Stdout, "Refund: %s\n", crypto.EncodeAddress(sc.Refund, crypto.AddressBase58))
+		fmt.Fprintf(cli.Stdout, "Secret hash: %x\n", sc.SecretHash)
+		if sc.LockTime < script.LockTimeThreshold {
+			fmt.Fprintf(cli.Stdout, "Refund from: block #%d\n", sc.LockTime)
+		} else {
+			fmt.Fprintf(cli.Stdout, "Refund from: %s\n", time.Unix(sc.LockTime, 0).UTC().Format(time.RFC3339))
+		}
+		if sc.Secret != nil {
+			fmt.Fprintf(cli.Stdout, "Redeemed with secret: %x\n", sc.Secret)
+		}
+		return nil
+	}
+}
+
+// redeemSwap claims a contract's coins with the secret
+func (cli *CLI) redeemSwap(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	contractHex := fs.String("contract", "", "hex contract paying this wallet")
+	secretHex := fs.String("secret", "", "hex secret")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		contract, err := decodeContract(*contractHex)
+		if err != nil {
+			return err
+		}
+		secret, err := hex.DecodeString(*secretHex)
+		if err != nil || len(secret) == 0 {
+			return usageError("-secret must be hex")
+		}
+		return cli.spendContract(cfg, *passphrase, func(b *core.TxBuilder) (*core.Transaction, error) {
+			return b.RedeemSwap(contract, secret, *feeRate)
+		})
+	}
+}
+
+// refundSwap takes back the coins of an expired contract
+func (cli *CLI) refundSwap(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	contractHex := fs.String("contract", "", "hex contract funded by this wallet")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		contract, err := decodeContract(*contractHex)
+		if err != nil {
+			return err
+		}
+		return cli.spendContract(cfg, *passphrase, func(b *core.TxBuilder) (*core.Transaction, error) {
+			return b.RefundSwap(contract, *feeRate)
+		})
+	}
+}
+
+// spendContract mines the redeem or refund transaction returned by build
+func (cli *CLI) spendContract(cfg *config.Config, passphrase string, build func(*core.TxBuilder) (*core.Transaction, error)) error {
+	wallets, err := loadWallets(cfg, passphrase)
+	if err != nil {
+		return err
+	}
+	bc, err := core.NewBlockchain(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	tx, err := build(core.NewTxBuilder(bc, wallets, nil))
+	if err != nil {
+		return err
+	}
+	block, err := mineTransaction(bc, tx, tx.Vout[0].PubKeyHash)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.Stdout, "Sent %.8f to %s in transaction %s (block #%d)\n",
+		tx.Vout[0].Value, crypto.EncodeAddress(tx.Vout[0].PubKeyHash, crypto.AddressBase58), tx.ID, block.Index)
+	return nil
+}
+
+// extractSecret prints the secret revealed by the redeem of a contract on this chain
+func (cli *CLI) extractSecret(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	contractHex := fs.String("contract", "", "hex contract redeemed by the counterparty")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		contract, err := decodeContract(*contractHex)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		secret, err := bc.FindSwapSecret(contract)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Secret: %x\n", secret)
+		return nil
+	}
+}
+
+// mineTransaction mines a block containing tx, paying the reward and fee to pubKeyHash
+func mineTransaction(bc *core.Blockchain, tx *core.Transaction, pubKeyHash []byte) (*core.Block, error) {
+	fee, err := bc.TransactionFee(tx)
+	if err != nil {
+		return nil, err
+	}
+	coinbase := core.NewCoinbaseTXWithFees(pubKeyHash, "", bc.Height()+1, fee)
+	return consensus.MineBlock(bc, []*core.Transaction{coinbase, tx})
+}
+
+// decodeContract parses the -contract flag of the swap commands
+func decodeContract(contractHex string) ([]byte, error) {
+	if contractHex == "" {
+		return nil, usageError("-contract is required")
+	}
+	contract, err := hex.DecodeString(strings.TrimSpace(contractHex))
+	if err != nil {
+		return nil, usageError("-contract is not valid hex: %v", err)
+	}
+	return contract, nil
+}
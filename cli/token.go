@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// issueToken creates a token whose supply is paid to the issuing address and mines it
+func (cli *CLI) issueToken(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address issuing the token and receiving its supply")
+	name := fs.String("name", "", "token name")
+	symbol := fs.String("symbol", "", "token ticker symbol")
+	supply := fs.Uint64("supply", 0, "token units to create")
+	metadata := fs.String("metadata", "", "free-form description, such as a URI")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" {
+			return usageError("-from is required")
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		issuance := core.TokenIssuance{Name: *name, Symbol: *symbol, Supply: *supply, Metadata: *metadata}
+		tx, _, err := core.NewTxBuilder(bc, wallets, nil).IssueToken(*from, issuance, *feeRate)
+		if err != nil {
+			return err
+		}
+		block, err := mineTransaction(bc, tx, fromPubKeyHash)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cli.Stdout, "Issued %d %s to %s in transaction %s (block #%d)\n", *supply, *name, *from, tx.ID, block.Index)
+		fmt.Fprintf(cli.Stdout, "Token ID: %s\n", tx.IssuedTokenID())
+		return nil
+	}
+}
+
+// sendToken pays token units to an address and mines the transaction
+func (cli *CLI) sendToken(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	from := fs.String("from", "", "wallet address holding the tokens")
+	to := fs.String("to", "", "destination address")
+	token := fs.String("token", "", "token ID")
+	amount := fs.Uint64("amount", 0, "token units to send")
+	feeRate := fs.Float64("feerate", core.DefaultFeeRate, "fee in coins per 1000 bytes")
+	passphrase := fs.String("passphrase", "", "passphrase of an encrypted wallet (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *from == "" || *to == "" || *token == "" {
+			return usageError("-from, -to and -token are required")
+		}
+		if *amount == 0 {
+			return usageError("-amount must be positive")
+		}
+		fromPubKeyHash, err := crypto.DecodeKeyAddress(*from)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := loadWallets(cfg, *passphrase)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		tx, _, err := core.NewTxBuilder(bc, wallets, nil).SendToken(*from, *to, *token, *amount, *feeRate)
+		if err != nil {
+			return err
+		}
+		block, err := mineTransaction(bc, tx, fromPubKeyHash)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Sent %d units of token %s from %s to %s in transaction %s (block #%d)\n", *amount, *token, *from, *to, tx.ID, block.Index)
+		return nil
+	}
+}
+
+// listTokens prints the tokens issued on the chain
+func (cli *CLI) listTokens(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		for _, token := range bc.Tokens() {
+			fmt.Fprintf(cli.Stdout, "%s %s (%s) supply %d, issued in %s (block #%d)\n",
+				token.ID, token.Name, token.Symbol, token.Supply, token.TxID, token.Height)
+			if token.Metadata != "" {
+				fmt.Fprintf(cli.Stdout, "  %s\n", token.Metadata)
+			}
+		}
+		return nil
+	}
+}
+
+// printTokenBalances prints the token units held by pubKeyHash, ordered by token ID
+func (cli *CLI) printTokenBalances(bc *core.Blockchain, pubKeyHash []byte) {
+	balances := bc.GetTokenBalances(pubKeyHash)
+	ids := make([]string, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		symbol := ""
+		if token, err := bc.FindToken(id); err == nil {
+			symbol = " " + token.Symbol
+		}
+		fmt.Fprintf(cli.Stdout, "  %d%s (token %s)\n", balances[id], symbol, id)
+	}
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"aztecs/config"
+	"aztecs/crypto"
+)
+
+// loadWallets loads the wallet file, unlocking it with passphrase if it is encrypted
+func loadWallets(cfg *config.Config, passphrase string) (*crypto.Wallets, error) {
+	wallets, err := crypto.NewWallets(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	if wallets.IsEncrypted() {
+		if passphrase, err = readPassphrase(passphrase, "Wallet passphrase: "); err != nil {
+			return nil, err
+		}
+		if err := wallets.Unlock(passphrase, 0); err != nil {
+			return nil, err
+		}
+	}
+	return wallets, nil
+}
+
+// encryptWallet encrypts the private keys in the wallet file
+func (cli *CLI) encryptWallet(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	passphrase := fs.String("passphrase", "", "new wallet passphrase (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		pass, err := readPassphrase(*passphrase, "New wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := wallets.EncryptWallet(pass); err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, "Wallet encrypted and locked")
+		return nil
+	}
+}
+
+// walletPassphraseChange re-encrypts the wallet file under a new passphrase
+func (cli *CLI) walletPassphraseChange(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	oldPassphrase := fs.String("old", "", "current wallet passphrase (prompted if empty)")
+	newPassphrase := fs.String("new", "", "new wallet passphrase (prompted if empty)")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		oldPass, err := readPassphrase(*oldPassphrase, "Current wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		newPass, err := readPassphrase(*newPassphrase, "New wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := wallets.ChangePassphrase(oldPass, newPass); err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, "Wallet passphrase changed")
+		return nil
+	}
+}
+
+// walletPassphrase unlocks the wallet of the running node for a number of seconds
+func (cli *CLI) walletPassphrase(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, true)
+	passphrase := fs.String("passphrase", "", "wallet passphrase (prompted if empty)")
+	timeout := fs.Int("timeout", 60, "seconds until the wallet locks again, 0 for never")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *timeout < 0 {
+			return usageError("-timeout must not be negative")
+		}
+		pass, err := readPassphrase(*passphrase, "Wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		body := map[string]interface{}{"passphrase": pass, "timeout": *timeout}
+		if _, err := callNode(cfg, http.MethodPost, "/wallets/passphrase", body); err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.Stdout, "Wallet unlocked for %d seconds\n", *timeout)
+		return nil
+	}
+}
+
+// walletLock locks the wallet of the running node
+func (cli *CLI) walletLock(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, true)
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if _, err := callNode(cfg, http.MethodPost, "/wallets/lock", nil); err != nil {
+			return err
+		}
+		fmt.Fprintln(cli.Stdout, "Wallet locked")
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"aztecs/config"
+	"aztecs/core"
+	"aztecs/crypto"
+)
+
+// importAddress adds a watch-only address or public key to the wallet file
+func (cli *CLI) importAddress(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "address to watch")
+	pubKeyHex := fs.String("pubkey", "", "hex encoded public key to watch instead of an address")
+	rescan := fs.Bool("rescan", true, "count blocks already in the chain")
+	from := fs.Int64("from", 0, "block height the rescan starts at")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if (*address == "") == (*pubKeyHex == "") {
+			return usageError("exactly one of -address and -pubkey is required")
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+
+		// Without a rescan only blocks mined after the import count
+		fromHeight := bc.Height() + 1
+		if *rescan {
+			fromHeight = *from
+		}
+		var imported string
+		if *pubKeyHex != "" {
+			pubKey, err := hex.DecodeString(*pubKeyHex)
+			if err != nil {
+				return usageError("-pubkey is not valid hex: %v", err)
+			}
+			imported, err = wallets.ImportPublicKey(pubKey, fromHeight)
+			if err != nil {
+				return err
+			}
+		} else if imported, err = wallets.ImportAddress(*address, fromHeight); err != nil {
+			return err
+		}
+		wallets.SaveToFile()
+
+		_, pubKeyHash, _ := crypto.DecodeAddress(imported)
+		history := bc.History(pubKeyHash, fromHeight)
+		fmt.Fprintf(cli.Stdout, "Watching %s from block #%d: %d transactions, balance %.8f\n",
+			imported, fromHeight, len(history), bc.BalanceFrom(pubKeyHash, fromHeight))
+		return nil
+	}
+}
+
+// getHistory prints the transactions touching an address. Watch-only
+// addresses start at their rescan height.
+func (cli *CLI) getHistory(fs *flag.FlagSet) func() error {
+	flags := config.NewFlags(fs, false)
+	address := fs.String("address", "", "address to query")
+	return func() error {
+		cfg, err := flags.Load()
+		if err != nil {
+			return err
+		}
+		if *address == "" {
+			return usageError("-address is required")
+		}
+		_, pubKeyHash, err := crypto.DecodeAddress(*address)
+		if err != nil {
+			return err
+		}
+		wallets, err := crypto.NewWallets(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		bc, err := core.NewBlockchain(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range bc.History(pubKeyHash, wallets.HistoryStart(*address)) {
+			fmt.Fprintf(cli.Stdout, "#%d %s %+.8f\n", entry.Height, entry.TxID, entry.Received-entry.Sent)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"aztecs/params"
+)
+
+const defaultConfigFile = "aztecs.toml" // Config file looked up in the data directory
+
+// Log levels accepted by LogLevel
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+// Config holds the node configuration. Values are taken from the defaults,
+// then a TOML or YAML file, then AZTECS_* environment variables, then flags.
+type Config struct {
+	DataDir      string   `toml:"datadir" yaml:"datadir"`
+	Network      string   `toml:"network" yaml:"network"`
+	APIListen    string   `toml:"api_listen" yaml:"api_listen"`
+	P2PListen    string   `toml:"p2p_listen" yaml:"p2p_listen"`
+	Seeds        []string `toml:"seeds" yaml:"seeds"`
+	P2PEncrypt   bool     `toml:"p2p_encrypt" yaml:"p2p_encrypt"`
+	P2PAllow     []string `toml:"p2p_allow" yaml:"p2p_allow"`
+	MinerAddress string   `toml:"miner_address" yaml:"miner_address"`
+	RPCUser      string   `toml:"rpc_user" yaml:"rpc_user"`
+	RPCPassword  string   `toml:"rpc_password" yaml:"rpc_password"`
+	LogLevel     string   `toml:"log_level" yaml:"log_level"`
+}
+
+// Default returns the configuration used when nothing else is specified
+func Default() *Config {
+	dataDir := ".aztecs"
+	if home, err := os.UserHomeDir(); err == nil {
+		dataDir = filepath.Join(home, ".aztecs")
+	}
+	return &Config{
+		DataDir:  dataDir,
+		Network:  params.MainNet.Name,
+		LogLevel: LogInfo,
+	}
+}
+
+// LoadFile merges settings from a TOML or YAML file, chosen by extension
+func (cfg *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// ApplyEnv overrides settings with AZTECS_* environment variables
+func (cfg *Config) ApplyEnv() error {
+	fields := map[string]*string{
+		"AZTECS_DATADIR":       &cfg.DataDir,
+		"AZTECS_NETWORK":       &cfg.Network,
+		"AZTECS_API_LISTEN":    &cfg.APIListen,
+		"AZTECS_P2P_LISTEN":    &cfg.P2PListen,
+		"AZTECS_MINER_ADDRESS": &cfg.MinerAddress,
+		"AZTECS_RPC_USER":      &cfg.RPCUser,
+		"AZTECS_RPC_PASSWORD":  &cfg.RPCPassword,
+		"AZTECS_LOG_LEVEL":     &cfg.LogLevel,
+	}
+	for name, field := range fields {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := os.LookupEnv("AZTECS_SEEDS"); ok {
+		cfg.Seeds = SplitList(value)
+	}
+	if value, ok := os.LookupEnv("AZTECS_P2P_ALLOW"); ok {
+		cfg.P2PAllow = SplitList(value)
+	}
+	if value, ok := os.LookupEnv("AZTECS_P2P_ENCRYPT"); ok {
+		encrypt, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("AZTECS_P2P_ENCRYPT: %w", err)
+		}
+		cfg.P2PEncrypt = encrypt
+	}
+	return nil
+}
+
+// applyNetwork activates the configured network and fills in its defaults.
+// Networks other than mainnet keep their files in a subdirectory of the data directory.
+func (cfg *Config) applyNetwork() error {
+	if err := params.SetActive(cfg.Network); err != nil {
+		return err
+	}
+	if cfg.APIListen == "" {
+		cfg.APIListen = fmt.Sprintf(":%d", params.Active.DefaultAPIPort)
+	}
+	if cfg.P2PListen == "" {
+		cfg.P2PListen = fmt.Sprintf(":%d", params.Active.DefaultP2PPort)
+	}
+	if params.Active != &params.MainNet {
+		cfg.DataDir = filepath.Join(cfg.DataDir, params.Active.Name)
+	}
+	return nil
+}
+
+// Validate checks the configuration and creates the data directory
+func (cfg *Config) Validate() error {
+	if _, err := params.ByName(cfg.Network); err != nil {
+		return err
+	}
+	switch cfg.LogLevel {
+	case LogDebug, LogInfo, LogWarn, LogError:
+	default:
+		return fmt.Errorf("unknown log level %q", cfg.LogLevel)
+	}
+	if (cfg.RPCUser == "") != (cfg.RPCPassword == "") {
+		return fmt.Errorf("rpc_user and rpc_password must be set together")
+	}
+	if cfg.DataDir == "" {
+		return fmt.Errorf("datadir must not be empty")
+	}
+	return os.MkdirAll(cfg.DataDir, 0700)
+}
+
+// ApplyLogLevel configures the standard logger and gin for the log level.
+// Packages log progress through the standard logger, so it is silenced above info.
+func (cfg *Config) ApplyLogLevel() {
+	switch cfg.LogLevel {
+	case LogDebug:
+		gin.SetMode(gin.DebugMode)
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	case LogInfo:
+		gin.SetMode(gin.ReleaseMode)
+	default:
+		gin.SetMode(gin.ReleaseMode)
+		log.SetOutput(io.Discard)
+	}
+}
+
+// Flags binds command line flags that override the configuration
+type Flags struct {
+	fs           *flag.FlagSet
+	configFile   string
+	dataDir      string
+	network      string
+	logLevel     string
+	port         int
+	p2pPort      int
+	minerAddress string
+	seeds        string
+	encrypt      bool
+	allow        string
+	rpcUser      string
+	rpcPassword  string
+}
+
+// NewFlags registers the common flags on fs, plus the node flags when node is true
+func NewFlags(fs *flag.FlagSet, node bool) *Flags {
+	f := &Flags{fs: fs}
+	fs.StringVar(&f.configFile, "conf", "", "config file (TOML or YAML), default <datadir>/"+defaultConfigFile)
+	fs.StringVar(&f.dataDir, "datadir", "", "data directory")
+	fs.StringVar(&f.network, "network", "", "network to use: mainnet, testnet or regtest")
+	fs.StringVar(&f.logLevel, "loglevel", "", "log level: debug, info, warn or error")
+	if node {
+		fs.IntVar(&f.port, "port", 0, "HTTP API port")
+		fs.IntVar(&f.p2pPort, "p2p-port", 0, "peer-to-peer port")
+		fs.StringVar(&f.minerAddress, "miner-address", "", "address that receives mining rewards")
+		fs.StringVar(&f.seeds, "seeds", "", "comma separated seed peers (host:port)")
+		fs.BoolVar(&f.encrypt, "encrypt", false, "encrypt peer connections")
+		fs.StringVar(&f.allow, "allow", "", "comma separated node identities allowed to connect (implies -encrypt)")
+		fs.StringVar(&f.rpcUser, "rpcuser", "", "username required by the HTTP API")
+		fs.StringVar(&f.rpcPassword, "rpcpassword", "", "password required by the HTTP API")
+	}
+	return f
+}
+
+// Load builds the configuration after the flag set has been parsed
+func (f *Flags) Load() (*Config, error) {
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	cfg := Default()
+
+	// The data directory decides where the default config file lives
+	if dir, ok := os.LookupEnv("AZTECS_DATADIR"); ok {
+		cfg.DataDir = dir
+	}
+	if set["datadir"] {
+		cfg.DataDir = f.dataDir
+	}
+
+	path := f.configFile
+	if path == "" {
+		path = os.Getenv("AZTECS_CONFIG")
+	}
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
+	} else if err := cfg.LoadFile(filepath.Join(cfg.DataDir, defaultConfigFile)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := cfg.ApplyEnv(); err != nil {
+		return nil, err
+	}
+
+	if set["datadir"] {
+		cfg.DataDir = f.dataDir
+	}
+	if set["network"] {
+		cfg.Network = f.network
+	}
+	if set["loglevel"] {
+		cfg.LogLevel = f.logLevel
+	}
+	if set["port"] {
+		cfg.APIListen = fmt.Sprintf(":%d", f.port)
+	}
+	if set["p2p-port"] {
+		cfg.P2PListen = fmt.Sprintf(":%d", f.p2pPort)
+	}
+	if set["miner-address"] {
+		cfg.MinerAddress = f.minerAddress
+	}
+	if set["seeds"] {
+		cfg.Seeds = SplitList(f.seeds)
+	}
+	if set["encrypt"] {
+		cfg.P2PEncrypt = f.encrypt
+	}
+	if set["allow"] {
+		cfg.P2PAllow = SplitList(f.allow)
+	}
+	if set["rpcuser"] {
+		cfg.RPCUser = f.rpcUser
+	}
+	if set["rpcpassword"] {
+		cfg.RPCPassword = f.rpcPassword
+	}
+
+	if err := cfg.applyNetwork(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.ApplyLogLevel()
+	return cfg, nil
+}
+
+// SplitList splits a comma separated list, dropping empty entries
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
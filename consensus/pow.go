@@ -9,12 +9,12 @@ import (
 	"log"
 	"math"
 	"math/big"
+	"time"
 
 	"aztecs/core"
+	"aztecs/params"
 )
 
-const targetBits = 16 // Difficulty level (adjust as needed)
-
 // ProofOfWork represents a Proof of Work system
 type ProofOfWork struct {
 	block  *core.Block
@@ -24,7 +24,7 @@ type ProofOfWork struct {
 // NewProofOfWork creates a new ProofOfWork instance
 func NewProofOfWork(b *core.Block) *ProofOfWork {
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
+	target.Lsh(target, uint(256-params.Active.TargetBits)) // Difficulty of the active network
 	pow := &ProofOfWork{b, target}
 	return pow
 }
@@ -56,7 +56,7 @@ func (pow *ProofOfWork) Run() (int, string) {
 	var hash [32]byte
 	nonce := 0
 
-	fmt.Printf("Mining a new block with %d transactions\n", len(pow.block.Transactions))
+	log.Printf("Mining a new block with %d transactions", len(pow.block.Transactions))
 	for nonce < math.MaxInt64 {
 		data := pow.prepareData(nonce)
 
@@ -65,7 +65,7 @@ func (pow *ProofOfWork) Run() (int, string) {
 		hashInt.SetBytes(hash[:])
 
 		if hashInt.Cmp(pow.target) == -1 {
-			fmt.Printf("Block mined! Hash: %x\n", hash)
+			log.Printf("Block mined! Hash: %x", hash)
 			break
 		} else {
 			nonce++
@@ -93,4 +93,75 @@ func IntToHex(num int64) []byte {
 		log.Panic(err)
 	}
 	return buff.Bytes()
-}
\ No newline at end of file
+}
+
+// MineBlock mines a block containing transactions on top of the chain tip and appends it
+func MineBlock(bc *core.Blockchain, transactions []*core.Transaction) (*core.Block, error) {
+	tip := bc.Blocks[len(bc.Blocks)-1]
+	newBlock := core.NewBlock(tip.Index+1, time.Now(), transactions, tip.Hash)
+
+	pow := NewProofOfWork(newBlock)
+	nonce, hash := pow.Run()
+	newBlock.Hash = hash
+	newBlock.Nonce = nonce
+
+	if err := bc.AppendBlock(newBlock); err != nil {
+		return nil, err
+	}
+	return newBlock, nil
+}
+
+// GenerateBlocks mines n blocks paying their rewards to pubKeyHash.
+// It is only available on networks that allow on-demand generation.
+func GenerateBlocks(bc *core.Blockchain, pubKeyHash []byte, n int) ([]*core.Block, error) {
+	if !params.Active.GenerateAllowed {
+		return nil, fmt.Errorf("generate is not allowed on %s", params.Active.Name)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("number of blocks must be positive, got %d", n)
+	}
+
+	blocks := []*core.Block{}
+	for i := 0; i < n; i++ {
+		coinbase := core.NewCoinbaseTX(pubKeyHash, "", bc.Height()+1)
+		block, err := MineBlock(bc, []*core.Transaction{coinbase})
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// ValidateChain checks the genesis block, block linkage, proof of work and
+// transactions. The UTXO set is replayed from the genesis block, so every
+// block is checked against the outputs unspent before it, and transaction
+// IDs must match their contents and not repeat, see CheckBlock.
+func ValidateChain(bc *core.Blockchain) error {
+	if len(bc.Blocks) == 0 || bc.Blocks[0].Hash != core.NewGenesisBlock().Hash {
+		return fmt.Errorf("genesis block does not belong to %s", params.Active.Name)
+	}
+	utxos := &core.UTXOSet{UTXOs: make(map[string]map[int]*core.UTXO)}
+	utxos.Update(bc.Blocks[0])
+
+	for i := 1; i < len(bc.Blocks); i++ {
+		block := bc.Blocks[i]
+		prevBlock := bc.Blocks[i-1]
+
+		if block.PrevHash != prevBlock.Hash {
+			return fmt.Errorf("block #%d: previous block hash mismatch", block.Index)
+		}
+
+		pow := NewProofOfWork(block)
+		hash := sha256.Sum256(pow.prepareData(block.Nonce))
+		if !pow.Validate() || hex.EncodeToString(hash[:]) != block.Hash {
+			return fmt.Errorf("block #%d: invalid proof of work", block.Index)
+		}
+
+		if err := bc.CheckBlock(block, utxos); err != nil {
+			return err
+		}
+		utxos.Update(block)
+	}
+	return nil
+}
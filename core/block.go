@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"time"
+
+	"aztecs/params"
 )
 
 // Block represents a block in the blockchain
@@ -22,13 +24,35 @@ type Block struct {
 func (b *Block) CalculateHash() string {
 	// For now, we'll exclude transactions from the hash calculation.
 	// In a real blockchain, you would hash the transactions (e.g., using a Merkle tree).
-	record := string(b.Index) + b.Timestamp.String() + b.PrevHash + string(b.Nonce)
+	record := string(rune(b.Index)) + b.Timestamp.String() + b.PrevHash + string(rune(b.Nonce))
 	h := sha256.New()
 	h.Write([]byte(record))
 	hashed := h.Sum(nil)
 	return hex.EncodeToString(hashed)
 }
 
+// NewGenesisBlock creates the genesis block of the active network.
+// It depends only on the network parameters, so every node builds the same one.
+func NewGenesisBlock() *Block {
+	p := params.Active
+
+	// Coinbase transaction has no inputs and one output
+	genesisTx := &Transaction{
+		Vin: []TxInput{
+			{Txid: "", Vout: -1, Signature: nil, PubKey: []byte(p.GenesisMessage)}, // Coinbase input
+		},
+		Vout: []TxOutput{
+			{Value: p.BlockSubsidy(0), PubKeyHash: p.GenesisPubKeyHash},
+		},
+	}
+	genesisTx.SetID() // Calculate and set the transaction ID
+
+	genesisBlock := NewBlock(0, p.GenesisTimestamp, []*Transaction{genesisTx}, "")
+	// The genesis block is not mined, its hash is fixed by its contents
+	genesisBlock.Hash = genesisBlock.CalculateHash()
+	return genesisBlock
+}
+
 // NewBlock creates a new block
 // TODO: Accept a slice of Transactions instead of a data string
 func NewBlock(index int64, timestamp time.Time, transactions []*Transaction, prevHash string) *Block {
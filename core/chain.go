@@ -2,56 +2,46 @@ package core
 
 import (
 	"encoding/gob" // Import encoding/gob
-	"fmt"          // Import fmt
+	"encoding/hex"
+	"fmt" // Import fmt
 	"log"
 	"os" // Import os
+	"path/filepath"
 	"time"
+
+	"aztecs/crypto"
+	"aztecs/params"
 )
 
 const blockchainFile = "blockchain.dat" // Define blockchain data file name
 
 // Blockchain represents the blockchain
 type Blockchain struct {
-	Blocks  []*Block
-	UTXOSet *UTXOSet // Add UTXO set to the blockchain
+	Blocks    []*Block
+	UTXOSet   *UTXOSet   // Add UTXO set to the blockchain
+	filePath  string     // Location of blockchain.dat inside the data directory
+	dataIndex *dataIndex // Data outputs by prefix, built on first FindData
 }
 
-// NewBlockchain creates a new blockchain with a genesis block or loads from file
-func NewBlockchain() (*Blockchain, error) {
+// NewBlockchain creates a new blockchain with a genesis block or loads it
+// from blockchain.dat in dataDir
+func NewBlockchain(dataDir string) (*Blockchain, error) {
+	filePath := filepath.Join(dataDir, blockchainFile)
+
 	// Check if blockchain data file exists
-	if _, err := os.Stat(blockchainFile); os.IsNotExist(err) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		// File does not exist, create a new blockchain with genesis block
-		log.Println("Blockchain data file not found, creating new blockchain.")
-		// Create a placeholder genesis transaction
-		// Create a placeholder genesis transaction (coinbase transaction)
-		// Coinbase transaction has no inputs and one output
-		genesisTx := &Transaction{
-			ID: "genesis_tx", // Placeholder ID
-			Vin: []TxInput{
-				{Txid: "", Vout: -1, Signature: nil, PubKey: []byte("coinbase")}, // Coinbase input
-			},
-			Vout: []TxOutput{
-				{Value: 50.0, PubKeyHash: []byte("genesis_address_hash")}, // Output to genesis address (placeholder hash)
-			},
-		}
-		// Set the transaction ID
-		genesisTx.SetID() // Calculate and set the transaction ID
-
-		genesisBlock := NewBlock(0, time.Now(), []*Transaction{genesisTx}, "") // Pass a slice with the genesis transaction
-		// For simplicity, we'll calculate the genesis block hash directly here
-		// In a real scenario, mining would be involved
-		genesisBlock.Hash = genesisBlock.CalculateHash()
-		bc := &Blockchain{Blocks: []*Block{genesisBlock}}
+		log.Printf("Blockchain data file not found, creating new %s blockchain.", params.Active.Name)
+		bc := &Blockchain{Blocks: []*Block{NewGenesisBlock()}, filePath: filePath}
 
 		// Create and build the initial UTXO set from the genesis block
-		utxoSet, err := NewUTXOSet() // Create a new empty UTXO set and handle error
+		utxoSet, err := NewUTXOSet(dataDir) // Create a new empty UTXO set and handle error
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new UTXO set: %w", err)
 		}
-		// TODO: Implement BuildFromBlockchain method in utxo.go
-		// utxoSet.BuildFromBlockchain(bc) // Build from the blockchain
-		bc.UTXOSet = utxoSet // Assign the UTXO set to the blockchain
-		utxoSet.SaveToFile() // Save the initial UTXO set
+		utxoSet.BuildFromBlockchain(bc) // Build from the blockchain
+		bc.UTXOSet = utxoSet            // Assign the UTXO set to the blockchain
+		utxoSet.SaveToFile()            // Save the initial UTXO set
 
 		bc.SaveToFile() // Save the newly created blockchain
 		return bc, nil
@@ -59,7 +49,7 @@ func NewBlockchain() (*Blockchain, error) {
 
 	// File exists, load blockchain from file
 	log.Println("Blockchain data file found, loading blockchain.")
-	file, err := os.Open(blockchainFile) // Use = for assignment
+	file, err := os.Open(filePath) // Use = for assignment
 	if err != nil {
 		log.Panic(err)
 	}
@@ -72,8 +62,10 @@ func NewBlockchain() (*Blockchain, error) {
 		log.Panic(err)
 	}
 
+	bc.filePath = filePath
+
 	// Load or build the UTXO set
-	utxoSet, err := NewUTXOSet() // Try to load UTXO set and handle error
+	utxoSet, err := NewUTXOSet(dataDir) // Try to load UTXO set and handle error
 	if err != nil && !os.IsNotExist(err) {
 		log.Printf("Error loading UTXO set: %v", err)
 		return nil, err // Return error if loading fails for reasons other than file not existing
@@ -82,9 +74,8 @@ func NewBlockchain() (*Blockchain, error) {
 	if utxoSet.UTXOs == nil || len(utxoSet.UTXOs) == 0 {
 		// If UTXO set file didn't exist or was empty, build it from the loaded blockchain
 		log.Println("UTXO set data file not found or empty, building from blockchain.")
-		// TODO: Implement BuildFromBlockchain method in utxo.go
-		// utxoSet.BuildFromBlockchain(&bc) // Build from the loaded blockchain
-		utxoSet.SaveToFile() // Save the newly built UTXO set
+		utxoSet.BuildFromBlockchain(&bc) // Build from the loaded blockchain
+		utxoSet.SaveToFile()             // Save the newly built UTXO set
 	} else {
 		log.Println("UTXO set loaded successfully.")
 	}
@@ -104,10 +95,149 @@ func (bc *Blockchain) AddBlock(transactions []*Transaction) { // Accept a slice
 	newBlock.Hash = newBlock.CalculateHash() // Placeholder for mining
 	bc.Blocks = append(bc.Blocks, newBlock)
 	log.Printf("Block #%d added to the blockchain", newBlock.Index)
-	// TODO: Update UTXO set based on the actual transactions in the block
-	// bc.UTXOSet.Update(newBlock) // Update the UTXO set with the new block
-	// bc.UTXOSet.SaveToFile() // Save the updated UTXO set
-	bc.SaveToFile() // Save the blockchain after adding a block
+	bc.UTXOSet.Update(newBlock) // Update the UTXO set with the new block
+	if bc.dataIndex != nil {
+		bc.dataIndex.add(newBlock)
+	}
+	bc.UTXOSet.SaveToFile() // Save the updated UTXO set
+	bc.SaveToFile()         // Save the blockchain after adding a block
+}
+
+// Height returns the index of the block at the chain tip
+func (bc *Blockchain) Height() int64 {
+	return bc.Blocks[len(bc.Blocks)-1].Index
+}
+
+// AppendBlock adds an already mined block to the tip of the chain after
+// checking its transactions against the UTXO set, see CheckBlock
+func (bc *Blockchain) AppendBlock(block *Block) error {
+	tip := bc.Blocks[len(bc.Blocks)-1]
+	if block.PrevHash != tip.Hash || block.Index != tip.Index+1 {
+		return fmt.Errorf("block #%d does not extend the chain tip #%d", block.Index, tip.Index)
+	}
+	if err := bc.CheckBlock(block, bc.UTXOSet); err != nil {
+		return err
+	}
+
+	bc.Blocks = append(bc.Blocks, block)
+	log.Printf("Block #%d added to the blockchain", block.Index)
+	bc.UTXOSet.Update(block)
+	if bc.dataIndex != nil {
+		bc.dataIndex.add(block)
+	}
+	bc.UTXOSet.SaveToFile()
+	bc.SaveToFile()
+	return nil
+}
+
+// FindTransaction finds a transaction by its ID
+func (bc *Blockchain) FindTransaction(id string) (Transaction, error) {
+	tx, _, err := bc.findTransaction(id)
+	return tx, err
+}
+
+// findTransaction returns a transaction and the height of the block containing it
+func (bc *Blockchain) findTransaction(id string) (Transaction, int64, error) {
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			if tx.ID == id {
+				return *tx, block.Index, nil
+			}
+		}
+	}
+	return Transaction{}, 0, fmt.Errorf("transaction %s not found", id)
+}
+
+// previousTransactions collects the transactions referenced by the inputs of tx
+func (bc *Blockchain) previousTransactions(tx *Transaction) (map[string]Transaction, error) {
+	prevTXs := make(map[string]Transaction)
+	for _, vin := range tx.Vin {
+		prevTx, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			return nil, err
+		}
+		prevTXs[prevTx.ID] = prevTx
+	}
+	return prevTXs, nil
+}
+
+// SignTransaction signs the inputs of tx with the key of wallet
+func (bc *Blockchain) SignTransaction(tx *Transaction, wallet *crypto.Wallet) error {
+	prevTXs, err := bc.previousTransactions(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Sign(wallet, prevTXs)
+}
+
+// VerifyTransaction verifies the time locks and input scripts of tx for inclusion in the next block
+func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
+	return bc.VerifyTransactionAt(tx, bc.Height()+1, time.Now())
+}
+
+// VerifyTransactionAt reports whether tx passes CheckTransaction, logging why not
+func (bc *Blockchain) VerifyTransactionAt(tx *Transaction, height int64, timestamp time.Time) bool {
+	if err := bc.CheckTransaction(tx, height, timestamp); err != nil {
+		log.Printf("Cannot include transaction in block #%d: %v", height, err)
+		return false
+	}
+	return true
+}
+
+// CheckTransaction checks the data outputs, time locks, token amounts, coin
+// amounts and input scripts of tx as spent in the block at height with the
+// given timestamp
+func (bc *Blockchain) CheckTransaction(tx *Transaction, height int64, timestamp time.Time) error {
+	if err := tx.CheckDataOutputs(); err != nil {
+		return err
+	}
+	if tx.IsCoinbase() {
+		return bc.CheckTokens(tx)
+	}
+	if err := bc.CheckLocks(tx, height, timestamp); err != nil {
+		return err
+	}
+	if err := bc.CheckTokens(tx); err != nil {
+		return err
+	}
+	prevTXs, err := bc.previousTransactions(tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.CheckInputs(prevTXs); err != nil {
+		return err
+	}
+	if !tx.Verify(prevTXs, height, timestamp) {
+		return fmt.Errorf("transaction %s has invalid signatures", tx.ID)
+	}
+	return nil
+}
+
+// TransactionFee returns the value of the inputs of tx minus its outputs.
+// Every input must be a distinct unspent output in the UTXO set.
+func (bc *Blockchain) TransactionFee(tx *Transaction) (float64, error) {
+	if err := tx.checkDistinctInputs(); err != nil {
+		return 0, err
+	}
+	in := 0.0
+	for _, vin := range tx.Vin {
+		utxo := bc.UTXOSet.UTXOs[vin.Txid][vin.Vout]
+		if utxo == nil {
+			return 0, fmt.Errorf("input %s:%d is not an unspent output", vin.Txid, vin.Vout)
+		}
+		in += utxo.Value
+	}
+	out := 0.0
+	for _, vout := range tx.Vout {
+		if vout.Value < 0 {
+			return 0, fmt.Errorf("transaction %s has a negative output", tx.ID)
+		}
+		out += vout.Value
+	}
+	if out > in {
+		return 0, fmt.Errorf("transaction %s spends %.8f but its inputs only hold %.8f", tx.ID, out, in)
+	}
+	return fromUnits(toUnits(in - out)), nil // Round away float noise
 }
 
 // IsValid checks if the blockchain is valid
@@ -144,9 +274,14 @@ func (bc *Blockchain) GetBalance(pubKeyHash []byte) float64 {
 	return balance
 }
 
+// GetTokenBalances returns the units of every token held by a public key hash
+func (bc *Blockchain) GetTokenBalances(pubKeyHash []byte) map[string]uint64 {
+	return bc.UTXOSet.TokenBalances(pubKeyHash)
+}
+
 // SaveToFile saves the blockchain to a file
 func (bc *Blockchain) SaveToFile() {
-	file, err := os.Create(blockchainFile)
+	file, err := os.Create(bc.filePath)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -183,3 +318,16 @@ func (bc *Blockchain) LoadFromFile() error {
 	return nil
 }
 */
+
+// UsedPubKeyHashes returns the hex encoded public key hash of every output in the chain
+func (bc *Blockchain) UsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				used[hex.EncodeToString(out.PubKeyHash)] = true
+			}
+		}
+	}
+	return used
+}
@@ -0,0 +1,425 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+const channelFile = "channels.dat" // Payment channels of the node, next to wallet.dat
+
+// Errors returned by payment channel operations
+var (
+	ErrNotChannel      = errors.New("script is not a payment channel")
+	ErrChannelNotFound = errors.New("payment channel not found")
+	ErrChannelClosed   = errors.New("payment channel is closed")
+	ErrChannelCapacity = errors.New("payment exceeds the channel capacity")
+	ErrInvalidUpdate   = errors.New("invalid channel update")
+)
+
+// Magic bytes starting the encoded forms exchanged between channel parties
+var (
+	channelMagic = []byte("azchan\xff")
+	updateMagic  = []byte("azpay\xff")
+)
+
+// PaymentChannel is one party's view of a unidirectional payment channel.
+// The payer locks Capacity in a 2-of-2 output and pays the payee off-chain
+// by signing commitments spending it, each paying the payee more than the
+// last. The payee countersigns every commitment it accepts and settles the
+// channel with the latest one. If the payee never settles, the payer takes
+// the coins back alone from the lock time on.
+type PaymentChannel struct {
+	script.Channel
+	FundingTxID string
+	FundingVout int
+	Capacity    float64 // Value of the funding output
+	Fee         float64 // Fee paid by every commitment, agreed when opening
+	Paid        float64 // Coins paid to the payee by the latest commitment
+	Updates     uint64  // Commitments signed so far
+	PayerSig    []byte  // Payer signature of the latest commitment
+	PayeeSig    []byte  // Payee signature of the latest commitment, payee side only
+	ClosingTxID string  // Transaction settling or refunding the channel, empty while open
+}
+
+// ChannelUpdate is an off-chain payment: the payer's signature of the
+// commitment paying Paid to the payee
+type ChannelUpdate struct {
+	ChannelID string
+	Updates   uint64 // Sequence number of the commitment, one more than the last
+	Paid      float64
+	PayerSig  []byte
+}
+
+// ID returns the funding outpoint that identifies the channel
+func (ch *PaymentChannel) ID() string {
+	return outpoint(ch.FundingTxID, ch.FundingVout)
+}
+
+// Contract returns the redeem script of the funding output
+func (ch *PaymentChannel) Contract() []byte {
+	return script.PaymentChannel(ch.Channel)
+}
+
+// Address returns the base58 script address of the funding output
+func (ch *PaymentChannel) Address() string {
+	return crypto.EncodeScriptAddress(crypto.PublicKeyHash(ch.Contract()), crypto.AddressBase58)
+}
+
+// Remaining returns the coins the payer can still pay through the channel
+func (ch *PaymentChannel) Remaining() float64 {
+	return fromUnits(toUnits(ch.Capacity) - toUnits(ch.Fee) - toUnits(ch.Paid))
+}
+
+// fundingOutput returns the output the commitments spend
+func (ch *PaymentChannel) fundingOutput() TxOutput {
+	return NewScriptOutput(ch.Capacity, script.PayToScriptHash(crypto.PublicKeyHash(ch.Contract())))
+}
+
+// commitment builds the unsigned transaction paying paid units to the
+// payee and the rest, less the fee, back to the payer. Both parties build
+// the same transaction from the same amount. Outputs below the dust
+// threshold are added to the fee.
+func (ch *PaymentChannel) commitment(paid int64) *Transaction {
+	tx := &Transaction{Vin: []TxInput{{Txid: ch.FundingTxID, Vout: ch.FundingVout}}}
+	if paid >= toUnits(DustThreshold) {
+		tx.Vout = append(tx.Vout, TxOutput{Value: fromUnits(paid), PubKeyHash: crypto.PublicKeyHash(ch.Payee)})
+	}
+	if rest := toUnits(ch.Capacity) - toUnits(ch.Fee) - paid; rest >= toUnits(DustThreshold) {
+		tx.Vout = append(tx.Vout, TxOutput{Value: fromUnits(rest), PubKeyHash: crypto.PublicKeyHash(ch.Payer)})
+	}
+	tx.SetID()
+	return tx
+}
+
+// checkPayment checks that the channel is open and holds paid units for the payee
+func (ch *PaymentChannel) checkPayment(paid int64) error {
+	if ch.ClosingTxID != "" {
+		return fmt.Errorf("%w: %s", ErrChannelClosed, ch.ID())
+	}
+	if limit := toUnits(ch.Capacity) - toUnits(ch.Fee); paid > limit {
+		return fmt.Errorf("%w: %.8f paid of %.8f", ErrChannelCapacity, fromUnits(paid), fromUnits(limit))
+	}
+	return nil
+}
+
+// Pay signs the commitment paying amount more to the payee and returns the
+// update to send to the payee. payer must hold the payer key.
+func (ch *PaymentChannel) Pay(amount float64, payer *crypto.Wallet) (*ChannelUpdate, error) {
+	if toUnits(amount) <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %.8f", amount)
+	}
+	if !bytes.Equal(payer.PublicKey, ch.Payer) {
+		return nil, errors.New("wallet does not hold the payer key of the channel")
+	}
+	paid := toUnits(ch.Paid) + toUnits(amount)
+	if err := ch.checkPayment(paid); err != nil {
+		return nil, err
+	}
+	tx := ch.commitment(paid)
+	sig, err := payer.Sign(tx.SignatureHash(0, ch.fundingOutput()))
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Paid, ch.PayerSig = fromUnits(paid), sig
+	ch.Updates++
+	return &ChannelUpdate{ChannelID: ch.ID(), Updates: ch.Updates, Paid: ch.Paid, PayerSig: sig}, nil
+}
+
+// Receive checks an update from the payer, countersigns its commitment and
+// makes it the latest one. It returns the amount the update pays on top of
+// the previous commitment. payee must hold the payee key.
+func (ch *PaymentChannel) Receive(u *ChannelUpdate, payee *crypto.Wallet) (float64, error) {
+	if u.ChannelID != ch.ID() {
+		return 0, fmt.Errorf("%w: update is for channel %s", ErrInvalidUpdate, u.ChannelID)
+	}
+	if !bytes.Equal(payee.PublicKey, ch.Payee) {
+		return 0, errors.New("wallet does not hold the payee key of the channel")
+	}
+	if u.Updates != ch.Updates+1 {
+		return 0, fmt.Errorf("%w: update %d does not follow update %d", ErrInvalidUpdate, u.Updates, ch.Updates)
+	}
+	paid := toUnits(u.Paid)
+	if paid <= toUnits(ch.Paid) {
+		return 0, fmt.Errorf("%w: pays %.8f, not more than %.8f", ErrInvalidUpdate, u.Paid, ch.Paid)
+	}
+	if err := ch.checkPayment(paid); err != nil {
+		return 0, err
+	}
+	hash := ch.commitment(paid).SignatureHash(0, ch.fundingOutput())
+	if !crypto.VerifySignature(ch.Payer, hash, u.PayerSig) {
+		return 0, fmt.Errorf("%w: payer signature does not match the commitment", ErrInvalidUpdate)
+	}
+	sig, err := payee.Sign(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	received := fromUnits(paid - toUnits(ch.Paid))
+	ch.Paid, ch.Updates, ch.PayerSig, ch.PayeeSig = fromUnits(paid), u.Updates, u.PayerSig, sig
+	return received, nil
+}
+
+// CloseTransaction returns the latest commitment signed by both parties,
+// which settles the channel. Only the payee holds both signatures.
+func (ch *PaymentChannel) CloseTransaction() (*Transaction, error) {
+	if ch.ClosingTxID != "" {
+		return nil, fmt.Errorf("%w: %s", ErrChannelClosed, ch.ID())
+	}
+	if ch.Updates == 0 {
+		return nil, errors.New("nothing was paid through the channel, the payer refunds it")
+	}
+	if ch.PayerSig == nil || ch.PayeeSig == nil {
+		return nil, errors.New("only the payee holds the signed commitment")
+	}
+	tx := ch.commitment(toUnits(ch.Paid))
+	tx.Vin[0].ScriptSig = script.UnlockChannelClose(ch.PayerSig, ch.PayeeSig, ch.Contract())
+	return tx, nil
+}
+
+// channelInputSize estimates the serialized size of an input spending a
+// channel output with both signatures
+func channelInputSize(contract []byte) int {
+	const outpointSize = 70 // Txid, index, empty signature and key fields, script length
+	return outpointSize + 2*72 + 1 + len(contract) + 6
+}
+
+// OpenChannel builds a signed transaction funding a payment channel of
+// capacity coins from the wallet at address from to the public key payee.
+// From lockTime on the payer can take back what the payee has not settled.
+// The fee of the commitments is fixed here from feeRate. The channel refers
+// to the funding transaction by its ID, so the funding cannot be replaced to
+// bump its fee.
+func (b *TxBuilder) OpenChannel(from string, payee []byte, capacity float64, lockTime int64, feeRate float64) (*PaymentChannel, *Transaction, error) {
+	if lockTime <= 0 {
+		return nil, nil, fmt.Errorf("lock time must be positive, got %d", lockTime)
+	}
+	if _, err := crypto.KeyTypeOf(payee); err != nil {
+		return nil, nil, fmt.Errorf("payee key: %w", err)
+	}
+	wallet, err := b.wallets.GetWallet(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(wallet.PublicKey, payee) {
+		return nil, nil, errors.New("payer and payee must be different keys")
+	}
+
+	ch := &PaymentChannel{Channel: script.Channel{Payer: wallet.PublicKey, Payee: payee, LockTime: lockTime}, Capacity: capacity}
+	contract := ch.Contract()
+	fee := feeForSize(feeRate, txOverheadSize+channelInputSize(contract)+2*txOutputSize)
+	if toUnits(capacity)-fee < toUnits(DustThreshold) {
+		return nil, nil, fmt.Errorf("capacity must exceed the closing fee of %.8f", fromUnits(fee))
+	}
+	ch.Fee = fromUnits(fee)
+
+	recipient, err := NewRecipient(b.wallets.AddScript(contract), capacity)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, _, err := b.Build(from, []Recipient{recipient}, feeRate)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch.FundingTxID = tx.ID
+	for i, vout := range tx.Vout {
+		if bytes.Equal(vout.Script, recipient.Script) {
+			ch.FundingVout = i
+			break
+		}
+	}
+	return ch, tx, nil
+}
+
+// RefundChannel builds a signed transaction returning the coins of an
+// unsettled channel to the payer, whose key must be in the wallet, once
+// the lock time has passed
+func (b *TxBuilder) RefundChannel(ch *PaymentChannel, feeRate float64) (*Transaction, error) {
+	if feeRate < 0 {
+		return nil, fmt.Errorf("fee rate must not be negative, got %.8f", feeRate)
+	}
+	if !lockTimeReached(ch.LockTime, b.bc.Height()+1, time.Now().Unix()) {
+		return nil, fmt.Errorf("%w: channel refunds from lock time %d", ErrNonFinal, ch.LockTime)
+	}
+	payerHash := crypto.PublicKeyHash(ch.Payer)
+	wallet, err := b.wallets.GetWallet(crypto.EncodeAddress(payerHash, crypto.AddressBase58))
+	if err != nil {
+		return nil, err
+	}
+	if b.bc.UTXOSet.UTXOs[ch.FundingTxID][ch.FundingVout] == nil ||
+		(b.mempool != nil && b.mempool.IsSpent(ch.FundingTxID, ch.FundingVout)) {
+		return nil, fmt.Errorf("%w: %s", ErrNoContractCoins, ch.Address())
+	}
+
+	contract := ch.Contract()
+	fee := feeForSize(feeRate, txOverheadSize+channelInputSize(contract)+txOutputSize)
+	if toUnits(ch.Capacity)-fee < toUnits(DustThreshold) {
+		return nil, &InsufficientFundsError{Available: ch.Capacity, Required: fromUnits(fee + toUnits(DustThreshold))}
+	}
+	tx := &Transaction{
+		LockTime: b.lockTime,
+		Vin:      []TxInput{{Txid: ch.FundingTxID, Vout: ch.FundingVout, Sequence: b.sequence}},
+		Vout:     []TxOutput{{Value: fromUnits(toUnits(ch.Capacity) - fee), PubKeyHash: payerHash}},
+	}
+	tx.SetID()
+	sig, err := wallet.Sign(tx.SignatureHash(0, ch.fundingOutput()))
+	if err != nil {
+		return nil, err
+	}
+	tx.Vin[0].ScriptSig = script.UnlockChannelRefund(sig, contract)
+	return tx, nil
+}
+
+// CheckChannelFunding checks that the funding output of a channel received
+// from the payer is unspent on the chain and locks Capacity to its contract
+func (bc *Blockchain) CheckChannelFunding(ch *PaymentChannel) error {
+	utxo := bc.UTXOSet.UTXOs[ch.FundingTxID][ch.FundingVout]
+	if utxo == nil {
+		return fmt.Errorf("%w: %s", ErrNoContractCoins, ch.Address())
+	}
+	if funding := ch.fundingOutput(); !bytes.Equal(utxo.Script, funding.Script) || toUnits(utxo.Value) != toUnits(ch.Capacity) || utxo.TokenID != "" {
+		return fmt.Errorf("output %s does not fund the channel with %.8f", ch.ID(), ch.Capacity)
+	}
+	if ch.Fee < 0 || ch.Remaining() < DustThreshold {
+		return fmt.Errorf("channel fee %.8f leaves nothing to pay", ch.Fee)
+	}
+	return nil
+}
+
+// Encode returns the base64 form of the channel terms the payer sends to
+// the payee. Payments and signatures are left out.
+func (ch *PaymentChannel) Encode() string {
+	var buf bytes.Buffer
+	buf.Write(channelMagic)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(ch.Payer))))
+	buf.Write(ch.Payer)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(ch.Payee))))
+	buf.Write(ch.Payee)
+	buf.Write(binary.AppendVarint(nil, ch.LockTime))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(ch.FundingTxID))))
+	buf.WriteString(ch.FundingTxID)
+	buf.Write(binary.AppendUvarint(nil, uint64(ch.FundingVout)))
+	buf.Write(binary.AppendUvarint(nil, uint64(toUnits(ch.Capacity))))
+	buf.Write(binary.AppendUvarint(nil, uint64(toUnits(ch.Fee))))
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// DecodePaymentChannel parses the base64 form produced by Encode
+func DecodePaymentChannel(s string) (*PaymentChannel, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || !bytes.HasPrefix(data, channelMagic) {
+		return nil, errors.New("malformed payment channel")
+	}
+	r := &txReader{r: bytes.NewReader(data[len(channelMagic):])}
+	ch := &PaymentChannel{Channel: script.Channel{Payer: r.bytes(), Payee: r.bytes(), LockTime: r.varint()}}
+	ch.FundingTxID = string(r.bytes())
+	ch.FundingVout = int(r.uvarint())
+	ch.Capacity = fromUnits(int64(r.uvarint()))
+	ch.Fee = fromUnits(int64(r.uvarint()))
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed payment channel: %w", r.err)
+	}
+	if _, ok := script.ExtractPaymentChannel(ch.Contract()); !ok {
+		return nil, ErrNotChannel
+	}
+	return ch, nil
+}
+
+// Encode returns the base64 form of the update the payer sends to the payee
+func (u *ChannelUpdate) Encode() string {
+	var buf bytes.Buffer
+	buf.Write(updateMagic)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(u.ChannelID))))
+	buf.WriteString(u.ChannelID)
+	buf.Write(binary.AppendUvarint(nil, u.Updates))
+	buf.Write(binary.AppendUvarint(nil, uint64(toUnits(u.Paid))))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(u.PayerSig))))
+	buf.Write(u.PayerSig)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// DecodeChannelUpdate parses the base64 form produced by Encode
+func DecodeChannelUpdate(s string) (*ChannelUpdate, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || !bytes.HasPrefix(data, updateMagic) {
+		return nil, errors.New("malformed channel update")
+	}
+	r := &txReader{r: bytes.NewReader(data[len(updateMagic):])}
+	u := &ChannelUpdate{ChannelID: string(r.bytes()), Updates: r.uvarint(), Paid: fromUnits(int64(r.uvarint())), PayerSig: r.bytes()}
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed channel update: %w", r.err)
+	}
+	return u, nil
+}
+
+// Channels holds the payment channels of a node, keyed by channel ID
+type Channels struct {
+	Channels map[string]*PaymentChannel
+	filePath string // Location of channels.dat inside the data directory
+}
+
+// NewChannels loads the payment channels from channels.dat in dataDir
+func NewChannels(dataDir string) (*Channels, error) {
+	channels := &Channels{Channels: make(map[string]*PaymentChannel), filePath: filepath.Join(dataDir, channelFile)}
+	if _, err := os.Stat(channels.filePath); os.IsNotExist(err) {
+		return channels, nil
+	}
+	file, err := os.Open(channels.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := gob.NewDecoder(file).Decode(channels); err != nil {
+		return nil, fmt.Errorf("failed to load payment channels: %w", err)
+	}
+	return channels, nil
+}
+
+// SaveToFile saves the payment channels to channels.dat
+func (cs *Channels) SaveToFile() {
+	file, err := os.Create(cs.filePath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+
+	if err := gob.NewEncoder(file).Encode(cs); err != nil {
+		log.Panic(err)
+	}
+}
+
+// Add stores a channel under its ID
+func (cs *Channels) Add(ch *PaymentChannel) {
+	cs.Channels[ch.ID()] = ch
+}
+
+// Get returns the channel with the given ID
+func (cs *Channels) Get(id string) (*PaymentChannel, error) {
+	ch, ok := cs.Channels[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, id)
+	}
+	return ch, nil
+}
+
+// List returns the channels ordered by ID
+func (cs *Channels) List() []*PaymentChannel {
+	list := make([]*PaymentChannel, 0, len(cs.Channels))
+	for _, ch := range cs.Channels {
+		list = append(list, ch)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID() < list[j].ID() })
+	return list
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"aztecs/crypto"
+)
+
+// testChannel is a payment channel as seen by both of its parties
+type testChannel struct {
+	bc           *Blockchain
+	payerWallets *crypto.Wallets
+	payer, payee *crypto.Wallet
+	payerSide    *PaymentChannel
+	payeeSide    *PaymentChannel
+	miner        []byte
+}
+
+// openTestChannel funds a channel of capacity coins refunding at lockTime
+// blocks past the funding block, and hands its terms to the payee
+func openTestChannel(t *testing.T, capacity float64, lockTime int64) *testChannel {
+	t.Helper()
+	bc := newTestChain(t)
+	payerWallets, payeeWallets := newTestWallets(t), newTestWallets(t)
+	payerAddress, payerHash := newTestAddress(t, payerWallets)
+	payeeAddress, _ := newTestAddress(t, payeeWallets)
+	_, miner := newTestAddress(t, newTestWallets(t))
+	mineBlock(t, bc, payerHash)
+
+	payer, err := payerWallets.GetWallet(payerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payee, err := payeeWallets.GetWallet(payeeAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, funding, err := NewTxBuilder(bc, payerWallets, nil).OpenChannel(payerAddress, payee.PublicKey, capacity, bc.Height()+1+lockTime, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, bc, miner, funding)
+
+	payeeSide, err := DecodePaymentChannel(ch.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.CheckChannelFunding(payeeSide); err != nil {
+		t.Fatal(err)
+	}
+	return &testChannel{bc: bc, payerWallets: payerWallets, payer: payer, payee: payee, payerSide: ch, payeeSide: payeeSide, miner: miner}
+}
+
+// balances returns what the payer and payee keys hold on the chain
+func (tc *testChannel) balances() (int64, int64) {
+	return toUnits(tc.bc.GetBalance(crypto.PublicKeyHash(tc.payer.PublicKey))),
+		toUnits(tc.bc.GetBalance(crypto.PublicKeyHash(tc.payee.PublicKey)))
+}
+
+func TestChannelPayments(t *testing.T) {
+	const (
+		payments = 3000
+		amount   = 0.001
+	)
+	tc := openTestChannel(t, 10, 100)
+
+	for i := 0; i < payments; i++ {
+		u, err := tc.payerSide.Pay(amount, tc.payer)
+		if err != nil {
+			t.Fatalf("payment %d: %v", i, err)
+		}
+		// Updates reach the payee in their encoded form
+		received, err := DecodeChannelUpdate(u.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tc.payeeSide.Receive(received, tc.payee)
+		if err != nil {
+			t.Fatalf("payment %d: %v", i, err)
+		}
+		if toUnits(got) != toUnits(amount) {
+			t.Fatalf("payment %d received %.8f, want %.8f", i, got, amount)
+		}
+	}
+	paid := toUnits(amount) * payments
+	if toUnits(tc.payeeSide.Paid) != paid || tc.payeeSide.Updates != payments {
+		t.Fatalf("payee has %.8f in %d updates, want %.8f in %d", tc.payeeSide.Paid, tc.payeeSide.Updates, fromUnits(paid), payments)
+	}
+
+	if _, err := tc.payerSide.CloseTransaction(); err == nil {
+		t.Error("payer closed the channel without the payee signature")
+	}
+	closing, err := tc.payeeSide.CloseTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, tc.bc, tc.miner, closing)
+
+	payer, payee := tc.balances()
+	if payee != paid {
+		t.Errorf("payee holds %.8f, want %.8f", fromUnits(payee), fromUnits(paid))
+	}
+	if want := toUnits(tc.payerSide.Capacity) - toUnits(tc.payerSide.Fee) - paid; payer != want {
+		t.Errorf("payer holds %.8f, want %.8f", fromUnits(payer), fromUnits(want))
+	}
+
+	// A settled channel cannot be refunded
+	for tc.bc.Height() < tc.payerSide.LockTime {
+		mineBlock(t, tc.bc, tc.miner)
+	}
+	if _, err := NewTxBuilder(tc.bc, tc.payerWallets, nil).RefundChannel(tc.payerSide, DefaultFeeRate); !errors.Is(err, ErrNoContractCoins) {
+		t.Errorf("refund of a settled channel: error %v, want ErrNoContractCoins", err)
+	}
+}
+
+func TestChannelRejectsBadUpdates(t *testing.T) {
+	tc := openTestChannel(t, 10, 100)
+	pay := func(amount float64) *ChannelUpdate {
+		t.Helper()
+		u, err := tc.payerSide.Pay(amount, tc.payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	receive := func(u *ChannelUpdate) error {
+		_, err := tc.payeeSide.Receive(u, tc.payee)
+		return err
+	}
+
+	first, second := pay(1), pay(1)
+	if err := receive(second); !errors.Is(err, ErrInvalidUpdate) {
+		t.Fatalf("update received out of order: error %v, want ErrInvalidUpdate", err)
+	}
+	if err := receive(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := receive(first); !errors.Is(err, ErrInvalidUpdate) {
+		t.Fatalf("replayed update: error %v, want ErrInvalidUpdate", err)
+	}
+	if err := receive(second); err != nil {
+		t.Fatal(err)
+	}
+
+	third := pay(1)
+	tests := []struct {
+		name   string
+		update ChannelUpdate
+	}{
+		{"same amount", ChannelUpdate{ChannelID: third.ChannelID, Updates: third.Updates, Paid: 2, PayerSig: second.PayerSig}},
+		{"lower amount", ChannelUpdate{ChannelID: third.ChannelID, Updates: third.Updates, Paid: 1, PayerSig: first.PayerSig}},
+		{"amount not signed", ChannelUpdate{ChannelID: third.ChannelID, Updates: third.Updates, Paid: 4, PayerSig: third.PayerSig}},
+		{"skipped sequence", ChannelUpdate{ChannelID: third.ChannelID, Updates: third.Updates + 1, Paid: third.Paid, PayerSig: third.PayerSig}},
+		{"other channel", ChannelUpdate{ChannelID: outpoint(third.ChannelID, 1), Updates: third.Updates, Paid: third.Paid, PayerSig: third.PayerSig}},
+	}
+	for _, tt := range tests {
+		if err := receive(&tt.update); !errors.Is(err, ErrInvalidUpdate) {
+			t.Errorf("%s: error %v, want ErrInvalidUpdate", tt.name, err)
+		}
+	}
+	if toUnits(tc.payeeSide.Paid) != toUnits(2) || tc.payeeSide.Updates != 2 {
+		t.Fatalf("rejected updates changed the payee state to %.8f in %d updates", tc.payeeSide.Paid, tc.payeeSide.Updates)
+	}
+	if err := receive(third); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tc.payerSide.Pay(10, tc.payer); !errors.Is(err, ErrChannelCapacity) {
+		t.Errorf("payment over the capacity: error %v, want ErrChannelCapacity", err)
+	}
+	if _, err := tc.payerSide.Pay(1, tc.payee); err == nil {
+		t.Error("payee key signed a payment")
+	}
+}
+
+func TestChannelRefund(t *testing.T) {
+	const lockTime = 3
+	tc := openTestChannel(t, 10, lockTime)
+	u, err := tc.payerSide.Pay(4, tc.payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.payeeSide.Receive(u, tc.payee); err != nil {
+		t.Fatal(err)
+	}
+	builder := NewTxBuilder(tc.bc, tc.payerWallets, nil)
+
+	for i := 0; i < lockTime-1; i++ {
+		if _, err := builder.RefundChannel(tc.payerSide, DefaultFeeRate); !errors.Is(err, ErrNonFinal) {
+			t.Fatalf("refund at height %d before lock time %d: error %v, want ErrNonFinal", tc.bc.Height()+1, tc.payerSide.LockTime, err)
+		}
+		mineBlock(t, tc.bc, tc.miner)
+	}
+	refund, err := builder.RefundChannel(tc.payerSide, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, tc.bc, tc.miner, refund)
+	if tc.bc.Height() != tc.payerSide.LockTime {
+		t.Fatalf("refund mined at height %d, lock time %d", tc.bc.Height(), tc.payerSide.LockTime)
+	}
+
+	payer, payee := tc.balances()
+	if payer != toUnits(refund.Vout[0].Value) || payer <= toUnits(10-0.01) || payee != 0 {
+		t.Errorf("after the refund the payer holds %.8f and the payee %.8f", fromUnits(payer), fromUnits(payee))
+	}
+
+	// The payee's commitment spends the refunded output
+	closing, err := tc.payeeSide.CloseTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, err := nextBlock(tc.bc, tc.miner, closing); err == nil {
+		if err := tc.bc.AppendBlock(block); err == nil {
+			t.Error("commitment accepted after the refund")
+		}
+	}
+}
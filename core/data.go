@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"aztecs/core/script"
+)
+
+// ErrInvalidDataOutput is returned for unspendable outputs that are not
+// standard data carriers
+var ErrInvalidDataOutput = errors.New("invalid data output")
+
+// CheckDataOutputs checks that every unspendable output of tx is an
+// OP_RETURN data carrier within script.MaxDataCarrierSize holding no coins
+func (tx *Transaction) CheckDataOutputs() error {
+	for i, vout := range tx.Vout {
+		if !script.IsUnspendable(vout.Script) {
+			continue
+		}
+		if script.Classify(vout.Script) != script.NullDataTy {
+			return fmt.Errorf("%w: output %d of %s is not OP_RETURN with at most %d bytes of data",
+				ErrInvalidDataOutput, i, tx.ID, script.MaxDataCarrierSize)
+		}
+		if vout.Value != 0 {
+			return fmt.Errorf("%w: output %d of %s burns %.8f coins", ErrInvalidDataOutput, i, tx.ID, vout.Value)
+		}
+	}
+	return nil
+}
+
+// PublishData builds a signed transaction embedding data in an OP_RETURN
+// output. The wallet at address from pays the fee and gets the change,
+// whose index is returned with the transaction.
+func (b *TxBuilder) PublishData(from string, data []byte, feeRate float64) (*Transaction, int, error) {
+	if len(data) == 0 {
+		return nil, -1, errors.New("data must not be empty")
+	}
+	dataScript, err := script.NullData(data)
+	if err != nil {
+		return nil, -1, err
+	}
+	wallet, err := b.wallets.GetWallet(from)
+	if err != nil {
+		return nil, -1, err
+	}
+	tx := &Transaction{LockTime: b.lockTime, Vout: []TxOutput{{Script: dataScript}}}
+	return b.fundTransaction(wallet, tx, nil, len(dataScript), feeRate)
+}
+
+// DataEntry is a data output found on the chain
+type DataEntry struct {
+	Data   []byte
+	TxID   string
+	Index  int // Output index within the transaction
+	Height int64
+}
+
+// dataIndex holds the data outputs of the chain sorted by data, so the
+// entries sharing a prefix form one contiguous run
+type dataIndex struct {
+	entries []DataEntry
+}
+
+// add indexes the data outputs of block
+func (idx *dataIndex) add(block *Block) {
+	for _, tx := range block.Transactions {
+		for i, vout := range tx.Vout {
+			data, ok := script.ExtractNullData(vout.Script)
+			if !ok || len(data) == 0 {
+				continue
+			}
+			entry := DataEntry{Data: data, TxID: tx.ID, Index: i, Height: block.Index}
+			// Blocks are added in order, so equal data stays oldest first
+			at := sort.Search(len(idx.entries), func(j int) bool {
+				return bytes.Compare(idx.entries[j].Data, data) > 0
+			})
+			idx.entries = append(idx.entries, DataEntry{})
+			copy(idx.entries[at+1:], idx.entries[at:])
+			idx.entries[at] = entry
+		}
+	}
+}
+
+// find returns the entries whose data starts with prefix, oldest first
+func (idx *dataIndex) find(prefix []byte) []DataEntry {
+	start := sort.Search(len(idx.entries), func(i int) bool {
+		return bytes.Compare(idx.entries[i].Data, prefix) >= 0
+	})
+	found := []DataEntry{}
+	for _, entry := range idx.entries[start:] {
+		if !bytes.HasPrefix(entry.Data, prefix) {
+			break
+		}
+		found = append(found, entry)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Height != found[j].Height {
+			return found[i].Height < found[j].Height
+		}
+		return found[i].TxID < found[j].TxID
+	})
+	return found
+}
+
+// FindData returns the data outputs on the chain whose data starts with
+// prefix, oldest first. The index is built from the blocks on first use
+// and kept up to date as blocks are added.
+func (bc *Blockchain) FindData(prefix []byte) []DataEntry {
+	if bc.dataIndex == nil {
+		bc.dataIndex = &dataIndex{}
+		for _, block := range bc.Blocks {
+			bc.dataIndex.add(block)
+		}
+	}
+	return bc.dataIndex.find(prefix)
+}
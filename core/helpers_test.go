@@ -0,0 +1,86 @@
+package core
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"aztecs/crypto"
+	"aztecs/params"
+)
+
+func TestMain(m *testing.M) {
+	if err := params.SetActive("regtest"); err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestChain creates a regtest chain in a temporary directory
+func newTestChain(t *testing.T) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+// newTestWallets creates an empty wallet file in a temporary directory
+func newTestWallets(t *testing.T) *crypto.Wallets {
+	t.Helper()
+	wallets, err := crypto.NewWallets(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallets
+}
+
+// newTestAddress adds a key to wallets and returns its address and public key hash
+func newTestAddress(t *testing.T, wallets *crypto.Wallets) (string, []byte) {
+	t.Helper()
+	address, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyHash, err := crypto.DecodeKeyAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return address, pubKeyHash
+}
+
+// mineBlock appends a block holding txs to bc, with a coinbase paying the
+// subsidy and their fees to pubKeyHash. Blocks are not mined, AppendBlock
+// checks their transactions but not their proof of work.
+func mineBlock(t *testing.T, bc *Blockchain, pubKeyHash []byte, txs ...*Transaction) *Block {
+	t.Helper()
+	block, err := nextBlock(bc, pubKeyHash, txs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AppendBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// nextBlock builds the block mineBlock appends, without appending it
+func nextBlock(bc *Blockchain, pubKeyHash []byte, txs ...*Transaction) (*Block, error) {
+	var fees float64
+	for _, tx := range txs {
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			return nil, err
+		}
+		fees += fee
+	}
+	tip := bc.Blocks[len(bc.Blocks)-1]
+	coinbase := NewCoinbaseTXWithFees(pubKeyHash, "", tip.Index+1, fees)
+	block := NewBlock(tip.Index+1, time.Now(), append([]*Transaction{coinbase}, txs...), tip.Hash)
+	block.Hash = block.CalculateHash()
+	return block, nil
+}
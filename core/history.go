@@ -0,0 +1,59 @@
+package core
+
+import "bytes"
+
+// HistoryEntry is the effect of one transaction on an address
+type HistoryEntry struct {
+	TxID     string
+	Height   int64
+	Received float64 // Value of the outputs paying the address
+	Sent     float64 // Value of the address's outputs spent by the transaction
+}
+
+// History lists the transactions touching pubKeyHash from block fromHeight
+// on, oldest first. Outputs created below fromHeight are ignored, including
+// when they are spent later, so the entries always add up to the balance.
+func (bc *Blockchain) History(pubKeyHash []byte, fromHeight int64) []HistoryEntry {
+	owned := make(map[string]float64) // Outpoint -> value of counted outputs
+	history := []HistoryEntry{}
+	for _, block := range bc.Blocks {
+		if block.Index < fromHeight {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			entry := HistoryEntry{TxID: tx.ID, Height: block.Index}
+			if !tx.IsCoinbase() {
+				for _, vin := range tx.Vin {
+					op := outpoint(vin.Txid, vin.Vout)
+					if value, ok := owned[op]; ok {
+						entry.Sent += value
+						delete(owned, op)
+					}
+				}
+			}
+			for i, out := range tx.Vout {
+				if bytes.Equal(out.PubKeyHash, pubKeyHash) {
+					entry.Received += out.Value
+					owned[outpoint(tx.ID, i)] = out.Value
+				}
+			}
+			if entry.Received != 0 || entry.Sent != 0 {
+				history = append(history, entry)
+			}
+		}
+	}
+	return history
+}
+
+// BalanceFrom returns the balance of pubKeyHash counting only outputs created
+// from block fromHeight on
+func (bc *Blockchain) BalanceFrom(pubKeyHash []byte, fromHeight int64) float64 {
+	if fromHeight <= 0 {
+		return bc.GetBalance(pubKeyHash)
+	}
+	balance := 0.0
+	for _, entry := range bc.History(pubKeyHash, fromHeight) {
+		balance += entry.Received - entry.Sent
+	}
+	return fromUnits(toUnits(balance))
+}
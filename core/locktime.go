@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"aztecs/core/script"
+)
+
+// Sequence numbers of inputs. Unless SequenceLockTimeDisabled is set, the low
+// bits of a sequence are a relative lock: the number of blocks the spent
+// output must have been confirmed for. The lock time of a transaction is
+// ignored when every input is SequenceFinal. An input with
+// SequenceReplaceable set, other than SequenceFinal, lets the mempool
+// replace the transaction by one paying more fee.
+const (
+	SequenceFinal            uint32 = 0xffffffff
+	SequenceLockTimeDisabled uint32 = 1 << 31
+	SequenceReplaceable      uint32 = 1 << 30
+	SequenceLockTimeMask     uint32 = 0x0000ffff
+)
+
+// Errors returned for transactions whose time locks have not expired
+var (
+	ErrNonFinal     = errors.New("transaction lock time not reached")
+	ErrSequenceLock = errors.New("input relative lock time not reached")
+)
+
+// lockTimeReached reports whether a block at height with Unix time
+// blockTime is at or past lockTime, a height below 500000000 and a Unix
+// time otherwise
+func lockTimeReached(lockTime, height, blockTime int64) bool {
+	if lockTime < script.LockTimeThreshold {
+		return height >= lockTime
+	}
+	return blockTime >= lockTime
+}
+
+// relativeLock returns the blocks an input with sequence must wait, or false
+// when the sequence carries no relative lock
+func relativeLock(sequence uint32) (int64, bool) {
+	if sequence&SequenceLockTimeDisabled != 0 {
+		return 0, false
+	}
+	return int64(sequence & SequenceLockTimeMask), true
+}
+
+// IsFinal reports whether the lock time of tx allows it in the block at
+// height with the given timestamp
+func (tx *Transaction) IsFinal(height int64, timestamp time.Time) bool {
+	if tx.LockTime == 0 || lockTimeReached(tx.LockTime, height, timestamp.Unix()) {
+		return true
+	}
+	for _, vin := range tx.Vin {
+		if vin.Sequence != SequenceFinal {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckLocks returns an error unless the lock time of tx and the relative
+// lock times of its inputs allow it in the block at height with the given
+// timestamp. Relative locks count from the block that confirmed the spent output.
+func (bc *Blockchain) CheckLocks(tx *Transaction, height int64, timestamp time.Time) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if !tx.IsFinal(height, timestamp) {
+		if tx.LockTime < script.LockTimeThreshold {
+			return fmt.Errorf("%w: %s can be mined from block #%d", ErrNonFinal, tx.ID, tx.LockTime)
+		}
+		return fmt.Errorf("%w: %s can be mined from %s", ErrNonFinal, tx.ID, time.Unix(tx.LockTime, 0).UTC().Format(time.RFC3339))
+	}
+	for i, vin := range tx.Vin {
+		blocks, ok := relativeLock(vin.Sequence)
+		if !ok || blocks == 0 {
+			continue
+		}
+		_, confirmed, err := bc.findTransaction(vin.Txid)
+		if err != nil {
+			return err
+		}
+		if height < confirmed+blocks {
+			return fmt.Errorf("%w: input %d of %s can be mined from block #%d", ErrSequenceLock, i, tx.ID, confirmed+blocks)
+		}
+	}
+	return nil
+}
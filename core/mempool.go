@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mempool holds verified transactions waiting to be mined
+type Mempool struct {
+	mtx    sync.Mutex
+	txs    map[string]*Transaction
+	fees   map[string]float64 // Transaction ID -> fee paid
+	spent  map[string]string  // Outpoint -> ID of the mempool transaction spending it
+	change map[string]int     // Transaction ID -> index of the change output, for transactions built here
+}
+
+// NewMempool creates an empty mempool
+func NewMempool() *Mempool {
+	return &Mempool{
+		txs:    make(map[string]*Transaction),
+		fees:   make(map[string]float64),
+		spent:  make(map[string]string),
+		change: make(map[string]int),
+	}
+}
+
+// outpoint identifies a transaction output as "txid:vout"
+func outpoint(txid string, vout int) string {
+	return fmt.Sprintf("%s:%d", txid, vout)
+}
+
+// Add verifies tx against the chain and adds it to the mempool. It must
+// carry the ID of its contents, unused on the chain and in the mempool, and
+// its inputs must be unspent outputs of the chain. Mempool transactions spending the
+// same outputs are replaced when they signal replace-by-fee and tx pays
+// enough more fee, see checkReplacement.
+func (mp *Mempool) Add(bc *Blockchain, tx *Transaction) error {
+	return mp.AddWithChange(bc, tx, -1)
+}
+
+// AddWithChange is Add for a transaction built by this node, recording
+// change, the index of its change output or -1 for none, so BumpFee knows
+// which output to take the extra fee from
+func (mp *Mempool) AddWithChange(bc *Blockchain, tx *Transaction, change int) error {
+	if tx.IsCoinbase() {
+		return fmt.Errorf("coinbase transaction %s cannot enter the mempool", tx.ID)
+	}
+
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	if err := tx.CheckID(); err != nil {
+		return err
+	}
+	if _, ok := mp.txs[tx.ID]; ok {
+		return fmt.Errorf("%w: %s is already in the mempool", ErrDuplicateTxID, tx.ID)
+	}
+	if err := bc.checkNewID(tx, bc.Height()+1, bc.UTXOSet); err != nil {
+		return err
+	}
+	conflicts := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		if spender, ok := mp.spent[outpoint(vin.Txid, vin.Vout)]; ok {
+			conflicts[spender] = true
+		}
+	}
+	fee, err := bc.TransactionFee(tx)
+	if err != nil {
+		return err
+	}
+	if err := bc.CheckTransaction(tx, bc.Height()+1, time.Now()); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		evicted, err := mp.checkReplacement(tx, fee, conflicts)
+		if err != nil {
+			return err
+		}
+		for _, id := range evicted {
+			mp.remove(id)
+		}
+		log.Printf("Transaction %s replaces %d mempool transactions", tx.ID, len(evicted))
+	}
+
+	mp.txs[tx.ID] = tx
+	mp.fees[tx.ID] = fee
+	if change >= 0 && change < len(tx.Vout) {
+		mp.change[tx.ID] = change
+	}
+	for _, vin := range tx.Vin {
+		mp.spent[outpoint(vin.Txid, vin.Vout)] = tx.ID
+	}
+	return nil
+}
+
+// remove must be called with the lock held
+func (mp *Mempool) remove(id string) {
+	tx, ok := mp.txs[id]
+	if !ok {
+		return
+	}
+	for _, vin := range tx.Vin {
+		delete(mp.spent, outpoint(vin.Txid, vin.Vout))
+	}
+	delete(mp.txs, id)
+	delete(mp.fees, id)
+	delete(mp.change, id)
+}
+
+// RemoveBlock drops the transactions of a mined block and any mempool
+// transactions that conflict with its inputs
+func (mp *Mempool) RemoveBlock(block *Block) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	for _, tx := range block.Transactions {
+		mp.remove(tx.ID)
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, vin := range tx.Vin {
+			if spender, ok := mp.spent[outpoint(vin.Txid, vin.Vout)]; ok {
+				mp.remove(spender)
+			}
+		}
+	}
+}
+
+// Transaction returns the mempool transaction with the given ID
+func (mp *Mempool) Transaction(id string) (*Transaction, error) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	tx, ok := mp.txs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotInMempool, id)
+	}
+	return tx, nil
+}
+
+// Change returns the index of the change output recorded for a mempool
+// transaction by AddWithChange, or -1 when none was recorded
+func (mp *Mempool) Change(id string) int {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	if change, ok := mp.change[id]; ok {
+		return change
+	}
+	return -1
+}
+
+// IsSpent reports whether a mempool transaction spends the output
+func (mp *Mempool) IsSpent(txid string, vout int) bool {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	_, ok := mp.spent[outpoint(txid, vout)]
+	return ok
+}
+
+// Transactions returns the mempool transactions ordered by ID
+func (mp *Mempool) Transactions() []*Transaction {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	txs := make([]*Transaction, 0, len(mp.txs))
+	for _, tx := range mp.txs {
+		txs = append(txs, tx)
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].ID < txs[j].ID })
+	return txs
+}
+
+// Fees returns the total fee paid by the mempool transactions
+func (mp *Mempool) Fees() float64 {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	total := 0.0
+	for _, fee := range mp.fees {
+		total += fee
+	}
+	return total
+}
+
+// Count returns the number of transactions in the mempool
+func (mp *Mempool) Count() int {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	return len(mp.txs)
+}
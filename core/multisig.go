@@ -0,0 +1,204 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// ErrNotMultisig is returned for script addresses whose redeem script is not a multisig
+var ErrNotMultisig = errors.New("address is not a multisig address")
+
+// AddMultisig creates an m-of-n multisig redeem script over keys, stores it in
+// wallets and returns its script address. Keys are hex public keys, or
+// addresses whose public key the wallet knows.
+func AddMultisig(wallets *crypto.Wallets, m int, keys []string) (string, []byte, error) {
+	var pubKeys [][]byte
+	for _, key := range keys {
+		pubKey, ok := wallets.FindPublicKey(key)
+		if !ok {
+			var err error
+			if pubKey, err = hex.DecodeString(key); err != nil {
+				return "", nil, fmt.Errorf("key %q is neither a hex public key nor a wallet address", key)
+			}
+		}
+		if _, err := crypto.KeyTypeOf(pubKey); err != nil {
+			return "", nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	redeemScript, err := script.MultiSig(m, pubKeys)
+	if err != nil {
+		return "", nil, err
+	}
+	return wallets.AddScript(redeemScript), redeemScript, nil
+}
+
+// multisigInputSize estimates the serialized size of an input spending a
+// multisig script hash output once m signatures are in place
+func multisigInputSize(m int, redeemScript []byte) int {
+	const outpointSize = 70 // Txid, index, empty signature and key fields, script length
+	return outpointSize + m*65 + len(redeemScript) + 3
+}
+
+// BuildMultisig creates an unsigned transaction paying recipients from the
+// multisig address from, whose redeem script must be in the wallet. Change
+// goes back to the multisig address. Every input carries an empty signature
+// slot per key of the redeem script, filled by SignMultisig. The index of
+// the change output is returned with the transaction, -1 when there is none.
+func (b *TxBuilder) BuildMultisig(from string, recipients []Recipient, feeRate float64) (*Transaction, int, error) {
+	payment, err := checkPayment(recipients, feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	redeemScript, ok := b.wallets.GetScript(from)
+	if !ok {
+		return nil, -1, fmt.Errorf("%w: %s", crypto.ErrWalletNotFound, from)
+	}
+	m, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok {
+		return nil, -1, fmt.Errorf("%w: %s", ErrNotMultisig, from)
+	}
+	scriptHash := crypto.PublicKeyHash(redeemScript)
+	lockingScript := script.PayToScriptHash(scriptHash)
+	spendable := func(utxo *UTXO) bool {
+		return bytes.Equal(utxo.Script, lockingScript)
+	}
+
+	selected, change, err := b.selectCoins(scriptHash, spendable, multisigInputSize(m, redeemScript), payment, len(recipients), feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	tx := &Transaction{LockTime: b.lockTime}
+	unsigned := script.UnlockScriptHash(make([][]byte, len(pubKeys)), redeemScript)
+	for _, c := range selected {
+		tx.Vin = append(tx.Vin, TxInput{Txid: c.utxo.TxID, Vout: c.utxo.Index, ScriptSig: unsigned, Sequence: b.sequence})
+	}
+	for _, r := range recipients {
+		tx.Vout = append(tx.Vout, r.output())
+	}
+	changeIndex := -1
+	if change > 0 {
+		changeIndex = len(tx.Vout)
+		tx.Vout = append(tx.Vout, NewScriptOutput(fromUnits(change), lockingScript))
+	}
+	tx.SetID()
+	return tx, changeIndex, nil
+}
+
+// MultisigProgress counts the signatures of the multisig inputs of a transaction
+type MultisigProgress struct {
+	Added    int // Signatures added by this call
+	Inputs   int // Inputs spending multisig outputs
+	Complete int // Of those, inputs holding enough signatures
+}
+
+// SignMultisig adds signatures by every key of wallets to the multisig
+// inputs of tx. Keys the wallet does not hold are left to other cosigners.
+// Once an input holds as many signatures as its threshold, its empty slots
+// are dropped and the input is final.
+func (bc *Blockchain) SignMultisig(tx *Transaction, wallets *crypto.Wallets) (MultisigProgress, error) {
+	var progress MultisigProgress
+	prevTXs, err := bc.previousTransactions(tx)
+	if err != nil {
+		return progress, err
+	}
+
+	for i, vin := range tx.Vin {
+		prevTx := prevTXs[vin.Txid]
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return progress, fmt.Errorf("input %d spends missing output %s:%d", i, vin.Txid, vin.Vout)
+		}
+		prevOut := prevTx.Vout[vin.Vout]
+		if script.Classify(prevOut.LockingScript()) != script.ScriptHashTy {
+			continue
+		}
+		progress.Inputs++
+
+		sigs, redeemScript, err := multisigSlots(vin.ScriptSig, prevOut)
+		if err != nil {
+			return progress, fmt.Errorf("input %d: %w", i, err)
+		}
+		m, pubKeys, _ := script.ExtractMultiSig(redeemScript)
+		if len(sigs) == len(pubKeys) {
+			hash := tx.SignatureHash(i, prevOut)
+			for k, pubKey := range pubKeys {
+				if len(sigs[k]) > 0 {
+					continue
+				}
+				wallet, err := wallets.GetWallet(crypto.EncodeAddress(crypto.PublicKeyHash(pubKey), crypto.AddressBase58))
+				if errors.Is(err, crypto.ErrWalletNotFound) || errors.Is(err, crypto.ErrWatchOnly) {
+					continue // Another cosigner's key
+				}
+				if err != nil {
+					return progress, err
+				}
+				if sigs[k], err = wallet.Sign(hash); err != nil {
+					return progress, err
+				}
+				progress.Added++
+			}
+			sigs = finalizeSlots(sigs, m)
+		}
+
+		tx.Vin[i].ScriptSig = script.UnlockScriptHash(sigs, redeemScript)
+		if len(sigs) == m && filledSlots(sigs) == m {
+			progress.Complete++
+		}
+	}
+	return progress, nil
+}
+
+// multisigSlots splits the unlocking script of an input spending the script
+// hash output prevOut into its signatures and multisig redeem script. While
+// signing there is one slot per key, empty where the signature is missing.
+// Final inputs hold exactly the threshold of signatures.
+func multisigSlots(scriptSig []byte, prevOut TxOutput) ([][]byte, []byte, error) {
+	pushes, err := script.PushedData(scriptSig)
+	if err != nil || len(pushes) == 0 {
+		return nil, nil, errors.New("unlocking script does not carry a redeem script")
+	}
+	sigs, redeemScript := pushes[:len(pushes)-1], pushes[len(pushes)-1]
+	if !bytes.Equal(crypto.PublicKeyHash(redeemScript), prevOut.PubKeyHash) {
+		return nil, nil, errors.New("redeem script does not match the spent output")
+	}
+	m, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok {
+		return nil, nil, ErrNotMultisig
+	}
+	if len(sigs) != len(pubKeys) && len(sigs) != m {
+		return nil, nil, fmt.Errorf("unlocking script holds %d signatures for a %d-of-%d multisig", len(sigs), m, len(pubKeys))
+	}
+	return sigs, redeemScript, nil
+}
+
+// finalizeSlots keeps the first m signatures, in key order, once there are m
+func finalizeSlots(sigs [][]byte, m int) [][]byte {
+	if filledSlots(sigs) < m {
+		return sigs
+	}
+	var final [][]byte
+	for _, sig := range sigs {
+		if len(sig) > 0 && len(final) < m {
+			final = append(final, sig)
+		}
+	}
+	return final
+}
+
+// filledSlots counts the signatures present in sigs
+func filledSlots(sigs [][]byte) int {
+	n := 0
+	for _, sig := range sigs {
+		if len(sig) > 0 {
+			n++
+		}
+	}
+	return n
+}
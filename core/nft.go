@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// ErrNotNFT is returned for NFT operations on fungible tokens
+var ErrNotNFT = errors.New("token is not an NFT")
+
+// MintNFT builds a signed transaction minting an NFT for content hashing to
+// contentHash, described by the metadata at uri, and paying it to the wallet
+// at address from. The NFT ID is its token ID.
+func (b *TxBuilder) MintNFT(from, name string, contentHash []byte, uri string, feeRate float64) (*Transaction, int, error) {
+	if contentHash == nil {
+		return nil, -1, fmt.Errorf("%w: content hash is required", ErrInvalidToken)
+	}
+	return b.IssueToken(from, TokenIssuance{Name: name, Supply: 1, Metadata: uri, ContentHash: contentHash}, feeRate)
+}
+
+// NFTOwner is one step of the ownership history of an NFT
+type NFTOwner struct {
+	TxID    string // Transaction that minted or moved the NFT
+	Height  int64
+	Address string // Base58 address holding the NFT, empty once burned
+	Burned  bool
+}
+
+// NFTHistory returns the owners of an NFT from its mint on, oldest first.
+// It follows the output holding the NFT through every transaction spending it.
+func (bc *Blockchain) NFTHistory(id string) ([]NFTOwner, error) {
+	token, err := bc.FindToken(id)
+	if err != nil {
+		return nil, err
+	}
+	if !token.IsNFT() {
+		return nil, fmt.Errorf("%w: %s", ErrNotNFT, id)
+	}
+
+	history := []NFTOwner{}
+	holder := "" // Outpoint holding the NFT
+	for _, block := range bc.Blocks[token.Height:] {
+		for _, tx := range block.Transactions {
+			if holder == "" && tx.ID != token.TxID {
+				continue
+			}
+			if holder != "" && !spendsOutpoint(tx, holder) {
+				continue
+			}
+			for i, out := range tx.Vout {
+				if out.TokenID != id {
+					continue
+				}
+				owner := NFTOwner{TxID: tx.ID, Height: block.Index, Address: outputAddress(out)}
+				if script.IsUnspendable(out.Script) {
+					owner.Burned = true
+					return append(history, owner), nil
+				}
+				history = append(history, owner)
+				holder = outpoint(tx.ID, i)
+			}
+		}
+	}
+	return history, nil
+}
+
+// spendsOutpoint reports whether an input of tx spends op
+func spendsOutpoint(tx *Transaction, op string) bool {
+	if tx.IsCoinbase() {
+		return false
+	}
+	for _, vin := range tx.Vin {
+		if outpoint(vin.Txid, vin.Vout) == op {
+			return true
+		}
+	}
+	return false
+}
+
+// outputAddress returns the base58 address an output pays to, empty for
+// unspendable outputs
+func outputAddress(out TxOutput) string {
+	if script.IsUnspendable(out.Script) {
+		return ""
+	}
+	if script.Classify(out.LockingScript()) == script.ScriptHashTy {
+		return crypto.EncodeScriptAddress(out.PubKeyHash, crypto.AddressBase58)
+	}
+	return crypto.EncodeAddress(out.PubKeyHash, crypto.AddressBase58)
+}
+
+// NFTsOf returns the NFTs held by a public key hash, oldest mint first
+func (bc *Blockchain) NFTsOf(pubKeyHash []byte) []*Token {
+	held := bc.GetTokenBalances(pubKeyHash)
+	nfts := []*Token{}
+	for _, token := range bc.Tokens() {
+		if token.IsNFT() && held[token.ID] > 0 {
+			nfts = append(nfts, token)
+		}
+	}
+	return nfts
+}
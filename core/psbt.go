@@ -0,0 +1,467 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// Errors returned by PSBT operations
+var (
+	ErrPSBTIncomplete = errors.New("partially signed transaction is not complete")
+	ErrPSBTMismatch   = errors.New("partially signed transactions are for different transactions")
+)
+
+// psbtMagic starts every encoded PSBT
+var psbtMagic = []byte("azpsbt\xff")
+
+// Record types of the per-input sections of an encoded PSBT
+const (
+	psbtEnd            = 0 // Ends the records of an input
+	psbtPrevOut        = 1 // Output spent by the input
+	psbtRedeemScript   = 2 // Redeem script of a script hash output
+	psbtPartialSig     = 3 // Key: public key, value: signature
+	psbtDerivation     = 4 // Key: public key, value: HD derivation path
+	psbtFinalScriptSig = 5 // Complete unlocking script
+)
+
+// PSBT is a partially signed transaction: an unsigned transaction together
+// with what signers need to sign it offline and the signatures gathered so far
+type PSBT struct {
+	Tx     *Transaction // Transaction without signatures or unlocking scripts
+	Inputs []PSBTInput  // Signing data of each input of Tx
+}
+
+// PSBTInput holds the signing data of one transaction input
+type PSBTInput struct {
+	PrevOut        *TxOutput         // Output being spent, nil until updated
+	RedeemScript   []byte            // Redeem script when PrevOut pays to a script hash
+	PartialSigs    map[string][]byte // Hex public key -> signature
+	Derivations    map[string]string // Hex public key -> HD derivation path
+	FinalScriptSig []byte            // Unlocking script, set once the input is finalized
+}
+
+// NewPSBT creates a PSBT for tx, dropping any signatures and unlocking
+// scripts. The transaction keeps its ID.
+func NewPSBT(tx *Transaction) (*PSBT, error) {
+	if tx.IsCoinbase() {
+		return nil, errors.New("coinbase transactions have nothing to sign")
+	}
+	unsigned := &Transaction{ID: tx.ID, LockTime: tx.LockTime, Issuance: tx.Issuance}
+	for _, vin := range tx.Vin {
+		unsigned.Vin = append(unsigned.Vin, TxInput{Txid: vin.Txid, Vout: vin.Vout, PubKey: vin.PubKey, Sequence: vin.Sequence})
+	}
+	unsigned.Vout = append(unsigned.Vout, tx.Vout...)
+
+	p := &PSBT{Tx: unsigned}
+	for range unsigned.Vin {
+		p.Inputs = append(p.Inputs, newPSBTInput())
+	}
+	return p, nil
+}
+
+func newPSBTInput() PSBTInput {
+	return PSBTInput{PartialSigs: make(map[string][]byte), Derivations: make(map[string]string)}
+}
+
+// Encode returns the base64 form of the PSBT
+func (p *PSBT) Encode() string {
+	var buf bytes.Buffer
+	writeUvarint := func(v uint64) {
+		buf.Write(binary.AppendUvarint(nil, v))
+	}
+	writeBytes := func(b []byte) {
+		writeUvarint(uint64(len(b)))
+		buf.Write(b)
+	}
+	writeRecord := func(typ uint64, key, value []byte) {
+		writeUvarint(typ)
+		writeBytes(key)
+		writeBytes(value)
+	}
+
+	buf.Write(psbtMagic)
+	writeBytes(p.Tx.Serialize())
+	for _, in := range p.Inputs {
+		if in.PrevOut != nil {
+			writeRecord(psbtPrevOut, nil, encodeOutput(*in.PrevOut))
+		}
+		if in.RedeemScript != nil {
+			writeRecord(psbtRedeemScript, nil, in.RedeemScript)
+		}
+		for _, key := range sortedKeys(in.PartialSigs) {
+			pubKey, _ := hex.DecodeString(key)
+			writeRecord(psbtPartialSig, pubKey, in.PartialSigs[key])
+		}
+		for _, key := range sortedKeys(in.Derivations) {
+			pubKey, _ := hex.DecodeString(key)
+			writeRecord(psbtDerivation, pubKey, []byte(in.Derivations[key]))
+		}
+		if in.FinalScriptSig != nil {
+			writeRecord(psbtFinalScriptSig, nil, in.FinalScriptSig)
+		}
+		writeUvarint(psbtEnd)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// DecodePSBT parses the base64 form produced by Encode
+func DecodePSBT(s string) (*PSBT, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PSBT: %w", err)
+	}
+	if !bytes.HasPrefix(data, psbtMagic) {
+		return nil, errors.New("malformed PSBT: missing magic bytes")
+	}
+	r := &txReader{r: bytes.NewReader(data[len(psbtMagic):])}
+
+	txData := r.bytes()
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed PSBT: %w", r.err)
+	}
+	tx, err := DeserializeTransaction(txData)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPSBT(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		for r.err == nil {
+			typ := r.uvarint()
+			if typ == psbtEnd {
+				break
+			}
+			key, value := r.bytes(), r.bytes()
+			switch typ {
+			case psbtPrevOut:
+				out, err := decodeOutput(value)
+				r.fail(err)
+				in.PrevOut = out
+			case psbtRedeemScript:
+				in.RedeemScript = value
+			case psbtPartialSig:
+				in.PartialSigs[hex.EncodeToString(key)] = value
+			case psbtDerivation:
+				in.Derivations[hex.EncodeToString(key)] = string(value)
+			case psbtFinalScriptSig:
+				in.FinalScriptSig = value
+			default:
+				r.fail(fmt.Errorf("unknown record type %d in input %d", typ, i))
+			}
+		}
+	}
+	if r.err == nil && r.r.Len() > 0 {
+		r.fail(errors.New("trailing data"))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed PSBT: %w", r.err)
+	}
+	return p, nil
+}
+
+// encodeOutput serializes an output the way Serialize writes outputs,
+// with its script inline
+func encodeOutput(out TxOutput) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, math.Float64bits(out.Value))
+	buf = binary.AppendUvarint(buf, uint64(len(out.PubKeyHash)))
+	buf = append(buf, out.PubKeyHash...)
+	buf = binary.AppendUvarint(buf, uint64(len(out.Script)))
+	return append(buf, out.Script...)
+}
+
+// decodeOutput parses an output written by encodeOutput
+func decodeOutput(data []byte) (*TxOutput, error) {
+	r := &txReader{r: bytes.NewReader(data)}
+	out := &TxOutput{Value: math.Float64frombits(r.uint64()), PubKeyHash: r.bytes(), Script: r.bytes()}
+	if r.err == nil && r.r.Len() > 0 {
+		r.fail(errors.New("trailing data"))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("previous output: %w", r.err)
+	}
+	return out, nil
+}
+
+// sortedKeys returns the keys of m in order, so encodings are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UpdatePSBT adds what signers need that the chain and wallets know: the
+// spent outputs, redeem scripts of the wallet's script addresses and the HD
+// derivation paths of the wallet's keys
+func (bc *Blockchain) UpdatePSBT(p *PSBT, wallets *crypto.Wallets) error {
+	for i, vin := range p.Tx.Vin {
+		in := &p.Inputs[i]
+		if in.FinalScriptSig != nil {
+			continue
+		}
+		if in.PrevOut == nil {
+			prevTx, err := bc.FindTransaction(vin.Txid)
+			if err != nil {
+				return err
+			}
+			if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+				return fmt.Errorf("input %d spends missing output %s:%d", i, vin.Txid, vin.Vout)
+			}
+			prevOut := prevTx.Vout[vin.Vout]
+			in.PrevOut = &prevOut
+		}
+
+		lockingScript := in.PrevOut.LockingScript()
+		if in.RedeemScript == nil && script.Classify(lockingScript) == script.ScriptHashTy {
+			address := crypto.EncodeScriptAddress(script.ExtractPubKeyHash(lockingScript), crypto.AddressBase58)
+			if redeemScript, ok := wallets.GetScript(address); ok {
+				in.RedeemScript = redeemScript
+			}
+		}
+		for _, pubKey := range p.signingKeys(i, wallets) {
+			if path, ok := wallets.KeyPath(pubKey); ok {
+				in.Derivations[hex.EncodeToString(pubKey)] = path
+			}
+		}
+	}
+	return nil
+}
+
+// signingKeys returns the public keys that can sign input i. Keys behind a
+// public key hash are only known from the input, the derivation paths or wallets.
+func (p *PSBT) signingKeys(i int, wallets *crypto.Wallets) [][]byte {
+	in := p.Inputs[i]
+	if in.PrevOut == nil {
+		return nil
+	}
+	lockingScript := in.PrevOut.LockingScript()
+	switch script.Classify(lockingScript) {
+	case script.PubKeyTy:
+		pubKey, _ := script.ExtractPubKey(lockingScript)
+		return [][]byte{pubKey}
+	case script.ScriptHashTy:
+		if !bytes.Equal(crypto.PublicKeyHash(in.RedeemScript), script.ExtractPubKeyHash(lockingScript)) {
+			return nil
+		}
+		_, pubKeys, _ := script.ExtractMultiSig(in.RedeemScript)
+		return pubKeys
+	case script.PubKeyHashTy, script.LockedPubKeyHashTy:
+		pubKeyHash := script.ExtractPubKeyHash(lockingScript)
+		candidates := [][]byte{p.Tx.Vin[i].PubKey}
+		for _, key := range sortedKeys(in.Derivations) {
+			pubKey, _ := hex.DecodeString(key)
+			candidates = append(candidates, pubKey)
+		}
+		if wallets != nil {
+			if pubKey, ok := wallets.FindPublicKey(crypto.EncodeAddress(pubKeyHash, crypto.AddressBase58)); ok {
+				candidates = append(candidates, pubKey)
+			}
+		}
+		for _, pubKey := range candidates {
+			if len(pubKey) > 0 && bytes.Equal(crypto.PublicKeyHash(pubKey), pubKeyHash) {
+				return [][]byte{pubKey}
+			}
+		}
+	}
+	return nil
+}
+
+// Sign adds signatures by every key of wallets that can sign an input.
+// It needs no chain, since the updated PSBT carries the spent outputs, and
+// derives HD keys the wallet has not handed out from their derivation paths.
+// It returns the number of signatures added.
+func (p *PSBT) Sign(wallets *crypto.Wallets) (int, error) {
+	added := 0
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.FinalScriptSig != nil || in.PrevOut == nil {
+			continue
+		}
+		hash := p.Tx.SignatureHash(i, *in.PrevOut)
+		for _, pubKey := range p.signingKeys(i, wallets) {
+			key := hex.EncodeToString(pubKey)
+			if _, ok := in.PartialSigs[key]; ok {
+				continue
+			}
+			wallet, err := findSigner(wallets, pubKey, in.Derivations[key])
+			if err != nil {
+				return added, err
+			}
+			if wallet == nil {
+				continue // Another signer's key
+			}
+			sig, err := wallet.Sign(hash)
+			if err != nil {
+				return added, err
+			}
+			in.PartialSigs[key] = sig
+			added++
+		}
+	}
+	return added, nil
+}
+
+// findSigner returns the wallet holding the private key of pubKey, or nil
+// when wallets does not have it
+func findSigner(wallets *crypto.Wallets, pubKey []byte, path string) (*crypto.Wallet, error) {
+	wallet, err := wallets.GetWallet(crypto.EncodeAddress(crypto.PublicKeyHash(pubKey), crypto.AddressBase58))
+	if errors.Is(err, crypto.ErrWalletNotFound) || errors.Is(err, crypto.ErrWatchOnly) {
+		if path == "" {
+			return nil, nil
+		}
+		wallet, err = wallets.DeriveWallet(path, pubKey)
+		if errors.Is(err, crypto.ErrNoHDChain) || errors.Is(err, crypto.ErrWalletNotFound) {
+			return nil, nil
+		}
+	}
+	return wallet, err
+}
+
+// CombinePSBTs merges the signatures and signing data of PSBTs for the same transaction
+func CombinePSBTs(psbts []*PSBT) (*PSBT, error) {
+	if len(psbts) == 0 {
+		return nil, errors.New("nothing to combine")
+	}
+	combined, err := NewPSBT(psbts[0].Tx)
+	if err != nil {
+		return nil, err
+	}
+	txData := combined.Tx.Serialize()
+	for _, p := range psbts {
+		if !bytes.Equal(p.Tx.Serialize(), txData) {
+			return nil, fmt.Errorf("%w: %s and %s", ErrPSBTMismatch, combined.Tx.ID, p.Tx.ID)
+		}
+		for i, in := range p.Inputs {
+			out := &combined.Inputs[i]
+			if out.PrevOut == nil {
+				out.PrevOut = in.PrevOut
+			}
+			if out.RedeemScript == nil {
+				out.RedeemScript = in.RedeemScript
+			}
+			if out.FinalScriptSig == nil {
+				out.FinalScriptSig = in.FinalScriptSig
+			}
+			for key, sig := range in.PartialSigs {
+				out.PartialSigs[key] = sig
+			}
+			for key, path := range in.Derivations {
+				out.Derivations[key] = path
+			}
+		}
+	}
+	return combined, nil
+}
+
+// Finalize builds the unlocking script of every input that has enough valid
+// signatures, dropping the signing data it no longer needs. It reports
+// whether all inputs are final.
+func (p *PSBT) Finalize() bool {
+	complete := true
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.FinalScriptSig == nil && in.PrevOut != nil {
+			in.FinalScriptSig = p.finalScriptSig(i)
+		}
+		if in.FinalScriptSig == nil {
+			complete = false
+			continue
+		}
+		in.PartialSigs = make(map[string][]byte)
+		in.Derivations = make(map[string]string)
+	}
+	return complete
+}
+
+// finalScriptSig returns the unlocking script of input i, or nil while it
+// lacks signatures
+func (p *PSBT) finalScriptSig(i int) []byte {
+	in := p.Inputs[i]
+	hash := p.Tx.SignatureHash(i, *in.PrevOut)
+	validSig := func(pubKey []byte) []byte {
+		sig := in.PartialSigs[hex.EncodeToString(pubKey)]
+		if len(sig) == 0 || !crypto.VerifySignature(pubKey, hash, sig) {
+			return nil
+		}
+		return sig
+	}
+
+	lockingScript := in.PrevOut.LockingScript()
+	switch script.Classify(lockingScript) {
+	case script.PubKeyHashTy, script.LockedPubKeyHashTy:
+		// Any signature by a key hashing to the output's key hash will do
+		pubKeyHash := script.ExtractPubKeyHash(lockingScript)
+		for _, key := range sortedKeys(in.PartialSigs) {
+			pubKey, _ := hex.DecodeString(key)
+			if !bytes.Equal(crypto.PublicKeyHash(pubKey), pubKeyHash) {
+				continue
+			}
+			if sig := validSig(pubKey); sig != nil {
+				return script.UnlockPubKeyHash(sig, pubKey)
+			}
+		}
+	case script.PubKeyTy:
+		pubKey, _ := script.ExtractPubKey(lockingScript)
+		if sig := validSig(pubKey); sig != nil {
+			return script.UnlockPubKey(sig)
+		}
+	case script.ScriptHashTy:
+		pubKeys := p.signingKeys(i, nil)
+		m, _, ok := script.ExtractMultiSig(in.RedeemScript)
+		if !ok {
+			return nil
+		}
+		// Signatures must follow the order of the keys
+		var sigs [][]byte
+		for _, pubKey := range pubKeys {
+			if sig := validSig(pubKey); sig != nil && len(sigs) < m {
+				sigs = append(sigs, sig)
+			}
+		}
+		if len(sigs) == m {
+			return script.UnlockScriptHash(sigs, in.RedeemScript)
+		}
+	}
+	return nil
+}
+
+// Extract returns the signed transaction of a finalized PSBT. Inputs
+// spending to a public key hash get their signature and key in the
+// original fields, so wallets recognize them as before.
+func (p *PSBT) Extract() (*Transaction, error) {
+	tx := &Transaction{ID: p.Tx.ID, Vout: append([]TxOutput{}, p.Tx.Vout...), LockTime: p.Tx.LockTime, Issuance: p.Tx.Issuance}
+	for i, vin := range p.Tx.Vin {
+		in := p.Inputs[i]
+		if in.FinalScriptSig == nil {
+			return nil, fmt.Errorf("%w: input %d is not final", ErrPSBTIncomplete, i)
+		}
+		input := TxInput{Txid: vin.Txid, Vout: vin.Vout, PubKey: vin.PubKey, ScriptSig: in.FinalScriptSig, Sequence: vin.Sequence}
+		if in.PrevOut != nil {
+			switch script.Classify(in.PrevOut.LockingScript()) {
+			case script.PubKeyHashTy, script.LockedPubKeyHashTy:
+				pushes, err := script.PushedData(in.FinalScriptSig)
+				if err != nil || len(pushes) != 2 {
+					return nil, fmt.Errorf("input %d has a malformed unlocking script", i)
+				}
+				input.Signature, input.PubKey, input.ScriptSig = pushes[0], pushes[1], nil
+			}
+		}
+		tx.Vin = append(tx.Vin, input)
+	}
+	return tx, nil
+}
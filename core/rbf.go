@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"aztecs/crypto"
+)
+
+// Errors returned when a transaction cannot replace mempool transactions
+var (
+	ErrNotReplaceable          = errors.New("transaction does not signal replace-by-fee")
+	ErrReplacementFee          = errors.New("replacement does not pay enough fee")
+	ErrTooManyReplacements     = errors.New("replacement would evict too many transactions")
+	ErrNoChangeOutput          = errors.New("transaction has no change output to reduce")
+	ErrTransactionNotInMempool = errors.New("transaction is not in the mempool")
+)
+
+// SignalsReplacement reports whether tx opts in to replace-by-fee: an
+// input has SequenceReplaceable set and is not SequenceFinal
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, vin := range tx.Vin {
+		if vin.Sequence != SequenceFinal && vin.Sequence&SequenceReplaceable != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxReplacementEvictions is the most mempool transactions a replacement
+// may evict, which bounds the work of checking it
+const MaxReplacementEvictions = 100
+
+// feeRateAbove reports whether fee units over size bytes is a higher rate
+// than otherFee units over otherSize bytes
+func feeRateAbove(fee int64, size int, otherFee int64, otherSize int) bool {
+	return fee*int64(otherSize) > otherFee*int64(size)
+}
+
+// checkReplacement returns the mempool transactions tx evicts when it pays
+// fee, or an error unless every conflict signals replace-by-fee and tx pays
+// a higher fee rate than each conflict and more fee than all of them
+// together, and there are at most MaxReplacementEvictions of them. Only the
+// conflicts are evicted: mempool transactions spend confirmed outputs only,
+// so none of them spends an output of another and a replaced transaction
+// never leaves descendants behind. It must be called with the lock held.
+func (mp *Mempool) checkReplacement(tx *Transaction, fee float64, conflicts map[string]bool) ([]string, error) {
+	if len(conflicts) > MaxReplacementEvictions {
+		return nil, fmt.Errorf("%w: %s conflicts with %d mempool transactions, at most %d may be evicted",
+			ErrTooManyReplacements, tx.ID, len(conflicts), MaxReplacementEvictions)
+	}
+	size := len(tx.Serialize())
+	for id := range conflicts {
+		conflict := mp.txs[id]
+		if !conflict.SignalsReplacement() {
+			return nil, fmt.Errorf("%w: mempool transaction %s spends the same outputs as %s", ErrNotReplaceable, id, tx.ID)
+		}
+		if !feeRateAbove(toUnits(fee), size, toUnits(mp.fees[id]), len(conflict.Serialize())) {
+			return nil, fmt.Errorf("%w: fee rate of %s is not above that of %s", ErrReplacementFee, tx.ID, id)
+		}
+	}
+
+	evicted := make([]string, 0, len(conflicts))
+	for id := range conflicts {
+		evicted = append(evicted, id)
+	}
+	sort.Strings(evicted)
+	var evictedFee int64
+	for _, id := range evicted {
+		evictedFee += toUnits(mp.fees[id])
+	}
+	if toUnits(fee) <= evictedFee {
+		return nil, fmt.Errorf("%w: %.8f does not exceed the %.8f paid by the %d evicted transactions",
+			ErrReplacementFee, fee, fromUnits(evictedFee), len(evicted))
+	}
+	return evicted, nil
+}
+
+// BumpFee rebuilds tx, a transaction of the wallet signalling
+// replace-by-fee, to pay feeRate coins per 1000 bytes. The extra fee comes
+// out of output change, the change output recorded by the mempool, which is
+// dropped when left below the dust threshold. The result spends the same
+// inputs and replaces tx in the mempool. BumpFee returns it with the index
+// of its change output, -1 once dropped. Transactions sweeping a swap or
+// channel contract have no change and cannot be bumped.
+func (b *TxBuilder) BumpFee(tx *Transaction, change int, feeRate float64) (*Transaction, int, error) {
+	if !tx.SignalsReplacement() {
+		return nil, -1, fmt.Errorf("%w: %s", ErrNotReplaceable, tx.ID)
+	}
+	if change < 0 || change >= len(tx.Vout) {
+		return nil, -1, fmt.Errorf("%w: %s", ErrNoChangeOutput, tx.ID)
+	}
+	if len(tx.Vin) == 0 {
+		return nil, -1, errors.New("transaction has no inputs")
+	}
+	pubKey := tx.Vin[0].PubKey
+	for _, vin := range tx.Vin {
+		if !bytes.Equal(vin.PubKey, pubKey) {
+			return nil, -1, errors.New("transaction spends coins of several keys")
+		}
+	}
+	wallet, err := b.wallets.GetWallet(crypto.EncodeAddress(crypto.PublicKeyHash(pubKey), crypto.AddressBase58))
+	if err != nil {
+		return nil, -1, err
+	}
+	vout := tx.Vout[change]
+	if len(vout.Script) > 0 || vout.TokenID != "" || !b.wallets.HasAddress(crypto.EncodeAddress(vout.PubKeyHash, crypto.AddressBase58)) {
+		return nil, -1, fmt.Errorf("%w: output %d of %s does not pay the wallet", ErrNoChangeOutput, change, tx.ID)
+	}
+
+	oldFee, err := b.bc.TransactionFee(tx)
+	if err != nil {
+		return nil, -1, err
+	}
+	newFee := feeForSize(feeRate, len(tx.Serialize()))
+	if newFee <= toUnits(oldFee) {
+		return nil, -1, fmt.Errorf("%w: %.8f at the new rate does not exceed the current %.8f", ErrReplacementFee, fromUnits(newFee), oldFee)
+	}
+
+	bumped := &Transaction{LockTime: tx.LockTime, Issuance: tx.Issuance}
+	for _, vin := range tx.Vin {
+		bumped.Vin = append(bumped.Vin, TxInput{Txid: vin.Txid, Vout: vin.Vout, PubKey: vin.PubKey, Sequence: vin.Sequence})
+	}
+	remaining := toUnits(tx.Vout[change].Value) - (newFee - toUnits(oldFee))
+	if remaining < 0 {
+		return nil, -1, &InsufficientFundsError{Available: tx.Vout[change].Value, Required: fromUnits(newFee - toUnits(oldFee))}
+	}
+	bumpedChange := -1
+	for i, vout := range tx.Vout {
+		if i == change {
+			if remaining < toUnits(DustThreshold) {
+				continue
+			}
+			vout.Value = fromUnits(remaining)
+			bumpedChange = len(bumped.Vout)
+		}
+		bumped.Vout = append(bumped.Vout, vout)
+	}
+
+	bumped.SetID()
+	if err := b.bc.SignTransaction(bumped, wallet); err != nil {
+		return nil, -1, err
+	}
+	return bumped, bumpedChange, nil
+}
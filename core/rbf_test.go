@@ -0,0 +1,324 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"aztecs/crypto"
+)
+
+// rbfWallet is a wallet holding coinbase coins on a fresh chain
+type rbfWallet struct {
+	bc      *Blockchain
+	wallets *crypto.Wallets
+	from    string
+	to      string // Address outside the wallet
+}
+
+func newRBFWallet(t *testing.T, coins int) *rbfWallet {
+	t.Helper()
+	w := &rbfWallet{bc: newTestChain(t), wallets: newTestWallets(t)}
+	from, pubKeyHash := newTestAddress(t, w.wallets)
+	w.from = from
+	w.to, _ = newTestAddress(t, newTestWallets(t))
+	for i := 0; i < coins; i++ {
+		mineBlock(t, w.bc, pubKeyHash)
+	}
+	return w
+}
+
+// send builds a payment of amount at feeRate and returns it with the index
+// of its change output. The builder ignores the mempool, so every payment
+// spends the same coins.
+func (w *rbfWallet) send(t *testing.T, amount, feeRate float64, replaceable bool) (*Transaction, int) {
+	t.Helper()
+	recipient, err := NewRecipient(w.to, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewTxBuilder(w.bc, w.wallets, nil)
+	if replaceable {
+		builder.WithSequence(SequenceReplaceable)
+	}
+	tx, change, err := builder.Build(w.from, []Recipient{recipient}, feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx, change
+}
+
+func TestReplacement(t *testing.T) {
+	const rate = DefaultFeeRate
+	tests := []struct {
+		name        string
+		coins       int
+		origAmount  float64
+		origRate    float64
+		replaceable bool
+		replAmount  float64
+		replRate    float64
+		wantErr     error
+	}{
+		{"higher fee rate", 1, 10, rate, true, 10, 2 * rate, nil},
+		{"non-signalling conflict", 1, 10, rate, false, 10, 2 * rate, ErrNotReplaceable},
+		{"lower fee rate", 1, 10, 2 * rate, true, 10, rate, ErrReplacementFee},
+		{"same fee rate", 1, 10, rate, true, 10, rate, ErrReplacementFee},
+		// The replacement spends one of the two coins of the original, at a
+		// higher rate but for less fee in total
+		{"lower absolute fee", 2, 60, rate, true, 10, 1.5 * rate, ErrReplacementFee},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newRBFWallet(t, tt.coins)
+			mp := NewMempool()
+			orig, _ := w.send(t, tt.origAmount, tt.origRate, tt.replaceable)
+			if err := mp.Add(w.bc, orig); err != nil {
+				t.Fatal(err)
+			}
+			repl, _ := w.send(t, tt.replAmount, tt.replRate, true)
+
+			origFee, _ := w.bc.TransactionFee(orig)
+			replFee, _ := w.bc.TransactionFee(repl)
+			if tt.name == "lower absolute fee" &&
+				(toUnits(replFee) >= toUnits(origFee) || !feeRateAbove(toUnits(replFee), repl.Size(), toUnits(origFee), orig.Size())) {
+				t.Fatalf("replacement pays %.8f for %d bytes, original %.8f for %d bytes", replFee, repl.Size(), origFee, orig.Size())
+			}
+
+			err := mp.Add(w.bc, repl)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error %v, want %v", err, tt.wantErr)
+				}
+				if _, err := mp.Transaction(orig.ID); err != nil || mp.Count() != 1 {
+					t.Fatalf("rejected replacement changed the mempool: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := mp.Transaction(orig.ID); !errors.Is(err, ErrTransactionNotInMempool) || mp.Count() != 1 {
+				t.Fatalf("original still in the mempool: %v, %d transactions", err, mp.Count())
+			}
+		})
+	}
+}
+
+func TestReplacementEvictionLimit(t *testing.T) {
+	for _, conflicts := range []int{MaxReplacementEvictions, MaxReplacementEvictions + 1} {
+		w := newRBFWallet(t, conflicts)
+		mp := NewMempool()
+		// A builder aware of the mempool spends a different coin each time
+		builder := NewTxBuilder(w.bc, w.wallets, mp).WithSequence(SequenceReplaceable)
+		recipient, err := NewRecipient(w.to, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < conflicts; i++ {
+			tx, change, err := builder.Build(w.from, []Recipient{recipient}, DefaultFeeRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mp.AddWithChange(w.bc, tx, change); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A payment of all but one coin spends every coin and conflicts with
+		// every mempool transaction
+		balance := toUnits(w.bc.GetBalance(w.bc.Blocks[1].Transactions[0].Vout[0].PubKeyHash))
+		repl, _ := w.send(t, fromUnits(balance-CoinUnits), 2*DefaultFeeRate, true)
+		if len(repl.Vin) != conflicts {
+			t.Fatalf("replacement spends %d coins, want %d", len(repl.Vin), conflicts)
+		}
+		err = mp.Add(w.bc, repl)
+		if conflicts > MaxReplacementEvictions {
+			if !errors.Is(err, ErrTooManyReplacements) || mp.Count() != conflicts {
+				t.Errorf("%d conflicts: error %v with %d mempool transactions, want ErrTooManyReplacements", conflicts, err, mp.Count())
+			}
+			continue
+		}
+		if err != nil || mp.Count() != 1 {
+			t.Errorf("%d conflicts: error %v with %d mempool transactions", conflicts, err, mp.Count())
+		}
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+	w := newRBFWallet(t, 1)
+	mp := NewMempool()
+	tx, change := w.send(t, 10, DefaultFeeRate, true)
+	if change != 1 {
+		t.Fatalf("change output %d, want 1", change)
+	}
+	if err := mp.AddWithChange(w.bc, tx, change); err != nil {
+		t.Fatal(err)
+	}
+	oldFee, _ := w.bc.TransactionFee(tx)
+
+	bumped, change, err := NewTxBuilder(w.bc, w.wallets, mp).BumpFee(tx, mp.Change(tx.ID), 2*DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != 1 || len(bumped.Vout) != 2 || !reflect.DeepEqual(bumped.Vout[0], tx.Vout[0]) {
+		t.Fatalf("bumped outputs %+v, change %d", bumped.Vout, change)
+	}
+	newFee, _ := w.bc.TransactionFee(bumped)
+	if toUnits(newFee) != feeForSize(2*DefaultFeeRate, tx.Size()) {
+		t.Errorf("bumped fee %.8f, want %.8f", newFee, fromUnits(feeForSize(2*DefaultFeeRate, tx.Size())))
+	}
+	if got, want := toUnits(bumped.Vout[1].Value), toUnits(tx.Vout[1].Value)-toUnits(newFee)+toUnits(oldFee); got != want {
+		t.Errorf("change %.8f, want %.8f", fromUnits(got), fromUnits(want))
+	}
+
+	if err := mp.AddWithChange(w.bc, bumped, change); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mp.Transaction(tx.ID); !errors.Is(err, ErrTransactionNotInMempool) {
+		t.Fatalf("original still in the mempool: %v", err)
+	}
+	if mp.Change(bumped.ID) != 1 || mp.Change(tx.ID) != -1 {
+		t.Errorf("recorded change %d for the replacement, %d for the original", mp.Change(bumped.ID), mp.Change(tx.ID))
+	}
+
+	_, pubKeyHash := newTestAddress(t, newTestWallets(t))
+	mineBlock(t, w.bc, pubKeyHash, bumped)
+}
+
+func TestBumpFeeDropsDustChange(t *testing.T) {
+	const changeUnits = 3000
+	w := newRBFWallet(t, 1)
+	mp := NewMempool()
+
+	// Spend the whole coinbase but for changeUnits of change, past the
+	// window in which coin selection leaves out change
+	inputFee := feeForSize(DefaultFeeRate, txInputSize)
+	target := feeForSize(DefaultFeeRate, txOverheadSize+txOutputSize)
+	changeFee := feeForSize(DefaultFeeRate, txOutputSize)
+	payment := toUnits(w.bc.Blocks[1].Transactions[0].Vout[0].Value) - inputFee - target - changeFee - changeUnits
+	tx, change := w.send(t, fromUnits(payment), DefaultFeeRate, true)
+	if change != 1 || len(tx.Vout) != 2 || toUnits(tx.Vout[1].Value) != changeUnits {
+		t.Fatalf("outputs %+v, change %d, want change of %d units", tx.Vout, change, changeUnits)
+	}
+	if err := mp.AddWithChange(w.bc, tx, change); err != nil {
+		t.Fatal(err)
+	}
+	oldFee, _ := w.bc.TransactionFee(tx)
+
+	// A rate leaving 100 units of change, below the dust threshold
+	feeRate := float64(toUnits(oldFee)+changeUnits-100) / CoinUnits * 1000 / float64(tx.Size())
+	bumped, change, err := NewTxBuilder(w.bc, w.wallets, mp).BumpFee(tx, mp.Change(tx.ID), feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != -1 || len(bumped.Vout) != 1 || !reflect.DeepEqual(bumped.Vout[0], tx.Vout[0]) {
+		t.Fatalf("bumped outputs %+v, change %d", bumped.Vout, change)
+	}
+	if newFee, _ := w.bc.TransactionFee(bumped); toUnits(newFee) != toUnits(oldFee)+changeUnits {
+		t.Errorf("bumped fee %.8f, want the old fee and the whole change %.8f", newFee, fromUnits(toUnits(oldFee)+changeUnits))
+	}
+	if err := mp.AddWithChange(w.bc, bumped, change); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without change there is nothing left to bump
+	if _, _, err := NewTxBuilder(w.bc, w.wallets, mp).BumpFee(bumped, mp.Change(bumped.ID), 2*feeRate); !errors.Is(err, ErrNoChangeOutput) {
+		t.Errorf("bump without change: error %v, want ErrNoChangeOutput", err)
+	}
+}
+
+func TestBumpFeeErrors(t *testing.T) {
+	w := newRBFWallet(t, 1)
+	builder := NewTxBuilder(w.bc, w.wallets, nil)
+	tx, _ := w.send(t, 10, DefaultFeeRate, true)
+	unreplaceable, _ := w.send(t, 10, DefaultFeeRate, false)
+
+	tests := []struct {
+		name    string
+		tx      *Transaction
+		change  int
+		feeRate float64
+		wantErr error
+	}{
+		{"not replaceable", unreplaceable, 1, 2 * DefaultFeeRate, ErrNotReplaceable},
+		{"no recorded change", tx, -1, 2 * DefaultFeeRate, ErrNoChangeOutput},
+		{"change out of range", tx, 2, 2 * DefaultFeeRate, ErrNoChangeOutput},
+		{"change paying another wallet", tx, 0, 2 * DefaultFeeRate, ErrNoChangeOutput},
+		{"lower fee rate", tx, 1, DefaultFeeRate / 2, ErrReplacementFee},
+		{"fee above the change", tx, 1, 1000, ErrInsufficientFunds},
+	}
+	for _, tt := range tests {
+		if _, _, err := builder.BumpFee(tt.tx, tt.change, tt.feeRate); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBumpFeeFundedTransactions(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *TxBuilder, from string) (*Transaction, int, error)
+	}{
+		{"data", func(b *TxBuilder, from string) (*Transaction, int, error) {
+			return b.PublishData(from, []byte("hello"), DefaultFeeRate)
+		}},
+		{"token issuance", func(b *TxBuilder, from string) (*Transaction, int, error) {
+			return b.IssueToken(from, TokenIssuance{Name: "Points", Symbol: "PTS", Supply: 1000}, DefaultFeeRate)
+		}},
+		{"nft", func(b *TxBuilder, from string) (*Transaction, int, error) {
+			return b.MintNFT(from, "Art", make([]byte, 32), "", DefaultFeeRate)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newRBFWallet(t, 1)
+			mp := NewMempool()
+			tx, change, err := tt.build(NewTxBuilder(w.bc, w.wallets, mp).WithSequence(SequenceReplaceable), w.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if change != len(tx.Vout)-1 || tx.Vout[change].TokenID != "" || len(tx.Vout[change].Script) > 0 {
+				t.Fatalf("change output %d of %+v", change, tx.Vout)
+			}
+			if err := mp.AddWithChange(w.bc, tx, change); err != nil {
+				t.Fatal(err)
+			}
+			bumped, change, err := NewTxBuilder(w.bc, w.wallets, mp).BumpFee(tx, mp.Change(tx.ID), 2*DefaultFeeRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mp.AddWithChange(w.bc, bumped, change); err != nil {
+				t.Fatal(err)
+			}
+			_, pubKeyHash := newTestAddress(t, newTestWallets(t))
+			mineBlock(t, w.bc, pubKeyHash, bumped)
+		})
+	}
+}
+
+// A contract spend sweeps the contract to one output and has no change
+func TestBumpFeeContractSpend(t *testing.T) {
+	bc := newTestChain(t)
+	wallets := newTestWallets(t)
+	from, pubKeyHash := newTestAddress(t, wallets)
+	to, _ := newTestAddress(t, wallets)
+	mineBlock(t, bc, pubKeyHash)
+	secret, secretHash, err := NewSwapSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := fundSwap(t, bc, wallets, from, to, 10, secretHash, bc.Height()+10, pubKeyHash)
+
+	mp := NewMempool()
+	redeem, err := NewTxBuilder(bc, wallets, mp).WithSequence(SequenceReplaceable).RedeemSwap(contract, secret, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(bc, redeem); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewTxBuilder(bc, wallets, mp).BumpFee(redeem, mp.Change(redeem.ID), 2*DefaultFeeRate); !errors.Is(err, ErrNoChangeOutput) {
+		t.Errorf("bump of a contract spend: error %v, want ErrNoChangeOutput", err)
+	}
+}
@@ -0,0 +1,523 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Checker supplies what a script cannot compute by itself: whether a
+// signature signs the spending transaction, and the spending context for
+// time locks
+type Checker interface {
+	// CheckSig reports whether sig is a valid signature by pubKey over the
+	// signature hash of the input being verified
+	CheckSig(sig, pubKey []byte) bool
+	// CheckLockTime reports whether the spend happens at or after lockTime,
+	// a block height below 500000000 and a Unix time otherwise
+	CheckLockTime(lockTime int64) bool
+	// CheckSequence reports whether the input's sequence number holds a
+	// relative lock of at least blocks, which block validation enforces
+	CheckSequence(blocks int64) bool
+}
+
+// Verify runs the unlocking script of an input followed by the locking script
+// of the output it spends. It succeeds when the final stack top is true.
+// For pay to script hash outputs the last element pushed by the unlocking
+// script is the redeem script, which then runs on the elements before it.
+func Verify(unlocking, locking []byte, checker Checker) error {
+	if !IsPushOnly(unlocking) {
+		return ErrNotPushOnly
+	}
+	vm := &engine{checker: checker}
+	if err := vm.run(unlocking); err != nil {
+		return fmt.Errorf("unlocking script: %w", err)
+	}
+	redeemStack := append([][]byte{}, vm.stack...)
+	if err := vm.run(locking); err != nil {
+		return fmt.Errorf("locking script: %w", err)
+	}
+	if err := vm.result(); err != nil {
+		return err
+	}
+	if Classify(locking) != ScriptHashTy {
+		return nil
+	}
+
+	redeem := redeemStack[len(redeemStack)-1] // Not empty, the hash matched
+	vm.stack = redeemStack[:len(redeemStack)-1]
+	if err := vm.run(redeem); err != nil {
+		return fmt.Errorf("redeem script: %w", err)
+	}
+	return vm.result()
+}
+
+// result checks that a finished evaluation left true on top of the stack
+func (vm *engine) result() error {
+	if len(vm.stack) == 0 || !asBool(vm.stack[len(vm.stack)-1]) {
+		return ErrEvalFalse
+	}
+	return nil
+}
+
+// engine is the state of one evaluation. The stack carries over from the
+// unlocking to the locking script.
+type engine struct {
+	stack   [][]byte
+	checker Checker
+}
+
+// push adds an element to the stack
+func (vm *engine) push(data []byte) error {
+	if len(data) > MaxElementSize {
+		return fmt.Errorf("%w: %d bytes", ErrElementTooLarge, len(data))
+	}
+	if len(vm.stack) >= MaxStackSize {
+		return ErrStackOverflow
+	}
+	vm.stack = append(vm.stack, data)
+	return nil
+}
+
+// pop removes and returns the top element
+func (vm *engine) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	top := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+// peek returns the element depth positions below the top without removing it
+func (vm *engine) peek(depth int) ([]byte, error) {
+	if depth >= len(vm.stack) {
+		return nil, ErrStackUnderflow
+	}
+	return vm.stack[len(vm.stack)-1-depth], nil
+}
+
+// popNum pops a number used in arithmetic
+func (vm *engine) popNum() (int64, error) {
+	data, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNum(data, maxNumSize)
+}
+
+// popBool pops an element as a boolean
+func (vm *engine) popBool() (bool, error) {
+	data, err := vm.pop()
+	if err != nil {
+		return false, err
+	}
+	return asBool(data), nil
+}
+
+// run executes one script on the current stack
+func (vm *engine) run(script []byte) error {
+	ins, err := parse(script)
+	if err != nil {
+		return err
+	}
+
+	// exec holds one entry per open OP_IF, true while its branch runs
+	var exec []bool
+	executing := func() bool {
+		for _, e := range exec {
+			if !e {
+				return false
+			}
+		}
+		return true
+	}
+
+	ops := 0
+	for i, in := range ins {
+		if !isPush(in.op) {
+			if ops++; ops > MaxOpsPerScript {
+				return ErrTooManyOps
+			}
+		}
+		// Every key of a multisig counts as an operation
+		if (in.op == OP_CHECKMULTISIG || in.op == OP_CHECKMULTISIGVERIFY) && i > 0 {
+			if n, err := decodeNum(pushValue(ins[i-1]), maxNumSize); err == nil && n > 0 {
+				if ops += int(n); ops > MaxOpsPerScript {
+					return ErrTooManyOps
+				}
+			}
+		}
+
+		// Conditionals are tracked even inside branches that are skipped
+		switch in.op {
+		case OP_IF, OP_NOTIF:
+			branch := false
+			if executing() {
+				cond, err := vm.popBool()
+				if err != nil {
+					return err
+				}
+				branch = cond == (in.op == OP_IF)
+			}
+			exec = append(exec, branch)
+			continue
+		case OP_ELSE:
+			if len(exec) == 0 {
+				return ErrUnbalancedConditional
+			}
+			exec[len(exec)-1] = !exec[len(exec)-1]
+			continue
+		case OP_ENDIF:
+			if len(exec) == 0 {
+				return ErrUnbalancedConditional
+			}
+			exec = exec[:len(exec)-1]
+			continue
+		}
+		if !executing() {
+			if _, ok := opcodeNames[in.op]; !ok && !isPush(in.op) {
+				return fmt.Errorf("%w: %s", ErrInvalidOpcode, OpcodeName(in.op))
+			}
+			continue
+		}
+		if err := vm.step(in); err != nil {
+			return fmt.Errorf("%s: %w", OpcodeName(in.op), err)
+		}
+	}
+	if len(exec) != 0 {
+		return ErrUnbalancedConditional
+	}
+	return nil
+}
+
+// step executes one instruction outside of the conditional opcodes
+func (vm *engine) step(in instruction) error {
+	if isPush(in.op) {
+		return vm.push(pushValue(in))
+	}
+
+	switch in.op {
+	case OP_NOP:
+		return nil
+	case OP_VERIFY:
+		ok, err := vm.popBool()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrVerifyFailed
+		}
+		return nil
+	case OP_RETURN:
+		return ErrEarlyReturn
+
+	case OP_2DROP:
+		if len(vm.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		vm.stack = vm.stack[:len(vm.stack)-2]
+		return nil
+	case OP_2DUP:
+		a, err := vm.peek(1)
+		if err != nil {
+			return err
+		}
+		b, _ := vm.peek(0)
+		if err := vm.push(a); err != nil {
+			return err
+		}
+		return vm.push(b)
+	case OP_DEPTH:
+		return vm.push(encodeNum(int64(len(vm.stack))))
+	case OP_DROP:
+		_, err := vm.pop()
+		return err
+	case OP_DUP:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		return vm.push(top)
+	case OP_NIP:
+		if len(vm.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		vm.stack = append(vm.stack[:len(vm.stack)-2], vm.stack[len(vm.stack)-1])
+		return nil
+	case OP_OVER:
+		second, err := vm.peek(1)
+		if err != nil {
+			return err
+		}
+		return vm.push(second)
+	case OP_SWAP:
+		if len(vm.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		n := len(vm.stack)
+		vm.stack[n-1], vm.stack[n-2] = vm.stack[n-2], vm.stack[n-1]
+		return nil
+	case OP_SIZE:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		return vm.push(encodeNum(int64(len(top))))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if in.op == OP_EQUALVERIFY {
+			if !equal {
+				return ErrVerifyFailed
+			}
+			return nil
+		}
+		return vm.push(fromBool(equal))
+
+	case OP_1ADD, OP_1SUB, OP_NEGATE, OP_ABS, OP_NOT, OP_0NOTEQUAL:
+		n, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		return vm.push(unaryOp(in.op, n))
+	case OP_ADD, OP_SUB, OP_BOOLAND, OP_BOOLOR, OP_NUMEQUAL, OP_NUMEQUALVERIFY, OP_NUMNOTEQUAL,
+		OP_LESSTHAN, OP_GREATERTHAN, OP_LESSTHANOREQUAL, OP_GREATERTHANOREQUAL, OP_MIN, OP_MAX:
+		b, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		if in.op == OP_NUMEQUALVERIFY {
+			if a != b {
+				return ErrVerifyFailed
+			}
+			return nil
+		}
+		return vm.push(binaryOp(in.op, a, b))
+	case OP_WITHIN:
+		max, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		min, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		x, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		return vm.push(fromBool(min <= x && x < max))
+
+	case OP_RIPEMD160, OP_SHA256, OP_HASH160, OP_HASH256:
+		data, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.push(hashOp(in.op, data))
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		valid := len(sig) > 0 && vm.checker.CheckSig(sig, pubKey)
+		if in.op == OP_CHECKSIGVERIFY {
+			if !valid {
+				return ErrVerifyFailed
+			}
+			return nil
+		}
+		return vm.push(fromBool(valid))
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		valid, err := vm.checkMultiSig()
+		if err != nil {
+			return err
+		}
+		if in.op == OP_CHECKMULTISIGVERIFY {
+			if !valid {
+				return ErrVerifyFailed
+			}
+			return nil
+		}
+		return vm.push(fromBool(valid))
+
+	case OP_CHECKLOCKTIMEVERIFY:
+		// The operand stays on the stack, so scripts follow it with OP_DROP
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		lockTime, err := decodeNum(top, maxLockTimeSize)
+		if err != nil {
+			return err
+		}
+		if lockTime < 0 {
+			return ErrNegativeLockTime
+		}
+		if !vm.checker.CheckLockTime(lockTime) {
+			return fmt.Errorf("%w: %d", ErrUnsatisfiedLockTime, lockTime)
+		}
+		return nil
+
+	case OP_CHECKSEQUENCEVERIFY:
+		// Like OP_CHECKLOCKTIMEVERIFY the operand stays on the stack
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		blocks, err := decodeNum(top, maxLockTimeSize)
+		if err != nil {
+			return err
+		}
+		if blocks < 0 {
+			return ErrNegativeLockTime
+		}
+		if !vm.checker.CheckSequence(blocks) {
+			return fmt.Errorf("%w: %d blocks", ErrUnsatisfiedSequence, blocks)
+		}
+		return nil
+	}
+	return ErrInvalidOpcode
+}
+
+// checkMultiSig pops the operands of OP_CHECKMULTISIG and reports whether
+// every signature matches one of the keys. Signatures must be in the order of
+// their keys, so each key is tried at most once.
+func (vm *engine) checkMultiSig() (bool, error) {
+	n, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if n < 1 || n > MaxMultiSigKeys {
+		return false, fmt.Errorf("%w: %d", ErrInvalidKeyCount, n)
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+	m, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if m < 1 || m > n {
+		return false, fmt.Errorf("%w: %d of %d", ErrInvalidSigCount, m, n)
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	k := 0
+	for _, sig := range sigs {
+		for ; k < len(pubKeys); k++ {
+			if len(sig) > 0 && vm.checker.CheckSig(sig, pubKeys[k]) {
+				break
+			}
+		}
+		if k == len(pubKeys) {
+			return false, nil
+		}
+		k++
+	}
+	return true, nil
+}
+
+// unaryOp applies a one operand arithmetic opcode
+func unaryOp(op byte, n int64) []byte {
+	switch op {
+	case OP_1ADD:
+		n++
+	case OP_1SUB:
+		n--
+	case OP_NEGATE:
+		n = -n
+	case OP_ABS:
+		if n < 0 {
+			n = -n
+		}
+	case OP_NOT:
+		return fromBool(n == 0)
+	case OP_0NOTEQUAL:
+		return fromBool(n != 0)
+	}
+	return encodeNum(n)
+}
+
+// binaryOp applies a two operand arithmetic opcode to a and b, where b was on top
+func binaryOp(op byte, a, b int64) []byte {
+	switch op {
+	case OP_ADD:
+		return encodeNum(a + b)
+	case OP_SUB:
+		return encodeNum(a - b)
+	case OP_BOOLAND:
+		return fromBool(a != 0 && b != 0)
+	case OP_BOOLOR:
+		return fromBool(a != 0 || b != 0)
+	case OP_NUMEQUAL:
+		return fromBool(a == b)
+	case OP_NUMNOTEQUAL:
+		return fromBool(a != b)
+	case OP_LESSTHAN:
+		return fromBool(a < b)
+	case OP_GREATERTHAN:
+		return fromBool(a > b)
+	case OP_LESSTHANOREQUAL:
+		return fromBool(a <= b)
+	case OP_GREATERTHANOREQUAL:
+		return fromBool(a >= b)
+	case OP_MIN:
+		return encodeNum(min(a, b))
+	default: // OP_MAX
+		return encodeNum(max(a, b))
+	}
+}
+
+// hashOp applies a hashing opcode
+func hashOp(op byte, data []byte) []byte {
+	switch op {
+	case OP_RIPEMD160:
+		h := ripemd160.New()
+		h.Write(data)
+		return h.Sum(nil)
+	case OP_SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case OP_HASH160:
+		return Hash160(data)
+	default: // OP_HASH256
+		first := sha256.Sum256(data)
+		second := sha256.Sum256(first[:])
+		return second[:]
+	}
+}
+
+// Hash160 is RIPEMD-160 of SHA-256, the hash behind addresses
+func Hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
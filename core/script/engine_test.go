@@ -0,0 +1,443 @@
+package script
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testChecker accepts the signature fakeSig(pubKey) for every key, and
+// treats lockTime and sequence as the spending context
+type testChecker struct {
+	lockTime int64
+	sequence int64
+}
+
+func (c testChecker) CheckSig(sig, pubKey []byte) bool  { return bytes.Equal(sig, fakeSig(pubKey)) }
+func (c testChecker) CheckLockTime(lockTime int64) bool { return lockTime <= c.lockTime }
+func (c testChecker) CheckSequence(blocks int64) bool   { return blocks <= c.sequence }
+
+func fakeSig(pubKey []byte) []byte {
+	return append([]byte("sig"), pubKey...)
+}
+
+// testKey returns a 33 byte stand-in for a compressed public key
+func testKey(i byte) []byte {
+	return bytes.Repeat([]byte{i}, 33)
+}
+
+var (
+	key1, key2, key3 = hex.EncodeToString(testKey(1)), hex.EncodeToString(testKey(2)), hex.EncodeToString(testKey(3))
+	sig1, sig2, sig3 = hex.EncodeToString(fakeSig(testKey(1))), hex.EncodeToString(fakeSig(testKey(2))), hex.EncodeToString(fakeSig(testKey(3)))
+)
+
+func mustAssemble(t *testing.T, asm string) []byte {
+	t.Helper()
+	script, err := Assemble(asm)
+	if err != nil {
+		t.Fatalf("assemble %q: %v", asm, err)
+	}
+	return script
+}
+
+// eval runs script on an empty stack and checks it leaves true on top
+func eval(script []byte, checker Checker) error {
+	vm := &engine{checker: checker}
+	if err := vm.run(script); err != nil {
+		return err
+	}
+	return vm.result()
+}
+
+// engineTests run with testChecker{lockTime: 100, sequence: 10}. A nil
+// wantErr means the script must succeed.
+var engineTests = []struct {
+	name    string
+	asm     string
+	wantErr error
+}{
+	// Pushes
+	{"small number", "OP_16", nil},
+	{"zero is false", "0", ErrEvalFalse},
+	{"negative one", "OP_1NEGATE", nil},
+	{"negative zero is false", "80", ErrEvalFalse},
+	{"data push", "0102", nil},
+	{"empty script", "", ErrEvalFalse},
+
+	// Flow control
+	{"nop", "OP_1 OP_NOP", nil},
+	{"if true branch", "OP_1 OP_IF OP_1 OP_ELSE 0 OP_ENDIF", nil},
+	{"if false branch", "0 OP_IF 0 OP_ELSE OP_1 OP_ENDIF", nil},
+	{"if without else", "0 OP_IF 0 OP_ENDIF OP_1", nil},
+	{"notif true", "0 OP_NOTIF OP_1 OP_ELSE 0 OP_ENDIF", nil},
+	{"notif false", "OP_1 OP_NOTIF 0 OP_ELSE OP_1 OP_ENDIF", nil},
+	{"nested if", "OP_1 OP_IF 0 OP_IF 0 OP_ELSE OP_1 OP_ENDIF OP_ELSE 0 OP_ENDIF", nil},
+	{"nested in skipped branch", "0 OP_IF OP_1 OP_IF 0 OP_ENDIF 0 OP_ELSE OP_1 OP_ENDIF", nil},
+	{"deep nesting", "OP_1 OP_IF OP_1 OP_IF OP_1 OP_IF OP_1 OP_IF OP_1 OP_ENDIF OP_ENDIF OP_ENDIF OP_ENDIF", nil},
+	{"else toggles twice", "OP_1 OP_IF 0 OP_ELSE OP_1 OP_ELSE 0 OP_ENDIF", ErrEvalFalse},
+	{"skipped branch does not run", "0 OP_IF OP_RETURN OP_ENDIF OP_1", nil},
+	{"if without endif", "OP_1 OP_IF OP_1", ErrUnbalancedConditional},
+	{"nested if without endif", "OP_1 OP_IF OP_1 OP_IF OP_1 OP_ENDIF", ErrUnbalancedConditional},
+	{"else without if", "OP_1 OP_ELSE", ErrUnbalancedConditional},
+	{"endif without if", "OP_1 OP_ENDIF", ErrUnbalancedConditional},
+	{"endif before if", "OP_1 OP_ENDIF OP_IF", ErrUnbalancedConditional},
+	{"if on empty stack", "OP_IF OP_ENDIF", ErrStackUnderflow},
+	{"notif on empty stack", "OP_NOTIF OP_ENDIF", ErrStackUnderflow},
+	{"verify true", "OP_1 OP_VERIFY OP_1", nil},
+	{"verify false", "0 OP_VERIFY OP_1", ErrVerifyFailed},
+	{"verify empty", "OP_VERIFY", ErrStackUnderflow},
+	{"return", "OP_1 OP_RETURN", ErrEarlyReturn},
+
+	// Stack
+	{"2drop", "OP_1 0 0 OP_2DROP", nil},
+	{"2drop underflow", "OP_1 OP_2DROP", ErrStackUnderflow},
+	{"2dup", "OP_1 OP_2 OP_2DUP OP_2 OP_EQUALVERIFY OP_1 OP_EQUALVERIFY OP_2 OP_EQUALVERIFY OP_1 OP_EQUAL", nil},
+	{"2dup underflow", "OP_1 OP_2DUP", ErrStackUnderflow},
+	{"depth", "OP_1 OP_1 OP_DEPTH OP_2 OP_EQUAL", nil},
+	{"depth of empty stack", "OP_DEPTH", ErrEvalFalse},
+	{"drop", "OP_1 0 OP_DROP", nil},
+	{"drop underflow", "OP_DROP", ErrStackUnderflow},
+	{"dup", "OP_1 OP_DUP OP_EQUAL", nil},
+	{"dup underflow", "OP_DUP", ErrStackUnderflow},
+	{"nip", "0 OP_1 OP_NIP OP_DEPTH OP_1 OP_EQUALVERIFY", nil},
+	{"nip underflow", "OP_1 OP_NIP", ErrStackUnderflow},
+	{"over", "OP_1 0 OP_OVER", nil},
+	{"over underflow", "OP_1 OP_OVER", ErrStackUnderflow},
+	{"swap", "OP_1 0 OP_SWAP", nil},
+	{"swap to false", "0 OP_1 OP_SWAP", ErrEvalFalse},
+	{"swap underflow", "OP_1 OP_SWAP", ErrStackUnderflow},
+	{"size", "0102 OP_SIZE OP_2 OP_EQUAL", nil},
+	{"size of empty element", "0 OP_SIZE 0 OP_EQUAL", nil},
+	{"size underflow", "OP_SIZE", ErrStackUnderflow},
+
+	// Comparison
+	{"equal", "0102 0102 OP_EQUAL", nil},
+	{"not equal", "OP_1 OP_2 OP_EQUAL", ErrEvalFalse},
+	{"equal underflow", "OP_1 OP_EQUAL", ErrStackUnderflow},
+	{"equalverify", "OP_1 OP_1 OP_EQUALVERIFY OP_1", nil},
+	{"equalverify fails", "OP_1 OP_2 OP_EQUALVERIFY OP_1", ErrVerifyFailed},
+
+	// Arithmetic
+	{"1add", "OP_1 OP_1ADD OP_2 OP_NUMEQUAL", nil},
+	{"1sub", "OP_1 OP_1SUB OP_NOT", nil},
+	{"negate", "OP_1 OP_NEGATE OP_1NEGATE OP_NUMEQUAL", nil},
+	{"abs", "OP_1NEGATE OP_ABS OP_1 OP_NUMEQUAL", nil},
+	{"not zero", "0 OP_NOT", nil},
+	{"not nonzero", "OP_5 OP_NOT", ErrEvalFalse},
+	{"0notequal nonzero", "OP_5 OP_0NOTEQUAL", nil},
+	{"0notequal zero", "0 OP_0NOTEQUAL", ErrEvalFalse},
+	{"add", "OP_2 OP_3 OP_ADD OP_5 OP_NUMEQUAL", nil},
+	{"sub", "OP_5 OP_3 OP_SUB OP_2 OP_NUMEQUAL", nil},
+	{"sub negative", "OP_3 OP_5 OP_SUB #-2 OP_NUMEQUAL", nil},
+	{"booland", "OP_1 OP_2 OP_BOOLAND", nil},
+	{"booland false", "OP_1 0 OP_BOOLAND", ErrEvalFalse},
+	{"boolor", "0 OP_3 OP_BOOLOR", nil},
+	{"boolor false", "0 0 OP_BOOLOR", ErrEvalFalse},
+	{"numequal false", "OP_2 OP_3 OP_NUMEQUAL", ErrEvalFalse},
+	{"numequalverify", "OP_3 OP_3 OP_NUMEQUALVERIFY OP_1", nil},
+	{"numequalverify fails", "OP_2 OP_3 OP_NUMEQUALVERIFY OP_1", ErrVerifyFailed},
+	{"numnotequal", "OP_2 OP_3 OP_NUMNOTEQUAL", nil},
+	{"lessthan", "OP_2 OP_3 OP_LESSTHAN", nil},
+	{"lessthan false", "OP_3 OP_3 OP_LESSTHAN", ErrEvalFalse},
+	{"greaterthan", "OP_3 OP_2 OP_GREATERTHAN", nil},
+	{"greaterthan false", "OP_2 OP_3 OP_GREATERTHAN", ErrEvalFalse},
+	{"lessthanorequal", "OP_3 OP_3 OP_LESSTHANOREQUAL", nil},
+	{"greaterthanorequal false", "OP_2 OP_3 OP_GREATERTHANOREQUAL", ErrEvalFalse},
+	{"min", "OP_2 OP_3 OP_MIN OP_2 OP_NUMEQUAL", nil},
+	{"max", "OP_2 OP_3 OP_MAX OP_3 OP_NUMEQUAL", nil},
+	{"within", "OP_3 OP_2 OP_5 OP_WITHIN", nil},
+	{"within lower bound", "OP_2 OP_2 OP_5 OP_WITHIN", nil},
+	{"within excludes upper bound", "OP_5 OP_2 OP_5 OP_WITHIN", ErrEvalFalse},
+	{"within underflow", "OP_2 OP_5 OP_WITHIN", ErrStackUnderflow},
+	{"add underflow", "OP_1 OP_ADD", ErrStackUnderflow},
+	{"1add underflow", "OP_1ADD", ErrStackUnderflow},
+	{"four byte operand", "ffffff7f OP_1ADD OP_SIZE OP_5 OP_EQUAL", nil},
+	{"five byte operand", "0102030405 OP_1ADD", ErrNumberOverflow},
+	{"non-minimal operand", "0100 OP_1ADD", ErrMinimalData},
+	{"negative zero operand", "80 OP_1ADD", ErrMinimalData},
+
+	// Hashing
+	{"ripemd160", "0 OP_RIPEMD160 9c1185a5c5e9fc54612808977ee8f548b2258d31 OP_EQUAL", nil},
+	{"sha256", "0 OP_SHA256 e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 OP_EQUAL", nil},
+	{"hash160", "0 OP_HASH160 b472a266d0bd89c13706a4132ccfb16f7c3b9fcb OP_EQUAL", nil},
+	{"hash256", "0 OP_HASH256 5df6e0e2761359d30a8275058e299fcc0381534545f55cf43e41983f5d4c9456 OP_EQUAL", nil},
+	{"sha256 underflow", "OP_SHA256", ErrStackUnderflow},
+	{"hash160 underflow", "OP_HASH160", ErrStackUnderflow},
+
+	// Signatures
+	{"checksig", sig1 + " " + key1 + " OP_CHECKSIG", nil},
+	{"checksig wrong key", sig1 + " " + key2 + " OP_CHECKSIG", ErrEvalFalse},
+	{"checksig empty signature", "0 " + key1 + " OP_CHECKSIG", ErrEvalFalse},
+	{"checksig underflow", key1 + " OP_CHECKSIG", ErrStackUnderflow},
+	{"checksigverify", sig1 + " " + key1 + " OP_CHECKSIGVERIFY OP_1", nil},
+	{"checksigverify fails", sig2 + " " + key1 + " OP_CHECKSIGVERIFY OP_1", ErrVerifyFailed},
+	{"multisig 2 of 3", sig1 + " " + sig3 + " OP_2 " + key1 + " " + key2 + " " + key3 + " OP_3 OP_CHECKMULTISIG", nil},
+	{"multisig 1 of 1", sig2 + " OP_1 " + key2 + " OP_1 OP_CHECKMULTISIG", nil},
+	{"multisig out of order", sig3 + " " + sig1 + " OP_2 " + key1 + " " + key2 + " " + key3 + " OP_3 OP_CHECKMULTISIG", ErrEvalFalse},
+	{"multisig same signature twice", sig1 + " " + sig1 + " OP_2 " + key1 + " " + key2 + " OP_2 OP_CHECKMULTISIG", ErrEvalFalse},
+	{"multisig more signatures than keys", sig1 + " " + sig2 + " OP_2 " + key1 + " OP_1 OP_CHECKMULTISIG", ErrInvalidSigCount},
+	{"multisig no keys", "OP_1 0 OP_CHECKMULTISIG", ErrInvalidKeyCount},
+	{"multisig too many keys", "#17 OP_CHECKMULTISIG", ErrInvalidKeyCount},
+	{"multisig missing signature", sig1 + " OP_2 " + key1 + " " + key2 + " OP_2 OP_CHECKMULTISIG", ErrStackUnderflow},
+	{"multisig missing keys", "OP_1 " + key1 + " OP_2 OP_CHECKMULTISIG", ErrStackUnderflow},
+	{"checkmultisigverify", sig2 + " OP_1 " + key1 + " " + key2 + " OP_2 OP_CHECKMULTISIGVERIFY OP_1", nil},
+	{"checkmultisigverify fails", sig3 + " OP_1 " + key1 + " " + key2 + " OP_2 OP_CHECKMULTISIGVERIFY OP_1", ErrVerifyFailed},
+
+	// Time locks
+	{"cltv reached", "#100 OP_CHECKLOCKTIMEVERIFY", nil},
+	{"cltv keeps its operand", "#100 OP_CLTV OP_DROP OP_DEPTH 0 OP_EQUAL", nil},
+	{"cltv not reached", "#101 OP_CHECKLOCKTIMEVERIFY", ErrUnsatisfiedLockTime},
+	{"cltv five byte operand", "#4294967296 OP_CHECKLOCKTIMEVERIFY", ErrUnsatisfiedLockTime},
+	{"cltv six byte operand", "010203040506 OP_CHECKLOCKTIMEVERIFY", ErrNumberOverflow},
+	{"cltv negative", "OP_1NEGATE OP_CHECKLOCKTIMEVERIFY", ErrNegativeLockTime},
+	{"cltv underflow", "OP_CHECKLOCKTIMEVERIFY", ErrStackUnderflow},
+	{"cltv in skipped branch", "0 OP_IF #1000 OP_CLTV OP_ENDIF OP_1", nil},
+	{"csv reached", "#10 OP_CHECKSEQUENCEVERIFY", nil},
+	{"csv not reached", "#11 OP_CSV", ErrUnsatisfiedSequence},
+	{"csv negative", "OP_1NEGATE OP_CHECKSEQUENCEVERIFY", ErrNegativeLockTime},
+	{"csv underflow", "OP_CHECKSEQUENCEVERIFY", ErrStackUnderflow},
+}
+
+func TestEngine(t *testing.T) {
+	checker := testChecker{lockTime: 100, sequence: 10}
+	for _, tt := range engineTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := eval(mustAssemble(t, tt.asm), checker)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("%s: unexpected error %v", tt.asm, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%s: error %v, want %v", tt.asm, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestEngineCoversEveryOpcode makes sure engineTests run every named opcode
+func TestEngineCoversEveryOpcode(t *testing.T) {
+	seen := make(map[byte]bool)
+	for _, tt := range engineTests {
+		ins, err := parse(mustAssemble(t, tt.asm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, in := range ins {
+			seen[in.op] = true
+		}
+	}
+	for op, name := range opcodeNames {
+		if op == OP_PUSHDATA1 || op == OP_PUSHDATA2 {
+			continue // Covered by TestPushLimits
+		}
+		if !seen[op] {
+			t.Errorf("no engine test runs %s", name)
+		}
+	}
+}
+
+// TestEveryOpcodeUnderflows runs every opcode that takes operands on an empty stack
+func TestEveryOpcodeUnderflows(t *testing.T) {
+	noOperands := map[byte]bool{OP_NOP: true, OP_DEPTH: true, OP_RETURN: true, OP_ELSE: true, OP_ENDIF: true}
+	for op, name := range opcodeNames {
+		if isPush(op) || noOperands[op] {
+			continue
+		}
+		script := []byte{op}
+		if op == OP_IF || op == OP_NOTIF {
+			script = append(script, OP_ENDIF)
+		}
+		if err := eval(script, testChecker{}); !errors.Is(err, ErrStackUnderflow) {
+			t.Errorf("%s on an empty stack: error %v, want ErrStackUnderflow", name, err)
+		}
+	}
+}
+
+func TestInvalidOpcodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+	}{
+		{"executed", []byte{OP_1, 0xba}},
+		{"in skipped branch", []byte{OP_0, OP_IF, 0xba, OP_ENDIF, OP_1}},
+		{"reserved", []byte{0x50}},
+		{"disabled in Bitcoin", []byte{OP_1, OP_1, 0x7e}}, // OP_CAT
+	}
+	for _, tt := range tests {
+		if err := eval(tt.script, testChecker{}); !errors.Is(err, ErrInvalidOpcode) {
+			t.Errorf("%s: error %v, want ErrInvalidOpcode", tt.name, err)
+		}
+	}
+}
+
+func TestStackLimit(t *testing.T) {
+	full := bytes.Repeat([]byte{OP_1}, MaxStackSize)
+	if err := eval(full, testChecker{}); err != nil {
+		t.Fatalf("%d elements: %v", MaxStackSize, err)
+	}
+	if err := eval(append(full, OP_1), testChecker{}); !errors.Is(err, ErrStackOverflow) {
+		t.Errorf("%d pushes: error %v, want ErrStackOverflow", MaxStackSize+1, err)
+	}
+	if err := eval(append(full, OP_DUP), testChecker{}); !errors.Is(err, ErrStackOverflow) {
+		t.Errorf("OP_DUP on a full stack: error %v, want ErrStackOverflow", err)
+	}
+}
+
+func TestOpLimit(t *testing.T) {
+	ops := append([]byte{OP_1}, bytes.Repeat([]byte{OP_NOP}, MaxOpsPerScript)...)
+	if err := eval(ops, testChecker{}); err != nil {
+		t.Fatalf("%d operations: %v", MaxOpsPerScript, err)
+	}
+	if err := eval(append(ops, OP_NOP), testChecker{}); !errors.Is(err, ErrTooManyOps) {
+		t.Errorf("%d operations: error %v, want ErrTooManyOps", MaxOpsPerScript+1, err)
+	}
+	// Every key of a multisig counts, so 200 NOPs and a 16 key multisig exceed the limit
+	multisig := NewBuilder().AddOp(OP_1)
+	for i := 0; i < MaxOpsPerScript-1; i++ {
+		multisig.AddOp(OP_NOP)
+	}
+	multisig.AddInt(16).AddOp(OP_CHECKMULTISIG)
+	if err := eval(multisig.Script(), testChecker{}); !errors.Is(err, ErrTooManyOps) {
+		t.Errorf("multisig keys not counted: error %v", err)
+	}
+}
+
+func TestPushLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  []byte
+		wantErr error
+	}{
+		{"largest element", NewBuilder().AddData(bytes.Repeat([]byte{1}, MaxElementSize)).Script(), nil},
+		{"element too large", NewBuilder().AddData(bytes.Repeat([]byte{1}, MaxElementSize+1)).Script(), ErrElementTooLarge},
+		{"pushdata1", append([]byte{OP_PUSHDATA1, 2}, 1, 2), nil},
+		{"pushdata2", append([]byte{OP_PUSHDATA2, 2, 0}, 1, 2), nil},
+		{"push past end", []byte{0x05, 1, 2}, ErrMalformedPush},
+		{"pushdata1 without length", []byte{OP_PUSHDATA1}, ErrMalformedPush},
+		{"pushdata1 past end", []byte{OP_PUSHDATA1, 3, 1}, ErrMalformedPush},
+		{"pushdata2 without length", []byte{OP_PUSHDATA2, 1}, ErrMalformedPush},
+		{"script too large", bytes.Repeat([]byte{OP_1}, MaxScriptSize+1), ErrScriptTooLarge},
+	}
+	for _, tt := range tests {
+		err := eval(tt.script, testChecker{})
+		if tt.wantErr == nil && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		n       int64
+		encoded string
+	}{
+		{0, ""}, {1, "01"}, {-1, "81"}, {16, "10"}, {127, "7f"}, {128, "8000"}, {-128, "8080"},
+		{255, "ff00"}, {256, "0001"}, {-255, "ff80"}, {32767, "ff7f"}, {-32768, "008080"},
+		{2147483647, "ffffff7f"}, {-2147483647, "ffffffff"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(encodeNum(tt.n)); got != tt.encoded {
+			t.Errorf("encodeNum(%d) = %s, want %s", tt.n, got, tt.encoded)
+		}
+		data, _ := hex.DecodeString(tt.encoded)
+		if got, err := decodeNum(data, maxNumSize); err != nil || got != tt.n {
+			t.Errorf("decodeNum(%s) = %d, %v; want %d", tt.encoded, got, err, tt.n)
+		}
+	}
+}
+
+func TestStandardTemplates(t *testing.T) {
+	pubKey, other := testKey(1), testKey(2)
+	pkh := Hash160(pubKey)
+	redeem, err := MultiSig(2, [][]byte{testKey(1), testKey(2), testKey(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh := PayToScriptHash(Hash160(redeem))
+	checker := testChecker{lockTime: 100}
+
+	tests := []struct {
+		name      string
+		unlocking []byte
+		locking   []byte
+		class     Class
+		wantErr   error
+	}{
+		{"p2pkh", UnlockPubKeyHash(fakeSig(pubKey), pubKey), PayToPubKeyHash(pkh), PubKeyHashTy, nil},
+		{"p2pkh wrong key", UnlockPubKeyHash(fakeSig(other), other), PayToPubKeyHash(pkh), PubKeyHashTy, ErrVerifyFailed},
+		{"p2pkh bad signature", UnlockPubKeyHash(fakeSig(other), pubKey), PayToPubKeyHash(pkh), PubKeyHashTy, ErrEvalFalse},
+		{"p2pkh empty unlocking script", nil, PayToPubKeyHash(pkh), PubKeyHashTy, ErrStackUnderflow},
+		{"p2pk", UnlockPubKey(fakeSig(pubKey)), PayToPubKey(pubKey), PubKeyTy, nil},
+		{"p2pk bad signature", UnlockPubKey(fakeSig(other)), PayToPubKey(pubKey), PubKeyTy, ErrEvalFalse},
+		{"p2sh multisig", UnlockScriptHash([][]byte{fakeSig(testKey(1)), fakeSig(testKey(3))}, redeem), p2sh, ScriptHashTy, nil},
+		{"p2sh multisig foreign signature", UnlockScriptHash([][]byte{fakeSig(testKey(1)), fakeSig(testKey(4))}, redeem), p2sh, ScriptHashTy, ErrEvalFalse},
+		{"p2sh wrong redeem script", UnlockScriptHash([][]byte{fakeSig(pubKey)}, PayToPubKey(pubKey)), p2sh, ScriptHashTy, ErrEvalFalse},
+		{"p2sh redeem script fails", UnlockScriptHash([][]byte{fakeSig(testKey(1))}, redeem), p2sh, ScriptHashTy, ErrStackUnderflow},
+		{"locked p2pkh reached", UnlockPubKeyHash(fakeSig(pubKey), pubKey), PayToPubKeyHashAfter(pkh, 100), LockedPubKeyHashTy, nil},
+		{"locked p2pkh not reached", UnlockPubKeyHash(fakeSig(pubKey), pubKey), PayToPubKeyHashAfter(pkh, 101), LockedPubKeyHashTy, ErrUnsatisfiedLockTime},
+		{"unlocking script with opcodes", append(UnlockPubKey(fakeSig(pubKey)), OP_NOP), PayToPubKey(pubKey), PubKeyTy, ErrNotPushOnly},
+		{"nulldata", nil, mustNullData(t, []byte("hello")), NullDataTy, ErrEarlyReturn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if class := Classify(tt.locking); class != tt.class {
+				t.Errorf("class %v, want %v", class, tt.class)
+			}
+			err := Verify(tt.unlocking, tt.locking, checker)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := ExtractPubKeyHash(PayToPubKey(pubKey)); !bytes.Equal(got, pkh) {
+		t.Errorf("P2PK key hash %x, want %x", got, pkh)
+	}
+	if got := ExtractPubKeyHash(p2sh); !bytes.Equal(got, Hash160(redeem)) {
+		t.Errorf("P2SH hash %x, want %x", got, Hash160(redeem))
+	}
+	if lockTime, ok := ExtractLockTime(PayToPubKeyHashAfter(pkh, 500000001)); !ok || lockTime != 500000001 {
+		t.Errorf("lock time %d, %v", lockTime, ok)
+	}
+}
+
+func mustNullData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	script, err := NullData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestAssembleRoundTrip(t *testing.T) {
+	scripts := [][]byte{
+		PayToPubKeyHash(Hash160(testKey(1))),
+		PayToPubKeyHashAfter(Hash160(testKey(1)), 1000),
+		HashTimeLock(HTLC{SecretHash: make([]byte, 32), Recipient: make([]byte, 20), Refund: make([]byte, 20), LockTime: 144}),
+		NewBuilder().AddData(bytes.Repeat([]byte{7}, 300)).AddInt(-5).AddOp(OP_WITHIN).Script(),
+	}
+	for _, script := range scripts {
+		asm, err := Disasm(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := Assemble(asm)
+		if err != nil || !bytes.Equal(back, script) {
+			t.Errorf("%s does not assemble back: %x, %v", asm, back, err)
+		}
+	}
+	if asm, _ := Disasm([]byte{0xba}); !strings.Contains(asm, "OP_UNKNOWN") {
+		t.Errorf("unknown opcode disassembles as %q", asm)
+	}
+	if _, err := Assemble("OP_NOSUCH"); err == nil {
+		t.Error("unknown opcode name assembled")
+	}
+}
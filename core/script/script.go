@@ -0,0 +1,304 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits keeping evaluation cheap and bounded
+const (
+	MaxScriptSize      = 10000     // Bytes per script
+	MaxElementSize     = 520       // Bytes per pushed element
+	MaxOpsPerScript    = 201       // Non-push opcodes per script
+	MaxStackSize       = 1000      // Elements on the stack
+	MaxMultiSigKeys    = 16        // Public keys per OP_CHECKMULTISIG
+	MaxDataCarrierSize = 80        // Bytes of data in an OP_RETURN output
+	maxNumSize         = 4         // Bytes of numbers used in arithmetic
+	maxLockTimeSize    = 5         // Bytes of the OP_CHECKLOCKTIMEVERIFY operand
+	LockTimeThreshold  = 500000000 // Lock times below are heights, above Unix times
+)
+
+// instruction is one parsed opcode with the data it pushes
+type instruction struct {
+	op   byte
+	data []byte
+}
+
+// parse splits a script into instructions
+func parse(script []byte) ([]instruction, error) {
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrScriptTooLarge, len(script))
+	}
+	var ins []instruction
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+		var n int
+		switch {
+		case op >= 0x01 && op <= 0x4b:
+			n = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			n = int(script[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			ins = append(ins, instruction{op: op})
+			continue
+		}
+		if i+n > len(script) {
+			return nil, ErrMalformedPush
+		}
+		ins = append(ins, instruction{op: op, data: script[i : i+n]})
+		i += n
+	}
+	return ins, nil
+}
+
+// Builder assembles a script
+type Builder struct {
+	script []byte
+}
+
+// NewBuilder creates an empty script builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends an opcode
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+	return b
+}
+
+// AddData appends the smallest push of data
+func (b *Builder) AddData(data []byte) *Builder {
+	switch n := len(data); {
+	case n == 0:
+		b.script = append(b.script, OP_0)
+	case n == 1 && data[0] >= 1 && data[0] <= 16:
+		b.script = append(b.script, OP_1+data[0]-1)
+	case n == 1 && data[0] == 0x81:
+		b.script = append(b.script, OP_1NEGATE)
+	case n <= 0x4b:
+		b.script = append(append(b.script, byte(n)), data...)
+	case n <= 0xff:
+		b.script = append(append(b.script, OP_PUSHDATA1, byte(n)), data...)
+	default:
+		b.script = append(binary.LittleEndian.AppendUint16(append(b.script, OP_PUSHDATA2), uint16(n)), data...)
+	}
+	return b
+}
+
+// AddInt appends the smallest push of the number n
+func (b *Builder) AddInt(n int64) *Builder {
+	return b.AddData(encodeNum(n))
+}
+
+// Script returns the assembled script
+func (b *Builder) Script() []byte {
+	return append([]byte{}, b.script...)
+}
+
+// Disasm renders a script as space separated opcode names and hex data
+func Disasm(script []byte) (string, error) {
+	ins, err := parse(script)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(ins))
+	for _, in := range ins {
+		switch {
+		case in.data != nil:
+			parts = append(parts, hex.EncodeToString(in.data))
+		case in.op == OP_0:
+			parts = append(parts, "0")
+		default:
+			parts = append(parts, OpcodeName(in.op))
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Assemble parses the output of Disasm back into a script. Tokens are opcode
+// names, with or without the OP_ prefix, hex data, or decimal numbers
+// written as "#n".
+func Assemble(asm string) ([]byte, error) {
+	b := NewBuilder()
+	for _, token := range strings.Fields(asm) {
+		if token == "0" {
+			b.AddOp(OP_0)
+			continue
+		}
+		name := strings.ToUpper(token)
+		if !strings.HasPrefix(name, "OP_") {
+			name = "OP_" + name
+		}
+		if op, ok := opcodesByName[name]; ok {
+			b.AddOp(op)
+			continue
+		}
+		if strings.HasPrefix(token, "#") {
+			n, err := strconv.ParseInt(token[1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", token)
+			}
+			b.AddInt(n)
+			continue
+		}
+		data, err := hex.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("unknown token %q", token)
+		}
+		b.AddData(data)
+	}
+	return b.Script(), nil
+}
+
+// IsPushOnly reports whether a script only pushes data, as unlocking scripts must
+func IsPushOnly(script []byte) bool {
+	ins, err := parse(script)
+	if err != nil {
+		return false
+	}
+	for _, in := range ins {
+		if !isPush(in.op) {
+			return false
+		}
+	}
+	return true
+}
+
+// PushedData returns the data pushed by a push only script
+func PushedData(script []byte) ([][]byte, error) {
+	ins, err := parse(script)
+	if err != nil {
+		return nil, err
+	}
+	var pushes [][]byte
+	for _, in := range ins {
+		if !isPush(in.op) {
+			return nil, ErrNotPushOnly
+		}
+		pushes = append(pushes, pushValue(in))
+	}
+	return pushes, nil
+}
+
+// pushValue returns the element a push instruction puts on the stack
+func pushValue(in instruction) []byte {
+	switch {
+	case in.op == OP_0:
+		return []byte{}
+	case in.op == OP_1NEGATE:
+		return encodeNum(-1)
+	case in.op >= OP_1 && in.op <= OP_16:
+		return encodeNum(int64(in.op - OP_1 + 1))
+	default:
+		return in.data
+	}
+}
+
+// encodeNum encodes n as a minimal little endian sign and magnitude number
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+	var out []byte
+	for abs > 0 {
+		out = append(out, byte(abs))
+		abs >>= 8
+	}
+	// The top bit holds the sign, so add a byte when the magnitude uses it
+	if out[len(out)-1]&0x80 != 0 {
+		if negative {
+			out = append(out, 0x80)
+		} else {
+			out = append(out, 0x00)
+		}
+	} else if negative {
+		out[len(out)-1] |= 0x80
+	}
+	return out
+}
+
+// decodeNum decodes a number of at most maxSize bytes, rejecting non-minimal encodings
+func decodeNum(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, fmt.Errorf("%w: %d bytes", ErrNumberOverflow, len(data))
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	// The last byte may only be a bare sign byte when the one before needs its top bit
+	if data[len(data)-1]&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, ErrMinimalData
+	}
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(data) - 1))
+		return -n, nil
+	}
+	return n, nil
+}
+
+// asBool interprets a stack element: zero and negative zero are false
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+// fromBool encodes a boolean as the script numbers 1 and 0
+func fromBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+// Script evaluation errors
+var (
+	ErrScriptTooLarge        = errors.New("script is too large")
+	ErrMalformedPush         = errors.New("script push runs past its end")
+	ErrTooManyOps            = errors.New("script has too many operations")
+	ErrStackOverflow         = errors.New("stack is too large")
+	ErrStackUnderflow        = errors.New("stack has too few elements")
+	ErrElementTooLarge       = errors.New("pushed element is too large")
+	ErrInvalidOpcode         = errors.New("invalid opcode")
+	ErrUnbalancedConditional = errors.New("unbalanced conditional")
+	ErrVerifyFailed          = errors.New("verify failed")
+	ErrEarlyReturn           = errors.New("script returned early")
+	ErrEvalFalse             = errors.New("script evaluated to false")
+	ErrNumberOverflow        = errors.New("number is too large")
+	ErrMinimalData           = errors.New("number is not minimally encoded")
+	ErrNegativeLockTime      = errors.New("negative lock time")
+	ErrUnsatisfiedLockTime   = errors.New("lock time not reached")
+	ErrUnsatisfiedSequence   = errors.New("input sequence does not hold the relative lock time")
+	ErrNotPushOnly           = errors.New("unlocking script must only push data")
+	ErrInvalidKeyCount       = errors.New("invalid multisig key count")
+	ErrInvalidSigCount       = errors.New("invalid multisig signature count")
+	ErrDataTooLarge          = errors.New("data carrier is too large")
+)
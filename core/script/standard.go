@@ -0,0 +1,406 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Class names the standard shape of a locking script
+type Class int
+
+// Standard script classes
+const (
+	NonStandard        Class = iota
+	PubKeyHashTy             // OP_DUP OP_HASH160 <pkh> OP_EQUALVERIFY OP_CHECKSIG
+	PubKeyTy                 // <pubkey> OP_CHECKSIG
+	LockedPubKeyHashTy       // <locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP followed by P2PKH
+	ScriptHashTy             // OP_HASH160 <script hash> OP_EQUAL
+	MultiSigTy               // <m> <key 1>..<key n> <n> OP_CHECKMULTISIG
+	HTLCTy                   // Hashed time lock contract, see HashTimeLock
+	NullDataTy               // OP_RETURN [data], provably unspendable
+	PaymentChannelTy         // 2-of-2 payment channel with a refund, see PaymentChannel
+)
+
+// String returns the name shown in decoded scripts
+func (c Class) String() string {
+	switch c {
+	case PubKeyHashTy:
+		return "pubkeyhash"
+	case PubKeyTy:
+		return "pubkey"
+	case LockedPubKeyHashTy:
+		return "lockedpubkeyhash"
+	case ScriptHashTy:
+		return "scripthash"
+	case MultiSigTy:
+		return "multisig"
+	case HTLCTy:
+		return "htlc"
+	case NullDataTy:
+		return "nulldata"
+	case PaymentChannelTy:
+		return "paymentchannel"
+	default:
+		return "nonstandard"
+	}
+}
+
+// pubKeyHashLen is the size of RIPEMD-160 public key hashes
+const pubKeyHashLen = 20
+
+// PayToPubKeyHash locks an output to the key hashing to pubKeyHash. It is the
+// script implied by outputs that carry no explicit script.
+func PayToPubKeyHash(pubKeyHash []byte) []byte {
+	return NewBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// PayToPubKey locks an output directly to a public key
+func PayToPubKey(pubKey []byte) []byte {
+	return NewBuilder().AddData(pubKey).AddOp(OP_CHECKSIG).Script()
+}
+
+// PayToPubKeyHashAfter locks an output to pubKeyHash until lockTime, a block
+// height below 500000000 and a Unix time otherwise
+func PayToPubKeyHashAfter(pubKeyHash []byte, lockTime int64) []byte {
+	prefix := NewBuilder().AddInt(lockTime).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).Script()
+	return append(prefix, PayToPubKeyHash(pubKeyHash)...)
+}
+
+// PayToScriptHash locks an output to the redeem script hashing to scriptHash
+func PayToScriptHash(scriptHash []byte) []byte {
+	return NewBuilder().AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+}
+
+// MultiSig builds a script requiring m signatures by distinct keys of pubKeys.
+// As a redeem script it has to fit in one stack element.
+func MultiSig(m int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) < 1 || len(pubKeys) > MaxMultiSigKeys {
+		return nil, fmt.Errorf("%w: %d, want 1 to %d", ErrInvalidKeyCount, len(pubKeys), MaxMultiSigKeys)
+	}
+	if m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrInvalidSigCount, m, len(pubKeys))
+	}
+	b := NewBuilder().AddInt(int64(m))
+	for i, pubKey := range pubKeys {
+		for _, other := range pubKeys[:i] {
+			if bytes.Equal(pubKey, other) {
+				return nil, fmt.Errorf("public key %x appears twice", pubKey)
+			}
+		}
+		b.AddData(pubKey)
+	}
+	script := b.AddInt(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script()
+	if len(script) > MaxElementSize {
+		return nil, fmt.Errorf("%w: multisig script of %d bytes", ErrElementTooLarge, len(script))
+	}
+	return script, nil
+}
+
+// ExtractMultiSig returns the threshold and keys of a multisig script
+func ExtractMultiSig(script []byte) (int, [][]byte, bool) {
+	ins, err := parse(script)
+	if err != nil || len(ins) < 4 || ins[len(ins)-1].op != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+	m, n := smallInt(ins[0]), smallInt(ins[len(ins)-2])
+	if n < 1 || n != len(ins)-3 || m < 1 || m > n {
+		return 0, nil, false
+	}
+	var pubKeys [][]byte
+	for _, in := range ins[1 : len(ins)-2] {
+		if in.data == nil {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, in.data)
+	}
+	return m, pubKeys, true
+}
+
+// SecretSize is the size of HTLC secrets. Fixing it keeps a secret that
+// redeems a contract on one chain from being rejected on the other.
+const SecretSize = 32
+
+// HTLC holds the terms of a hashed time lock contract
+type HTLC struct {
+	SecretHash []byte // SHA-256 of the secret that lets Recipient redeem
+	Recipient  []byte // Public key hash that redeems with the secret
+	Refund     []byte // Public key hash that takes the coins back from LockTime on
+	LockTime   int64  // Block height below 500000000, Unix time otherwise
+}
+
+// HashTimeLock builds the redeem script of a hashed time lock contract:
+//
+//	OP_IF
+//	    OP_SIZE 32 OP_EQUALVERIFY OP_SHA256 <secret hash> OP_EQUALVERIFY
+//	    OP_DUP OP_HASH160 <recipient>
+//	OP_ELSE
+//	    <lock time> OP_CHECKLOCKTIMEVERIFY OP_DROP
+//	    OP_DUP OP_HASH160 <refund>
+//	OP_ENDIF
+//	OP_EQUALVERIFY OP_CHECKSIG
+func HashTimeLock(h HTLC) []byte {
+	return NewBuilder().AddOp(OP_IF).
+		AddOp(OP_SIZE).AddInt(SecretSize).AddOp(OP_EQUALVERIFY).AddOp(OP_SHA256).AddData(h.SecretHash).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.Recipient).
+		AddOp(OP_ELSE).
+		AddInt(h.LockTime).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.Refund).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// ExtractHTLC returns the terms of a script built by HashTimeLock
+func ExtractHTLC(script []byte) (HTLC, bool) {
+	ins, err := parse(script)
+	if err != nil || len(ins) != 20 {
+		return HTLC{}, false
+	}
+	lockTime, err := decodeNum(pushValue(ins[11]), maxLockTimeSize)
+	if err != nil {
+		return HTLC{}, false
+	}
+	h := HTLC{SecretHash: ins[5].data, Recipient: ins[9].data, Refund: ins[16].data, LockTime: lockTime}
+	if len(h.SecretHash) != sha256.Size || len(h.Recipient) != pubKeyHashLen || len(h.Refund) != pubKeyHashLen ||
+		!bytes.Equal(HashTimeLock(h), script) {
+		return HTLC{}, false
+	}
+	return h, true
+}
+
+// UnlockHTLCRedeem builds the unlocking script of a P2SH contract output
+// taking the redeem branch with the secret
+func UnlockHTLCRedeem(sig, pubKey, secret, contract []byte) []byte {
+	return UnlockScriptHash([][]byte{sig, pubKey, secret, {1}}, contract)
+}
+
+// UnlockHTLCRefund builds the unlocking script of a P2SH contract output
+// taking the refund branch
+func UnlockHTLCRefund(sig, pubKey, contract []byte) []byte {
+	return UnlockScriptHash([][]byte{sig, pubKey, nil}, contract)
+}
+
+// ExtractHTLCSecret returns the secret revealed by an unlocking script that
+// redeems contract
+func ExtractHTLCSecret(scriptSig, contract []byte) ([]byte, bool) {
+	h, ok := ExtractHTLC(contract)
+	if !ok {
+		return nil, false
+	}
+	pushes, err := PushedData(scriptSig)
+	if err != nil || len(pushes) != 5 || !bytes.Equal(pushes[4], contract) {
+		return nil, false
+	}
+	secret := pushes[2]
+	if hash := sha256.Sum256(secret); !bytes.Equal(hash[:], h.SecretHash) {
+		return nil, false
+	}
+	return secret, true
+}
+
+// Channel holds the terms of a unidirectional payment channel
+type Channel struct {
+	Payer    []byte // Public key funding the channel and paying through it
+	Payee    []byte // Public key receiving the payments
+	LockTime int64  // From then on Payer alone takes the coins back, a height or Unix time
+}
+
+// PaymentChannel builds the redeem script of a payment channel: both keys
+// spend together, and from the lock time on the payer alone.
+//
+//	OP_IF
+//	    2 <payer> <payee> 2 OP_CHECKMULTISIG
+//	OP_ELSE
+//	    <lock time> OP_CHECKLOCKTIMEVERIFY OP_DROP <payer> OP_CHECKSIG
+//	OP_ENDIF
+func PaymentChannel(c Channel) []byte {
+	return NewBuilder().AddOp(OP_IF).
+		AddInt(2).AddData(c.Payer).AddData(c.Payee).AddInt(2).AddOp(OP_CHECKMULTISIG).
+		AddOp(OP_ELSE).
+		AddInt(c.LockTime).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).AddData(c.Payer).AddOp(OP_CHECKSIG).
+		AddOp(OP_ENDIF).Script()
+}
+
+// ExtractPaymentChannel returns the terms of a script built by PaymentChannel
+func ExtractPaymentChannel(script []byte) (Channel, bool) {
+	ins, err := parse(script)
+	if err != nil || len(ins) != 13 {
+		return Channel{}, false
+	}
+	lockTime, err := decodeNum(pushValue(ins[7]), maxLockTimeSize)
+	if err != nil {
+		return Channel{}, false
+	}
+	c := Channel{Payer: ins[2].data, Payee: ins[3].data, LockTime: lockTime}
+	if c.Payer == nil || c.Payee == nil || bytes.Equal(c.Payer, c.Payee) || !bytes.Equal(PaymentChannel(c), script) {
+		return Channel{}, false
+	}
+	return c, true
+}
+
+// UnlockChannelClose builds the unlocking script of a P2SH channel output
+// spent by both parties
+func UnlockChannelClose(payerSig, payeeSig, channel []byte) []byte {
+	return UnlockScriptHash([][]byte{payerSig, payeeSig, {1}}, channel)
+}
+
+// UnlockChannelRefund builds the unlocking script of a P2SH channel output
+// taken back by the payer after the lock time
+func UnlockChannelRefund(sig, channel []byte) []byte {
+	return UnlockScriptHash([][]byte{sig, nil}, channel)
+}
+
+// smallInt returns the number pushed by OP_1 to OP_16, or 0
+func smallInt(in instruction) int {
+	if in.op >= OP_1 && in.op <= OP_16 {
+		return int(in.op-OP_1) + 1
+	}
+	return 0
+}
+
+// UnlockPubKeyHash builds the unlocking script for P2PKH outputs
+func UnlockPubKeyHash(sig, pubKey []byte) []byte {
+	return NewBuilder().AddData(sig).AddData(pubKey).Script()
+}
+
+// UnlockPubKey builds the unlocking script for P2PK outputs
+func UnlockPubKey(sig []byte) []byte {
+	return NewBuilder().AddData(sig).Script()
+}
+
+// UnlockScriptHash builds the unlocking script of a P2SH output: the
+// elements the redeem script consumes followed by the redeem script itself
+func UnlockScriptHash(pushes [][]byte, redeemScript []byte) []byte {
+	b := NewBuilder()
+	for _, data := range pushes {
+		b.AddData(data)
+	}
+	return b.AddData(redeemScript).Script()
+}
+
+// Classify returns the standard class of a locking script
+func Classify(script []byte) Class {
+	class, _ := match(script)
+	return class
+}
+
+// ExtractPubKeyHash returns the public key hash a standard script pays to,
+// hashing the key of P2PK scripts, or the script hash of P2SH scripts. It
+// returns nil for bare multisig, bare HTLC and non-standard scripts.
+func ExtractPubKeyHash(script []byte) []byte {
+	class, data := match(script)
+	switch class {
+	case PubKeyTy:
+		return Hash160(data)
+	case PubKeyHashTy, LockedPubKeyHashTy, ScriptHashTy:
+		return data
+	default:
+		return nil
+	}
+}
+
+// ExtractPubKey returns the key of a PubKeyTy script
+func ExtractPubKey(script []byte) ([]byte, bool) {
+	class, pubKey := match(script)
+	return pubKey, class == PubKeyTy
+}
+
+// IsUnspendable reports whether script starts with OP_RETURN, so no
+// unlocking script satisfies it and its outputs never enter the UTXO set
+func IsUnspendable(script []byte) bool {
+	return len(script) > 0 && script[0] == OP_RETURN
+}
+
+// NullData builds a provably unspendable script carrying up to
+// MaxDataCarrierSize bytes of data. Empty data gives a bare OP_RETURN.
+func NullData(data []byte) ([]byte, error) {
+	if len(data) > MaxDataCarrierSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrDataTooLarge, len(data), MaxDataCarrierSize)
+	}
+	b := NewBuilder().AddOp(OP_RETURN)
+	if len(data) > 0 {
+		b.AddData(data)
+	}
+	return b.Script(), nil
+}
+
+// ExtractNullData returns the data carried by a script built by NullData
+func ExtractNullData(script []byte) ([]byte, bool) {
+	ins, err := parse(script)
+	if err != nil || len(ins) == 0 || len(ins) > 2 || ins[0].op != OP_RETURN {
+		return nil, false
+	}
+	data := []byte{}
+	if len(ins) == 2 {
+		if !isPush(ins[1].op) {
+			return nil, false
+		}
+		data = pushValue(ins[1])
+	}
+	if built, err := NullData(data); err != nil || !bytes.Equal(built, script) {
+		return nil, false
+	}
+	return data, true
+}
+
+// ExtractLockTime returns the lock time of a LockedPubKeyHashTy script
+func ExtractLockTime(script []byte) (int64, bool) {
+	ins, err := parse(script)
+	if err != nil || Classify(script) != LockedPubKeyHashTy {
+		return 0, false
+	}
+	lockTime, err := decodeNum(pushValue(ins[0]), maxLockTimeSize)
+	return lockTime, err == nil
+}
+
+// match classifies a script and returns its key or key hash
+func match(script []byte) (Class, []byte) {
+	ins, err := parse(script)
+	if err != nil {
+		return NonStandard, nil
+	}
+	if pkh, ok := matchPubKeyHash(ins); ok {
+		return PubKeyHashTy, pkh
+	}
+	if _, ok := ExtractNullData(script); ok {
+		return NullDataTy, nil
+	}
+	if len(ins) == 2 && ins[0].data != nil && ins[1].op == OP_CHECKSIG {
+		if n := len(ins[0].data); n == 32 || n == 33 || n == 64 {
+			return PubKeyTy, ins[0].data
+		}
+	}
+	if len(ins) == 3 && ins[0].op == OP_HASH160 && len(ins[1].data) == pubKeyHashLen && ins[2].op == OP_EQUAL {
+		return ScriptHashTy, ins[1].data
+	}
+	if _, _, ok := ExtractMultiSig(script); ok {
+		return MultiSigTy, nil
+	}
+	if _, ok := ExtractHTLC(script); ok {
+		return HTLCTy, nil
+	}
+	if _, ok := ExtractPaymentChannel(script); ok {
+		return PaymentChannelTy, nil
+	}
+	if len(ins) == 8 && isPush(ins[0].op) && ins[1].op == OP_CHECKLOCKTIMEVERIFY && ins[2].op == OP_DROP {
+		if pkh, ok := matchPubKeyHash(ins[3:]); ok {
+			return LockedPubKeyHashTy, pkh
+		}
+	}
+	return NonStandard, nil
+}
+
+// matchPubKeyHash reports whether ins is exactly the P2PKH template
+func matchPubKeyHash(ins []instruction) ([]byte, bool) {
+	if len(ins) != 5 || ins[0].op != OP_DUP || ins[1].op != OP_HASH160 ||
+		len(ins[2].data) != pubKeyHashLen || ins[3].op != OP_EQUALVERIFY || ins[4].op != OP_CHECKSIG {
+		return nil, false
+	}
+	return ins[2].data, true
+}
+
+// IsPayToPubKeyHash reports whether script is the P2PKH template for pubKeyHash
+func IsPayToPubKeyHash(script, pubKeyHash []byte) bool {
+	return bytes.Equal(script, PayToPubKeyHash(pubKeyHash))
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// Errors returned by atomic swap operations
+var (
+	ErrNotHTLC         = errors.New("script is not a hashed time lock contract")
+	ErrWrongSecret     = errors.New("secret does not match the contract's secret hash")
+	ErrSecretNotFound  = errors.New("no redeem of the contract on the chain")
+	ErrNoContractCoins = errors.New("nothing unspent pays to the contract")
+)
+
+// NewSwapSecret returns a random HTLC secret and its SHA-256 hash
+func NewSwapSecret() ([]byte, []byte, error) {
+	secret := make([]byte, script.SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.Sum256(secret)
+	return secret, hash[:], nil
+}
+
+// AddHTLC creates a contract that recipient redeems by revealing the
+// preimage of secretHash and refund takes back from lockTime on. It stores
+// the contract in wallets and returns its script address.
+func AddHTLC(wallets *crypto.Wallets, recipient, refund string, secretHash []byte, lockTime int64) (string, []byte, error) {
+	if len(secretHash) != sha256.Size {
+		return "", nil, fmt.Errorf("secret hash must be %d bytes, got %d", sha256.Size, len(secretHash))
+	}
+	if lockTime <= 0 {
+		return "", nil, fmt.Errorf("lock time must be positive, got %d", lockTime)
+	}
+	recipientHash, err := crypto.DecodeKeyAddress(recipient)
+	if err != nil {
+		return "", nil, err
+	}
+	refundHash, err := crypto.DecodeKeyAddress(refund)
+	if err != nil {
+		return "", nil, err
+	}
+	contract := script.HashTimeLock(script.HTLC{SecretHash: secretHash, Recipient: recipientHash, Refund: refundHash, LockTime: lockTime})
+	return wallets.AddScript(contract), contract, nil
+}
+
+// SwapContract describes an HTLC as seen on this chain
+type SwapContract struct {
+	script.HTLC
+	Address string  // Base58 script address of the contract
+	Value   float64 // Unspent value paid to the contract
+	Secret  []byte  // Secret revealed by a redeem on this chain, nil until redeemed
+}
+
+// AuditSwap checks the terms of contract and what this chain holds for it,
+// so a participant can verify a contract before funding its own side
+func (bc *Blockchain) AuditSwap(contract []byte) (*SwapContract, error) {
+	h, ok := script.ExtractHTLC(contract)
+	if !ok {
+		return nil, ErrNotHTLC
+	}
+	sc := &SwapContract{HTLC: h, Address: crypto.EncodeScriptAddress(crypto.PublicKeyHash(contract), crypto.AddressBase58)}
+	for _, utxo := range bc.contractUTXOs(contract) {
+		sc.Value += utxo.Value
+	}
+	if secret, err := bc.FindSwapSecret(contract); err == nil {
+		sc.Secret = secret
+	}
+	return sc, nil
+}
+
+// FindSwapSecret scans the chain for a transaction redeeming contract and
+// returns the secret it revealed
+func (bc *Blockchain) FindSwapSecret(contract []byte) ([]byte, error) {
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			for _, vin := range tx.Vin {
+				if secret, ok := script.ExtractHTLCSecret(vin.ScriptSig, contract); ok {
+					return secret, nil
+				}
+			}
+		}
+	}
+	return nil, ErrSecretNotFound
+}
+
+// contractUTXOs returns the unspent plain coin outputs paying to the script hash of contract
+func (bc *Blockchain) contractUTXOs(contract []byte) []*UTXO {
+	scriptHash := crypto.PublicKeyHash(contract)
+	lockingScript := script.PayToScriptHash(scriptHash)
+	var utxos []*UTXO
+	for _, utxo := range bc.UTXOSet.FindUTXOs(scriptHash) {
+		if bytes.Equal(utxo.Script, lockingScript) && utxo.TokenID == "" {
+			utxos = append(utxos, utxo)
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].TxID != utxos[j].TxID {
+			return utxos[i].TxID < utxos[j].TxID
+		}
+		return utxos[i].Index < utxos[j].Index
+	})
+	return utxos
+}
+
+// RedeemSwap builds a signed transaction sweeping the coins of contract to
+// its recipient, whose key must be in the wallet, revealing secret
+func (b *TxBuilder) RedeemSwap(contract, secret []byte, feeRate float64) (*Transaction, error) {
+	h, ok := script.ExtractHTLC(contract)
+	if !ok {
+		return nil, ErrNotHTLC
+	}
+	if hash := sha256.Sum256(secret); len(secret) != script.SecretSize || !bytes.Equal(hash[:], h.SecretHash) {
+		return nil, ErrWrongSecret
+	}
+	return b.spendContract(contract, h.Recipient, secret, feeRate)
+}
+
+// RefundSwap builds a signed transaction returning the coins of contract to
+// its refund key, which must be in the wallet, once the lock time has passed
+func (b *TxBuilder) RefundSwap(contract []byte, feeRate float64) (*Transaction, error) {
+	h, ok := script.ExtractHTLC(contract)
+	if !ok {
+		return nil, ErrNotHTLC
+	}
+	if !lockTimeReached(h.LockTime, b.bc.Height()+1, time.Now().Unix()) {
+		return nil, fmt.Errorf("%w: contract refunds from lock time %d", ErrNonFinal, h.LockTime)
+	}
+	return b.spendContract(contract, h.Refund, nil, feeRate)
+}
+
+// htlcInputSize estimates the serialized size of an input spending a
+// contract output, with secret for redeems
+func htlcInputSize(contract []byte) int {
+	const outpointSize = 70 // Txid, index, empty signature and key fields, script length
+	return outpointSize + 72 + 66 + script.SecretSize + 1 + len(contract) + 6
+}
+
+// spendContract sweeps the coins of contract to pubKeyHash, taking the
+// redeem branch when secret is set and the refund branch otherwise
+func (b *TxBuilder) spendContract(contract, pubKeyHash, secret []byte, feeRate float64) (*Transaction, error) {
+	if feeRate < 0 {
+		return nil, fmt.Errorf("fee rate must not be negative, got %.8f", feeRate)
+	}
+	wallet, err := b.wallets.GetWallet(crypto.EncodeAddress(pubKeyHash, crypto.AddressBase58))
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{LockTime: b.lockTime}
+	var prevOuts []TxOutput
+	var total int64
+	for _, utxo := range b.bc.contractUTXOs(contract) {
+		if b.mempool != nil && b.mempool.IsSpent(utxo.TxID, utxo.Index) {
+			continue
+		}
+		tx.Vin = append(tx.Vin, TxInput{Txid: utxo.TxID, Vout: utxo.Index, Sequence: b.sequence})
+		prevOuts = append(prevOuts, TxOutput{Value: utxo.Value, PubKeyHash: utxo.PubKeyHash, Script: utxo.Script})
+		total += toUnits(utxo.Value)
+	}
+	if len(tx.Vin) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoContractCoins, crypto.EncodeScriptAddress(crypto.PublicKeyHash(contract), crypto.AddressBase58))
+	}
+	fee := feeForSize(feeRate, txOverheadSize+len(tx.Vin)*htlcInputSize(contract)+txOutputSize)
+	if total-fee < toUnits(DustThreshold) {
+		return nil, &InsufficientFundsError{Available: fromUnits(total), Required: fromUnits(fee + toUnits(DustThreshold))}
+	}
+	tx.Vout = []TxOutput{{Value: fromUnits(total - fee), PubKeyHash: pubKeyHash}}
+	tx.SetID()
+
+	for i, prevOut := range prevOuts {
+		sig, err := wallet.Sign(tx.SignatureHash(i, prevOut))
+		if err != nil {
+			return nil, err
+		}
+		if secret != nil {
+			tx.Vin[i].ScriptSig = script.UnlockHTLCRedeem(sig, wallet.PublicKey, secret, contract)
+		} else {
+			tx.Vin[i].ScriptSig = script.UnlockHTLCRefund(sig, wallet.PublicKey, contract)
+		}
+	}
+	return tx, nil
+}
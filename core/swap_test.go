@@ -0,0 +1,161 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// fundSwap adds a contract paying to for secretHash, refunding from, to
+// wallets and mines a transaction paying amount to it
+func fundSwap(t *testing.T, bc *Blockchain, wallets *crypto.Wallets, from, to string, amount float64, secretHash []byte, lockTime int64, miner []byte) []byte {
+	t.Helper()
+	address, contract, err := AddHTLC(wallets, to, from, secretHash, lockTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := NewRecipient(address, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := NewTxBuilder(bc, wallets, nil).Build(from, []Recipient{recipient}, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, bc, miner, tx)
+	return contract
+}
+
+func TestAtomicSwap(t *testing.T) {
+	chainA, chainB := newTestChain(t), newTestChain(t)
+	alice, bob := newTestWallets(t), newTestWallets(t)
+	aliceA, aliceAHash := newTestAddress(t, alice)
+	aliceB, aliceBHash := newTestAddress(t, alice)
+	bobA, bobAHash := newTestAddress(t, bob)
+	bobB, bobBHash := newTestAddress(t, bob)
+	_, miner := newTestAddress(t, newTestWallets(t))
+	mineBlock(t, chainA, aliceAHash)
+	mineBlock(t, chainB, bobBHash)
+
+	// Alice initiates on chain A. Her contract refunds later than Bob's, so
+	// Bob still has time to redeem after she reveals the secret.
+	secret, secretHash, err := NewSwapSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractA := fundSwap(t, chainA, alice, aliceA, bobA, 10, secretHash, chainA.Height()+20, miner)
+
+	// Bob audits Alice's contract, then participates on chain B with her secret hash
+	sc, err := chainA.AuditSwap(contractA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Value != 10 || !bytes.Equal(sc.Recipient, bobAHash) || !bytes.Equal(sc.Refund, aliceAHash) || sc.Secret != nil {
+		t.Fatalf("audit of the initiator's contract: %+v", sc)
+	}
+	contractB := fundSwap(t, chainB, bob, bobB, aliceB, 5, sc.SecretHash, chainB.Height()+10, miner)
+
+	if _, err := NewTxBuilder(chainA, bob, nil).RedeemSwap(contractA, make([]byte, script.SecretSize), DefaultFeeRate); !errors.Is(err, ErrWrongSecret) {
+		t.Fatalf("redeem without the secret: error %v, want ErrWrongSecret", err)
+	}
+	if _, err := chainB.FindSwapSecret(contractB); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("secret found before the redeem: %v", err)
+	}
+
+	// Alice redeems Bob's contract on chain B, revealing the secret
+	redeemB, err := NewTxBuilder(chainB, alice, nil).RedeemSwap(contractB, secret, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, chainB, miner, redeemB)
+	if got := chainB.GetBalance(aliceBHash); got != redeemB.Vout[0].Value || got <= 5-0.01 {
+		t.Errorf("initiator balance on chain B %.8f after redeeming 5", got)
+	}
+
+	// Bob takes the secret from Alice's redeem and claims her contract on chain A
+	revealed, ok := script.ExtractHTLCSecret(redeemB.Vin[0].ScriptSig, contractB)
+	if !ok || !bytes.Equal(revealed, secret) {
+		t.Fatalf("extracted secret %x, want %x", revealed, secret)
+	}
+	if found, err := chainB.FindSwapSecret(contractB); err != nil || !bytes.Equal(found, secret) {
+		t.Fatalf("FindSwapSecret = %x, %v; want %x", found, err, secret)
+	}
+	redeemA, err := NewTxBuilder(chainA, bob, nil).RedeemSwap(contractA, revealed, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, chainA, miner, redeemA)
+	if got := chainA.GetBalance(bobAHash); got != redeemA.Vout[0].Value || got <= 10-0.01 {
+		t.Errorf("participant balance on chain A %.8f after redeeming 10", got)
+	}
+
+	for _, side := range []struct {
+		bc       *Blockchain
+		contract []byte
+	}{{chainA, contractA}, {chainB, contractB}} {
+		sc, err := side.bc.AuditSwap(side.contract)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sc.Value != 0 || !bytes.Equal(sc.Secret, secret) {
+			t.Errorf("contract %s after the swap: value %.8f, secret %x", sc.Address, sc.Value, sc.Secret)
+		}
+	}
+}
+
+func TestAtomicSwapRefund(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob := newTestWallets(t), newTestWallets(t)
+	aliceAddress, aliceHash := newTestAddress(t, alice)
+	bobAddress, _ := newTestAddress(t, bob)
+	_, miner := newTestAddress(t, newTestWallets(t))
+	mineBlock(t, bc, aliceHash)
+
+	secret, secretHash, err := NewSwapSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockTime := bc.Height() + 3
+	contract := fundSwap(t, bc, alice, aliceAddress, bobAddress, 10, secretHash, lockTime, miner)
+	if got := bc.GetBalance(aliceHash); got != 0 {
+		t.Fatalf("refund address holds %.8f before the refund", got)
+	}
+
+	// The next block is below the lock time
+	if _, err := NewTxBuilder(bc, alice, nil).RefundSwap(contract, DefaultFeeRate); !errors.Is(err, ErrNonFinal) {
+		t.Fatalf("refund before the lock time: error %v, want ErrNonFinal", err)
+	}
+	h, _ := script.ExtractHTLC(contract)
+	early, err := NewTxBuilder(bc, alice, nil).spendContract(contract, h.Refund, nil, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := nextBlock(bc, miner, early)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AppendBlock(block); err == nil {
+		t.Fatal("block with a refund before the lock time was accepted")
+	}
+
+	mineBlock(t, bc, miner)
+	refund, err := NewTxBuilder(bc, alice, nil).RefundSwap(contract, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock(t, bc, miner, refund)
+	if bc.Height() != lockTime {
+		t.Fatalf("refund mined at height %d, lock time %d", bc.Height(), lockTime)
+	}
+	if got := bc.GetBalance(aliceHash); got != refund.Vout[0].Value || got <= 10-0.01 {
+		t.Errorf("refund address holds %.8f after refunding 10", got)
+	}
+
+	// The recipient is too late even with the secret
+	if _, err := NewTxBuilder(bc, bob, nil).RedeemSwap(contract, secret, DefaultFeeRate); !errors.Is(err, ErrNoContractCoins) {
+		t.Errorf("redeem after the refund: error %v, want ErrNoContractCoins", err)
+	}
+}
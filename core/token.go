@@ -0,0 +1,340 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// Token settings. Every token output also locks TokenCarrierValue coins, so
+// token outputs are never dust and pay for their own place in the UTXO set.
+const (
+	TokenCarrierValue    = DustThreshold
+	MaxTokenNameSize     = 32
+	MaxTokenSymbolSize   = 12
+	MaxTokenMetadataSize = 256
+)
+
+// Errors returned for token transactions
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenConservation  = errors.New("token units of inputs and outputs differ")
+	ErrTokenNotFound      = errors.New("token not found")
+	ErrInsufficientTokens = errors.New("insufficient tokens")
+)
+
+// TokenIssuance defines a token created by a transaction. The whole supply
+// is paid to the outputs of the issuing transaction.
+type TokenIssuance struct {
+	Name        string
+	Symbol      string
+	Supply      uint64 // Token units in existence
+	Metadata    string // Free-form description, such as a URI
+	ContentHash []byte // SHA-256 of the content an NFT stands for, nil for fungible tokens
+}
+
+// IsNFT reports whether the issuance mints a non-fungible token: a single
+// unit bound to a content hash
+func (i *TokenIssuance) IsNFT() bool {
+	return i.ContentHash != nil
+}
+
+// Token is an issued token as recorded on the chain
+type Token struct {
+	TokenIssuance
+	ID     string
+	TxID   string // Issuing transaction
+	Height int64  // Block the issuing transaction is in
+}
+
+// NewTokenID returns the ID of the token issued by a transaction whose
+// first input spends txid:vout. An outpoint is spent once, so IDs are unique.
+func NewTokenID(txid string, vout int) string {
+	hash := sha256.Sum256([]byte(outpoint(txid, vout)))
+	return hex.EncodeToString(hash[:])
+}
+
+// IssuedTokenID returns the ID of the token tx issues, empty when it issues none
+func (tx *Transaction) IssuedTokenID() string {
+	if tx.Issuance == nil || len(tx.Vin) == 0 {
+		return ""
+	}
+	return NewTokenID(tx.Vin[0].Txid, tx.Vin[0].Vout)
+}
+
+// validate checks the supply and metadata limits of an issuance
+func (i *TokenIssuance) validate() error {
+	switch {
+	case i.Name == "" || len(i.Name) > MaxTokenNameSize:
+		return fmt.Errorf("%w: name must be 1 to %d bytes", ErrInvalidToken, MaxTokenNameSize)
+	case len(i.Symbol) > MaxTokenSymbolSize:
+		return fmt.Errorf("%w: symbol must be at most %d bytes", ErrInvalidToken, MaxTokenSymbolSize)
+	case len(i.Metadata) > MaxTokenMetadataSize:
+		return fmt.Errorf("%w: metadata must be at most %d bytes", ErrInvalidToken, MaxTokenMetadataSize)
+	case i.Supply == 0:
+		return fmt.Errorf("%w: supply must be positive", ErrInvalidToken)
+	case i.IsNFT() && len(i.ContentHash) != sha256.Size:
+		return fmt.Errorf("%w: content hash must be %d bytes", ErrInvalidToken, sha256.Size)
+	case i.IsNFT() && i.Supply != 1:
+		return fmt.Errorf("%w: an NFT has a supply of 1", ErrInvalidToken)
+	}
+	return nil
+}
+
+// addTokens adds the token units of out to totals, failing on malformed
+// token fields and on overflow
+func addTokens(totals map[string]uint64, out TxOutput) error {
+	if out.TokenID == "" && out.TokenAmount == 0 {
+		return nil
+	}
+	if id, err := hex.DecodeString(out.TokenID); err != nil || len(id) != sha256.Size {
+		return fmt.Errorf("%w: malformed token ID %q", ErrInvalidToken, out.TokenID)
+	}
+	if out.TokenAmount == 0 {
+		return fmt.Errorf("%w: output of token %s carries no units", ErrInvalidToken, out.TokenID)
+	}
+	sum, carry := bits.Add64(totals[out.TokenID], out.TokenAmount, 0)
+	if carry != 0 {
+		return fmt.Errorf("%w: units of token %s overflow", ErrInvalidToken, out.TokenID)
+	}
+	totals[out.TokenID] = sum
+	return nil
+}
+
+// CheckTokens returns an error unless tx conserves every token: each token
+// has as many units in the outputs as in the spent outputs, except the token
+// the transaction issues, whose outputs must hold exactly its supply
+func (bc *Blockchain) CheckTokens(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		if tx.Issuance != nil || tx.hasTokens() {
+			return fmt.Errorf("%w: coinbase %s cannot carry tokens", ErrInvalidToken, tx.ID)
+		}
+		return nil
+	}
+
+	in := make(map[string]uint64)
+	for _, vin := range tx.Vin {
+		prevTx, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			return err
+		}
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return fmt.Errorf("input %s:%d spends a missing output", vin.Txid, vin.Vout)
+		}
+		if err := addTokens(in, prevTx.Vout[vin.Vout]); err != nil {
+			return err
+		}
+	}
+	out := make(map[string]uint64)
+	for _, vout := range tx.Vout {
+		if err := addTokens(out, vout); err != nil {
+			return err
+		}
+	}
+
+	if issued := tx.IssuedTokenID(); issued != "" {
+		if err := tx.Issuance.validate(); err != nil {
+			return err
+		}
+		if out[issued] != tx.Issuance.Supply {
+			return fmt.Errorf("%w: %s issues %d units of token %s but its outputs hold %d",
+				ErrTokenConservation, tx.ID, tx.Issuance.Supply, issued, out[issued])
+		}
+		delete(out, issued)
+	}
+	for id, units := range out {
+		if in[id] != units {
+			return fmt.Errorf("%w: %s spends %d units of token %s but outputs %d", ErrTokenConservation, tx.ID, in[id], id, units)
+		}
+	}
+	for id, units := range in {
+		if _, ok := out[id]; !ok {
+			return fmt.Errorf("%w: %s spends %d units of token %s but outputs none", ErrTokenConservation, tx.ID, units, id)
+		}
+	}
+	return nil
+}
+
+// FindToken returns the issuance of a token
+func (bc *Blockchain) FindToken(id string) (*Token, error) {
+	for _, token := range bc.Tokens() {
+		if token.ID == id {
+			return token, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+}
+
+// Tokens returns every token issued on the chain, oldest first
+func (bc *Blockchain) Tokens() []*Token {
+	tokens := []*Token{}
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			if id := tx.IssuedTokenID(); id != "" {
+				tokens = append(tokens, &Token{TokenIssuance: *tx.Issuance, ID: id, TxID: tx.ID, Height: block.Index})
+			}
+		}
+	}
+	return tokens
+}
+
+// IssueToken builds a signed transaction creating a token and paying its
+// whole supply to the wallet at address from, which also pays the fee. The
+// index of the change output is returned with the transaction, -1 for none.
+func (b *TxBuilder) IssueToken(from string, issuance TokenIssuance, feeRate float64) (*Transaction, int, error) {
+	if err := issuance.validate(); err != nil {
+		return nil, -1, err
+	}
+	wallet, err := b.wallets.GetWallet(from)
+	if err != nil {
+		return nil, -1, err
+	}
+	tx := &Transaction{LockTime: b.lockTime, Issuance: &issuance}
+	tx.Vout = []TxOutput{{Value: TokenCarrierValue, PubKeyHash: crypto.PublicKeyHash(wallet.PublicKey), TokenAmount: issuance.Supply}}
+	issuanceSize := len(issuance.Name) + len(issuance.Symbol) + len(issuance.Metadata) + len(issuance.ContentHash) + 16
+	return b.fundTransaction(wallet, tx, nil, issuanceSize, feeRate)
+}
+
+// SendToken builds a signed transaction paying amount units of a token from
+// the wallet at address from to address to. Token change goes back to from
+// and the fee is paid with plain coins of from.
+func (b *TxBuilder) SendToken(from, to, tokenID string, amount uint64, feeRate float64) (*Transaction, int, error) {
+	recipient, err := NewRecipient(to, TokenCarrierValue)
+	if err != nil {
+		return nil, -1, err
+	}
+	return b.spendToken(from, recipient.output(), tokenID, amount, feeRate)
+}
+
+// BurnToken builds a signed transaction destroying amount units of a token
+// held by the wallet at address from. The units go to an OP_RETURN output,
+// which never enters the UTXO set.
+func (b *TxBuilder) BurnToken(from, tokenID string, amount uint64, feeRate float64) (*Transaction, int, error) {
+	burn, _ := script.NullData(nil)
+	return b.spendToken(from, TxOutput{Script: burn}, tokenID, amount, feeRate)
+}
+
+// spendToken builds a signed transaction moving amount units of a token
+// held by the wallet at address from to the output payment
+func (b *TxBuilder) spendToken(from string, payment TxOutput, tokenID string, amount uint64, feeRate float64) (*Transaction, int, error) {
+	if amount == 0 {
+		return nil, -1, errors.New("token amount must be positive")
+	}
+	wallet, err := b.wallets.GetWallet(from)
+	if err != nil {
+		return nil, -1, err
+	}
+	fromPubKeyHash := crypto.PublicKeyHash(wallet.PublicKey)
+
+	// Largest first, with ties broken by outpoint so selection is deterministic
+	var candidates []*UTXO
+	var available uint64
+	for _, utxo := range b.bc.UTXOSet.FindUTXOs(fromPubKeyHash) {
+		if utxo.TokenID != tokenID || !b.spendable(utxo) || (b.mempool != nil && b.mempool.IsSpent(utxo.TxID, utxo.Index)) {
+			continue
+		}
+		candidates = append(candidates, utxo)
+		available += utxo.TokenAmount
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].TokenAmount != candidates[j].TokenAmount {
+			return candidates[i].TokenAmount > candidates[j].TokenAmount
+		}
+		if candidates[i].TxID != candidates[j].TxID {
+			return candidates[i].TxID < candidates[j].TxID
+		}
+		return candidates[i].Index < candidates[j].Index
+	})
+	var selected []*UTXO
+	var units uint64
+	for _, utxo := range candidates {
+		if units >= amount {
+			break
+		}
+		selected = append(selected, utxo)
+		units += utxo.TokenAmount
+	}
+	if units < amount {
+		return nil, -1, fmt.Errorf("%w: have %d units of token %s, need %d", ErrInsufficientTokens, available, tokenID, amount)
+	}
+
+	tx := &Transaction{LockTime: b.lockTime}
+	payment.TokenID, payment.TokenAmount = tokenID, amount
+	tx.Vout = append(tx.Vout, payment)
+	if units > amount {
+		tx.Vout = append(tx.Vout, TxOutput{Value: TokenCarrierValue, PubKeyHash: fromPubKeyHash, TokenID: tokenID, TokenAmount: units - amount})
+	}
+	return b.fundTransaction(wallet, tx, selected, 0, feeRate)
+}
+
+// tokenFieldsSize estimates the serialized size of the token fields of an output
+const tokenFieldsSize = 2*sha256.Size + 6
+
+// fundTransaction adds tokenInputs, which may be empty, and coins of wallet
+// paying the outputs of tx and its fee, then sets the issued token ID if any
+// and signs tx. It funds the token, NFT and data transactions of the
+// builder. The coins locked in spent token outputs go to the change.
+// extraSize is the estimated size of transaction fields the fee must also
+// cover. It returns tx with the index of its change output, -1 for none.
+func (b *TxBuilder) fundTransaction(wallet *crypto.Wallet, tx *Transaction, tokenInputs []*UTXO, extraSize int, feeRate float64) (*Transaction, int, error) {
+	if feeRate < 0 {
+		return nil, -1, fmt.Errorf("fee rate must not be negative, got %.8f", feeRate)
+	}
+	fromPubKeyHash := crypto.PublicKeyHash(wallet.PublicKey)
+	var payment, carried int64
+	for _, vout := range tx.Vout {
+		payment += toUnits(vout.Value)
+	}
+	for _, utxo := range tokenInputs {
+		carried += toUnits(utxo.Value)
+	}
+	size := len(tokenInputs)*txInputSize + extraSize
+	if tx.hasTokens() {
+		size += len(tx.Vout) * tokenFieldsSize
+	}
+	payment += feeForSize(feeRate, size)
+
+	selected, change, err := b.selectCoins(fromPubKeyHash, b.spendable, txInputSize, payment, len(tx.Vout), feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+	for _, utxo := range tokenInputs {
+		tx.Vin = append(tx.Vin, TxInput{Txid: utxo.TxID, Vout: utxo.Index, PubKey: wallet.PublicKey, Sequence: b.sequence})
+	}
+	for _, c := range selected {
+		tx.Vin = append(tx.Vin, TxInput{Txid: c.utxo.TxID, Vout: c.utxo.Index, PubKey: wallet.PublicKey, Sequence: b.sequence})
+	}
+	if id := tx.IssuedTokenID(); id != "" {
+		for i := range tx.Vout {
+			if tx.Vout[i].TokenAmount > 0 && tx.Vout[i].TokenID == "" {
+				tx.Vout[i].TokenID = id
+			}
+		}
+	}
+
+	// Coin selection only priced a change output when it made one
+	if change == 0 && carried > 0 {
+		carried -= feeForSize(feeRate, txOutputSize)
+	}
+	changeIndex := -1
+	if change += carried; change >= toUnits(DustThreshold) {
+		changePubKeyHash, err := b.changePubKeyHash()
+		if err != nil {
+			return nil, -1, err
+		}
+		changeIndex = len(tx.Vout)
+		tx.Vout = append(tx.Vout, TxOutput{Value: fromUnits(change), PubKeyHash: changePubKeyHash})
+	}
+
+	tx.SetID()
+	if err := b.bc.SignTransaction(tx, wallet); err != nil {
+		return nil, -1, err
+	}
+	return tx, changeIndex, nil
+}
@@ -2,13 +2,19 @@ package core
 
 import (
 	"bytes" // Import bytes
-	"crypto/ecdsa"
 	"crypto/sha256"
-	"encoding/gob" // Import encoding/gob
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"time"
 
+	"aztecs/core/script"
 	"aztecs/crypto" // Import crypto package
+	"aztecs/params"
 )
 
 // TxInput represents a transaction input
@@ -17,95 +23,399 @@ type TxInput struct {
 	Vout      int    // Index of the output in the transaction
 	Signature []byte // Signature to unlock the output
 	PubKey    []byte // Public key of the sender
+	ScriptSig []byte // Unlocking script, built from Signature and PubKey when empty
+	Sequence  uint32 // Relative lock time, see SequenceFinal
 }
 
 // TxOutput represents a transaction output
 type TxOutput struct {
-	Value   float64 // Value of the output
-	PubKeyHash []byte // Hash of the recipient's public key
+	Value       float64 // Value of the output
+	PubKeyHash  []byte  // Hash of the recipient's public key
+	Script      []byte  // Locking script, pay to PubKeyHash when empty
+	TokenID     string  // Hex ID of the token the output carries, empty for plain coins
+	TokenAmount uint64  // Token units carried, next to Value coins
 }
 
+// Tags of the optional sections that follow the original transaction layout.
+// A section is only written when one of its fields is set, so transactions
+// that do not use it keep their IDs.
+const (
+	tagScripts  = 1 // Unlocking scripts of every input, then locking scripts of every output
+	tagLockTime = 2 // Lock time, then the sequence number of every input
+	tagTokens   = 3 // Token ID and amount of every output
+	tagIssuance = 4 // Token created by the transaction
+	tagContent  = 5 // Content hash of the NFT the transaction mints
+)
+
 // Transaction represents a transaction in the blockchain
 type Transaction struct {
-	ID   string
-	Vin  []TxInput  // Transaction inputs
-	Vout []TxOutput // Transaction outputs
+	ID       string
+	Vin      []TxInput      // Transaction inputs
+	Vout     []TxOutput     // Transaction outputs
+	LockTime int64          // First block height, or Unix time from 500000000, the transaction may be mined at; 0 for none
+	Issuance *TokenIssuance // Token created by the transaction, nil for none
 }
 
-// CalculateHash calculates the hash of the transaction
-// SetID calculates and sets the ID of the transaction
+// SetID sets the ID of the transaction, see CalculateHash
 func (tx *Transaction) SetID() {
-	// TODO: Include Vin and Vout in the hash calculation
-	// For now, a simplified hash
-	var encoded bytes.Buffer
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		log.Panic(err)
-	}
-	hash := sha256.Sum256(encoded.Bytes())
-	tx.ID = hex.EncodeToString(hash[:])
-}
-
-// CalculateHash calculates the hash of the transaction
-// This method is similar to SetID but returns the hash instead of setting the ID.
-// It might be redundant if SetID is always called after creating a transaction.
-// Let's keep it for now but consider if it's needed.
+	tx.ID = tx.CalculateHash()
+}
+
+// CalculateHash returns the ID tx must carry: the hash of its serialization
+// with the ID cleared and without the signatures, keys and unlocking
+// scripts of its inputs, which are filled in after the ID is set. Coinbase
+// inputs keep their data, which tells coinbases paying the same apart.
 func (tx *Transaction) CalculateHash() string {
-	// TODO: Include Vin and Vout in the hash calculation
-	// For now, a simplified hash
-	var encoded bytes.Buffer
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		log.Panic(err)
-	}
-	hash := sha256.Sum256(encoded.Bytes())
+	txCopy := *tx
+	txCopy.ID = ""
+	txCopy.Vin = make([]TxInput, len(tx.Vin))
+	for i, vin := range tx.Vin {
+		if !tx.IsCoinbase() {
+			vin.PubKey = nil
+		}
+		vin.Signature, vin.ScriptSig = nil, nil
+		txCopy.Vin[i] = vin
+	}
+	hash := sha256.Sum256(txCopy.Serialize())
 	return hex.EncodeToString(hash[:])
 }
 
-// Sign signs the transaction with the private key
-// TODO: Implement actual signing with ECC
-// Sign signs the transaction with the private key
-// TODO: Implement actual signing of transaction inputs
-func (tx *Transaction) Sign(privateKey *ecdsa.PrivateKey) {
-	// This signing logic needs to be updated to sign transaction inputs.
-	// For now, this is a placeholder.
-	log.Println("Transaction signing is a placeholder.")
-	// Example (illustrative, needs proper implementation):
-	/*
-		txCopy := tx.TrimmedCopy() // Create a copy without signatures and public keys
-		for i, vin := range txCopy.Vin {
-			// Get the public key hash of the output being spent by this input
-			// This requires looking up the previous transaction (vin.Txid)
-			// and the specific output (vin.Vout).
-			// This logic depends on having access to the blockchain or UTXO set.
-
-			// For now, let's use a placeholder signature
-			signature := []byte("placeholder_signature") // Replace with actual signature
+// Serialize encodes the transaction in a fixed binary layout. Hashes must not
+// be taken over gob output, which depends on the order in which the process
+// first encoded its types.
+func (tx *Transaction) Serialize() []byte {
+	var buf bytes.Buffer
+	writeUvarint := func(v uint64) {
+		buf.Write(binary.AppendUvarint(nil, v))
+	}
+	writeBytes := func(b []byte) {
+		writeUvarint(uint64(len(b)))
+		buf.Write(b)
+	}
+
+	writeBytes([]byte(tx.ID))
+	writeUvarint(uint64(len(tx.Vin)))
+	for _, vin := range tx.Vin {
+		writeBytes([]byte(vin.Txid))
+		buf.Write(binary.AppendVarint(nil, int64(vin.Vout)))
+		writeBytes(vin.Signature)
+		writeBytes(vin.PubKey)
+	}
+	writeUvarint(uint64(len(tx.Vout)))
+	for _, vout := range tx.Vout {
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(vout.Value)))
+		writeBytes(vout.PubKeyHash)
+	}
+
+	if tx.hasScripts() {
+		writeUvarint(tagScripts)
+		for _, vin := range tx.Vin {
+			writeBytes(vin.ScriptSig)
+		}
+		for _, vout := range tx.Vout {
+			writeBytes(vout.Script)
+		}
+	}
+	if tx.hasLockTime() {
+		writeUvarint(tagLockTime)
+		buf.Write(binary.AppendVarint(nil, tx.LockTime))
+		for _, vin := range tx.Vin {
+			writeUvarint(uint64(vin.Sequence))
+		}
+	}
+	if tx.hasTokens() {
+		writeUvarint(tagTokens)
+		for _, vout := range tx.Vout {
+			writeBytes([]byte(vout.TokenID))
+			writeUvarint(vout.TokenAmount)
+		}
+	}
+	if tx.Issuance != nil {
+		writeUvarint(tagIssuance)
+		writeBytes([]byte(tx.Issuance.Name))
+		writeBytes([]byte(tx.Issuance.Symbol))
+		writeUvarint(tx.Issuance.Supply)
+		writeBytes([]byte(tx.Issuance.Metadata))
+	}
+	if tx.Issuance != nil && tx.Issuance.ContentHash != nil {
+		writeUvarint(tagContent)
+		writeBytes(tx.Issuance.ContentHash)
+	}
+	return buf.Bytes()
+}
+
+// DeserializeTransaction decodes a transaction encoded by Serialize
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	r := &txReader{r: bytes.NewReader(data)}
+	tx := &Transaction{ID: string(r.bytes())}
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		tx.Vin = append(tx.Vin, TxInput{Txid: string(r.bytes()), Vout: int(r.varint()), Signature: r.bytes(), PubKey: r.bytes()})
+	}
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		tx.Vout = append(tx.Vout, TxOutput{Value: math.Float64frombits(r.uint64()), PubKeyHash: r.bytes()})
+	}
+
+	for r.err == nil && r.r.Len() > 0 {
+		switch tag := r.uvarint(); tag {
+		case tagScripts:
+			for i := range tx.Vin {
+				tx.Vin[i].ScriptSig = r.bytes()
+			}
+			for i := range tx.Vout {
+				tx.Vout[i].Script = r.bytes()
+			}
+		case tagLockTime:
+			tx.LockTime = r.varint()
+			for i := range tx.Vin {
+				tx.Vin[i].Sequence = uint32(r.uvarint())
+			}
+		case tagTokens:
+			for i := range tx.Vout {
+				tx.Vout[i].TokenID = string(r.bytes())
+				tx.Vout[i].TokenAmount = r.uvarint()
+			}
+		case tagIssuance:
+			tx.Issuance = &TokenIssuance{Name: string(r.bytes()), Symbol: string(r.bytes()), Supply: r.uvarint(), Metadata: string(r.bytes())}
+		case tagContent:
+			if tx.Issuance == nil {
+				r.fail(errors.New("content hash without an issuance"))
+				break
+			}
+			tx.Issuance.ContentHash = r.bytes()
+		default:
+			r.fail(fmt.Errorf("unknown section %d", tag))
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed transaction: %w", r.err)
+	}
+	return tx, nil
+}
+
+// txReader reads the fields written by Serialize, keeping the first error
+type txReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *txReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *txReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	r.fail(err)
+	return v
+}
+
+func (r *txReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r.r)
+	r.fail(err)
+	return v
+}
+
+func (r *txReader) uint64() uint64 {
+	var b [8]byte
+	if r.err == nil {
+		_, err := io.ReadFull(r.r, b[:])
+		r.fail(err)
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// bytes reads a length prefixed field, returning nil for empty ones
+func (r *txReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+	if n > uint64(r.r.Len()) {
+		r.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := make([]byte, n)
+	r.r.Read(b)
+	return b
+}
+
+// hasScripts reports whether any input or output carries an explicit script
+func (tx *Transaction) hasScripts() bool {
+	for _, vin := range tx.Vin {
+		if len(vin.ScriptSig) > 0 {
+			return true
+		}
+	}
+	for _, vout := range tx.Vout {
+		if len(vout.Script) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLockTime reports whether the transaction has a lock time or any input a sequence number
+func (tx *Transaction) hasLockTime() bool {
+	if tx.LockTime != 0 {
+		return true
+	}
+	for _, vin := range tx.Vin {
+		if vin.Sequence != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTokens reports whether any output carries tokens
+func (tx *Transaction) hasTokens() bool {
+	for _, vout := range tx.Vout {
+		if vout.TokenID != "" || vout.TokenAmount != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign signs each input of the transaction with the key of wallet.
+// prevTXs must contain every transaction referenced by the inputs. Outputs
+// locked to a public key hash, with or without a time lock, and outputs
+// locked to a bare public key can be signed.
+func (tx *Transaction) Sign(wallet *crypto.Wallet, prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil // Coinbase transactions have nothing to sign
+	}
+
+	for _, vin := range tx.Vin {
+		if _, ok := prevTXs[vin.Txid]; !ok {
+			return fmt.Errorf("previous transaction %s not found", vin.Txid)
+		}
+	}
+
+	for i, vin := range tx.Vin {
+		prevTx := prevTXs[vin.Txid]
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return fmt.Errorf("input %d spends missing output %s:%d", i, vin.Txid, vin.Vout)
+		}
+		prevOut := prevTx.Vout[vin.Vout]
+
+		signature, err := wallet.Sign(tx.SignatureHash(i, prevOut))
+		if err != nil {
+			return err
+		}
+		switch script.Classify(prevOut.LockingScript()) {
+		case script.PubKeyHashTy, script.LockedPubKeyHashTy:
 			tx.Vin[i].Signature = signature
-			tx.Vin[i].PubKey = privateKey.PublicKey.X.Bytes() // Placeholder for public key
+		case script.PubKeyTy:
+			tx.Vin[i].ScriptSig = script.UnlockPubKey(signature)
+		default:
+			return fmt.Errorf("input %d spends %s:%d with a non-standard locking script", i, vin.Txid, vin.Vout)
 		}
-	*/
+	}
+	return nil
 }
 
-// IsValid checks if the transaction is valid
-// TODO: Implement actual verification with ECC
-// IsValid checks if the transaction is valid
-// TODO: Implement actual transaction validation using UTXO set
-func (tx *Transaction) IsValid() bool {
-	// This validation logic needs to be updated to verify transaction inputs.
-	// For now, this is a placeholder.
-	log.Println("Transaction validation is a placeholder.")
-	// In a real implementation, you would:
-	// - Verify that the sum of input values equals the sum of output values (minus fees).
-	// - Verify the signature of each input against the public key hash in the corresponding output.
-	// - Ensure that the inputs are actually unspent outputs in the UTXO set.
+// Verify runs the scripts of all transaction inputs for a spend in the block
+// at height with the given timestamp, which time locks are checked against.
+// prevTXs must contain every transaction referenced by the inputs.
+func (tx *Transaction) Verify(prevTXs map[string]Transaction, height int64, timestamp time.Time) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+
+	for i, vin := range tx.Vin {
+		prevTx, ok := prevTXs[vin.Txid]
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			log.Printf("Input %d of %s spends an unknown output", i, tx.ID)
+			return false
+		}
+		prevOut := prevTx.Vout[vin.Vout]
 
-	// Placeholder: Always return true for now
+		checker := &txChecker{hash: tx.SignatureHash(i, prevOut), height: height, time: timestamp.Unix(), sequence: vin.Sequence}
+		if err := script.Verify(vin.UnlockingScript(), prevOut.LockingScript(), checker); err != nil {
+			log.Printf("Input %d of %s fails its script: %v", i, tx.ID, err)
+			return false
+		}
+	}
 	return true
 }
 
+// SignatureHash returns the digest signed by input index when it spends
+// prevOut. It covers the transaction without any signatures, with the
+// locking condition of prevOut in place of the input's public key.
+func (tx *Transaction) SignatureHash(index int, prevOut TxOutput) []byte {
+	txCopy := tx.TrimmedCopy()
+	if len(prevOut.Script) > 0 {
+		txCopy.Vin[index].PubKey = prevOut.Script
+	} else {
+		txCopy.Vin[index].PubKey = prevOut.PubKeyHash
+	}
+	return txCopy.signatureHash()
+}
+
+// txChecker gives scripts access to the transaction being verified
+type txChecker struct {
+	hash     []byte // Signature hash of the input
+	height   int64  // Height of the block the spend is in
+	time     int64  // Unix time of the block the spend is in
+	sequence uint32 // Sequence number of the input
+}
+
+func (c *txChecker) CheckSig(sig, pubKey []byte) bool {
+	return crypto.VerifySignature(pubKey, c.hash, sig)
+}
+
+func (c *txChecker) CheckLockTime(lockTime int64) bool {
+	return lockTimeReached(lockTime, c.height, c.time)
+}
+
+func (c *txChecker) CheckSequence(blocks int64) bool {
+	lock, ok := relativeLock(c.sequence)
+	return ok && lock >= blocks
+}
+
+// signatureHash returns the digest signed for the current state of a
+// trimmed copy, which holds the key or script of the input being signed
+func (tx *Transaction) signatureHash() []byte {
+	hash := sha256.Sum256(tx.Serialize())
+	return hash[:]
+}
+
+// NewCoinbaseTX creates a transaction that pays the reward of the block at height to pubKeyHash
+func NewCoinbaseTX(pubKeyHash []byte, data string, height int64) *Transaction {
+	return NewCoinbaseTXWithFees(pubKeyHash, data, height, 0)
+}
+
+// NewCoinbaseTXWithFees creates a coinbase paying the block reward plus the
+// fees of the other transactions in the block
+func NewCoinbaseTXWithFees(pubKeyHash []byte, data string, height int64, fees float64) *Transaction {
+	if data == "" {
+		data = fmt.Sprintf("Reward to %x at %d", pubKeyHash, time.Now().UnixNano())
+	}
+	tx := &Transaction{
+		Vin: []TxInput{
+			{Txid: "", Vout: -1, Signature: nil, PubKey: []byte(data)}, // Coinbase input
+		},
+		Vout: []TxOutput{
+			{Value: params.Active.BlockSubsidy(height) + fees, PubKeyHash: pubKeyHash},
+		},
+	}
+	tx.SetID()
+	return tx
+}
+
+// Size returns the length of the serialized transaction in bytes
+func (tx *Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
 // IsCoinbase checks if a transaction is a coinbase transaction
 func (tx *Transaction) IsCoinbase() bool {
 	// A coinbase transaction has only one input, and its Txid is empty
@@ -114,17 +424,17 @@ func (tx *Transaction) IsCoinbase() bool {
 }
 
 // TrimmedCopy creates a trimmed copy of the transaction for signing
-// This copy excludes signatures and public keys from inputs.
+// This copy excludes signatures, public keys and unlocking scripts from inputs.
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TxInput
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TxInput{Txid: vin.Txid, Vout: vin.Vout, Signature: nil, PubKey: nil})
+		inputs = append(inputs, TxInput{Txid: vin.Txid, Vout: vin.Vout, Signature: nil, PubKey: nil, Sequence: vin.Sequence})
 	}
 	var outputs []TxOutput
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, TxOutput{Value: vout.Value, PubKeyHash: vout.PubKeyHash})
+		outputs = append(outputs, TxOutput{Value: vout.Value, PubKeyHash: vout.PubKeyHash, Script: vout.Script, TokenID: vout.TokenID, TokenAmount: vout.TokenAmount})
 	}
-	return Transaction{ID: tx.ID, Vin: inputs, Vout: outputs}
+	return Transaction{ID: tx.ID, Vin: inputs, Vout: outputs, LockTime: tx.LockTime, Issuance: tx.Issuance}
 }
 
 // UsesKey checks if the input's public key hash is the same as the provided public key hash
@@ -142,4 +452,26 @@ func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
 func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 	// Compare the output's PubKeyHash with the provided pubKeyHash
 	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
-}
\ No newline at end of file
+}
+
+// UnlockingScript returns the script that unlocks the spent output
+func (in *TxInput) UnlockingScript() []byte {
+	if len(in.ScriptSig) > 0 {
+		return in.ScriptSig
+	}
+	return script.UnlockPubKeyHash(in.Signature, in.PubKey)
+}
+
+// LockingScript returns the script that locks the output
+func (out *TxOutput) LockingScript() []byte {
+	if len(out.Script) > 0 {
+		return out.Script
+	}
+	return script.PayToPubKeyHash(out.PubKeyHash)
+}
+
+// NewScriptOutput creates an output locked by lockingScript. PubKeyHash is
+// set to the key hash a standard script pays to, so wallets find the output.
+func NewScriptOutput(value float64, lockingScript []byte) TxOutput {
+	return TxOutput{Value: value, PubKeyHash: script.ExtractPubKeyHash(lockingScript), Script: lockingScript}
+}
@@ -0,0 +1,412 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"aztecs/core/script"
+	"aztecs/crypto"
+)
+
+// Fee and coin selection settings. Amounts are compared in whole units of
+// 1e-8 coins so rounding never makes a selection come out short.
+const (
+	CoinUnits      = 1e8        // Smallest units per coin
+	DefaultFeeRate = 0.0001     // Coins per 1000 bytes
+	DustThreshold  = 0.00000546 // Change below this is added to the fee instead
+
+	// Estimated serialized sizes, used to price a transaction before it is signed
+	txOverheadSize = 67
+	txInputSize    = 196
+	txOutputSize   = 29
+
+	bnbMaxTries = 100000 // Search steps before branch and bound gives up
+)
+
+// ErrInsufficientFunds is matched by errors.Is for every InsufficientFundsError
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// InsufficientFundsError reports that the spendable coins of a wallet cannot
+// cover the payment and its fee
+type InsufficientFundsError struct {
+	Available float64 // Value of the spendable coins
+	Required  float64 // Payment plus the fee of spending every coin
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient funds: have %.8f, need %.8f", e.Available, e.Required)
+}
+
+// Is makes errors.Is(err, ErrInsufficientFunds) match
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// Recipient is one payment of a transaction
+type Recipient struct {
+	PubKeyHash []byte
+	Amount     float64
+	Script     []byte // Locking script, pay to PubKeyHash when empty
+}
+
+// NewRecipient creates a payment to an address, locking it to the script
+// hash for script addresses
+func NewRecipient(address string, amount float64) (Recipient, error) {
+	version, hash, err := crypto.DecodeAddress(address)
+	if err != nil {
+		return Recipient{}, err
+	}
+	if crypto.IsScriptAddress(version) {
+		return Recipient{PubKeyHash: hash, Amount: amount, Script: script.PayToScriptHash(hash)}, nil
+	}
+	return Recipient{PubKeyHash: hash, Amount: amount}, nil
+}
+
+// NewLockedRecipient creates a payment to a key address that can only be
+// spent from lockTime on, a block height below 500000000 and a Unix time
+// otherwise. A lockTime of 0 creates an ordinary payment like NewRecipient.
+func NewLockedRecipient(address string, amount float64, lockTime int64) (Recipient, error) {
+	if lockTime == 0 {
+		return NewRecipient(address, amount)
+	}
+	if lockTime < 0 {
+		return Recipient{}, fmt.Errorf("lock time must not be negative, got %d", lockTime)
+	}
+	pubKeyHash, err := crypto.DecodeKeyAddress(address)
+	if err != nil {
+		return Recipient{}, err
+	}
+	return Recipient{PubKeyHash: pubKeyHash, Amount: amount, Script: script.PayToPubKeyHashAfter(pubKeyHash, lockTime)}, nil
+}
+
+// output returns the transaction output paying r
+func (r Recipient) output() TxOutput {
+	if len(r.Script) > 0 {
+		return NewScriptOutput(r.Amount, r.Script)
+	}
+	return TxOutput{Value: r.Amount, PubKeyHash: r.PubKeyHash}
+}
+
+// TxBuilder builds signed transactions spending the coins of a wallet
+type TxBuilder struct {
+	bc       *Blockchain
+	wallets  *crypto.Wallets
+	mempool  *Mempool // Outputs spent by mempool transactions are skipped, may be nil
+	lockTime int64    // Lock time of built transactions, 0 for none
+	sequence uint32   // Sequence number of every input
+}
+
+// NewTxBuilder creates a builder spending coins of bc held by wallets
+func NewTxBuilder(bc *Blockchain, wallets *crypto.Wallets, mempool *Mempool) *TxBuilder {
+	return &TxBuilder{bc: bc, wallets: wallets, mempool: mempool}
+}
+
+// WithLockTime makes the builder create transactions that cannot be mined
+// before lockTime, a block height below 500000000 and a Unix time otherwise
+func (b *TxBuilder) WithLockTime(lockTime int64) *TxBuilder {
+	b.lockTime = lockTime
+	return b
+}
+
+// WithSequence sets the sequence number of every input of built
+// transactions, a relative lock time in blocks unless it has
+// SequenceLockTimeDisabled set
+func (b *TxBuilder) WithSequence(sequence uint32) *TxBuilder {
+	b.sequence = sequence
+	return b
+}
+
+// coin is a spendable output considered by coin selection
+type coin struct {
+	utxo      *UTXO
+	value     int64 // Value in units
+	effective int64 // Value minus the fee of spending it
+}
+
+// toUnits converts coins to whole units
+func toUnits(amount float64) int64 {
+	return int64(math.Round(amount * CoinUnits))
+}
+
+// fromUnits converts whole units to coins
+func fromUnits(units int64) float64 {
+	return float64(units) / CoinUnits
+}
+
+// feeForSize returns the fee of size bytes at feeRate coins per 1000 bytes
+func feeForSize(feeRate float64, size int) int64 {
+	return int64(math.Ceil(feeRate * float64(size) / 1000 * CoinUnits))
+}
+
+// Build creates a transaction paying recipients from the wallet at address
+// from, with a fee of feeRate coins per 1000 bytes. Coins are chosen by
+// branch and bound to avoid change, falling back to largest first. Change
+// goes to a fresh address of the wallet, which is saved. The returned
+// transaction is signed and ready for the mempool, and comes with the index
+// of its change output, -1 when it has none.
+func (b *TxBuilder) Build(from string, recipients []Recipient, feeRate float64) (*Transaction, int, error) {
+	payment, err := checkPayment(recipients, feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	wallet, err := b.wallets.GetWallet(from)
+	if err != nil {
+		return nil, -1, err
+	}
+	fromPubKeyHash := crypto.PublicKeyHash(wallet.PublicKey)
+
+	selected, change, err := b.selectCoins(fromPubKeyHash, b.spendable, txInputSize, payment, len(recipients), feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	tx := &Transaction{LockTime: b.lockTime}
+	for _, c := range selected {
+		tx.Vin = append(tx.Vin, TxInput{Txid: c.utxo.TxID, Vout: c.utxo.Index, Signature: nil, PubKey: wallet.PublicKey, Sequence: b.sequence})
+	}
+	for _, r := range recipients {
+		tx.Vout = append(tx.Vout, r.output())
+	}
+	changeIndex := -1
+	if change > 0 {
+		changePubKeyHash, err := b.changePubKeyHash()
+		if err != nil {
+			return nil, -1, err
+		}
+		changeIndex = len(tx.Vout)
+		tx.Vout = append(tx.Vout, TxOutput{Value: fromUnits(change), PubKeyHash: changePubKeyHash})
+	}
+
+	tx.SetID()
+	if err := b.bc.SignTransaction(tx, wallet); err != nil {
+		return nil, -1, err
+	}
+	return tx, changeIndex, nil
+}
+
+// BuildUnsigned creates a transaction paying recipients from address from
+// without signing it, to be signed elsewhere through a PSBT. The wallet only
+// needs to know the address: a multisig address with its redeem script, a
+// watch-only address or a key of a locked wallet. Change goes back to from;
+// its index is returned with the transaction, -1 when there is none.
+func (b *TxBuilder) BuildUnsigned(from string, recipients []Recipient, feeRate float64) (*Transaction, int, error) {
+	version, fromPubKeyHash, err := crypto.DecodeAddress(from)
+	if err != nil {
+		return nil, -1, err
+	}
+	if crypto.IsScriptAddress(version) {
+		return b.BuildMultisig(from, recipients, feeRate)
+	}
+	payment, err := checkPayment(recipients, feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+	if _, ok := b.wallets.GetWatchOnly(from); !ok && !b.wallets.HasAddress(from) {
+		return nil, -1, fmt.Errorf("%w: %s", crypto.ErrWalletNotFound, from)
+	}
+	pubKey, _ := b.wallets.FindPublicKey(from) // Unknown for watch-only addresses imported without a key
+
+	selected, change, err := b.selectCoins(fromPubKeyHash, b.spendable, txInputSize, payment, len(recipients), feeRate)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	tx := &Transaction{LockTime: b.lockTime}
+	for _, c := range selected {
+		tx.Vin = append(tx.Vin, TxInput{Txid: c.utxo.TxID, Vout: c.utxo.Index, PubKey: pubKey, Sequence: b.sequence})
+	}
+	for _, r := range recipients {
+		tx.Vout = append(tx.Vout, r.output())
+	}
+	changeIndex := -1
+	if change > 0 {
+		changeIndex = len(tx.Vout)
+		tx.Vout = append(tx.Vout, TxOutput{Value: fromUnits(change), PubKeyHash: fromPubKeyHash})
+	}
+	tx.SetID()
+	return tx, changeIndex, nil
+}
+
+// checkPayment validates recipients and feeRate and returns the total paid in units
+func checkPayment(recipients []Recipient, feeRate float64) (int64, error) {
+	if len(recipients) == 0 {
+		return 0, errors.New("transaction needs at least one recipient")
+	}
+	if feeRate < 0 {
+		return 0, fmt.Errorf("fee rate must not be negative, got %.8f", feeRate)
+	}
+	var payment int64
+	for _, r := range recipients {
+		if r.Amount <= 0 {
+			return 0, fmt.Errorf("amount must be positive, got %.8f", r.Amount)
+		}
+		payment += toUnits(r.Amount)
+	}
+	return payment, nil
+}
+
+// selectCoins chooses plain coin outputs locked to pubKeyHash that pass
+// spendable to pay payment to outputs recipients, where spending one coin adds inputSize
+// bytes. It returns the coins and the change in units, 0 for no change.
+func (b *TxBuilder) selectCoins(pubKeyHash []byte, spendable func(*UTXO) bool, inputSize int, payment int64, outputs int, feeRate float64) ([]coin, int64, error) {
+	inputFee := feeForSize(feeRate, inputSize)
+	changeFee := feeForSize(feeRate, txOutputSize)
+	target := payment + feeForSize(feeRate, txOverheadSize+outputs*txOutputSize)
+
+	var coins []coin
+	var available int64
+	for _, utxo := range b.bc.UTXOSet.FindUTXOs(pubKeyHash) {
+		if b.mempool != nil && b.mempool.IsSpent(utxo.TxID, utxo.Index) {
+			continue
+		}
+		if utxo.TokenID != "" || !spendable(utxo) {
+			continue // Token outputs are only spent by token transfers
+		}
+		c := coin{utxo: utxo, value: toUnits(utxo.Value)}
+		c.effective = c.value - inputFee
+		available += c.value
+		if c.effective > 0 {
+			coins = append(coins, c)
+		}
+	}
+	// Largest first, with ties broken by outpoint so selection is deterministic
+	sort.Slice(coins, func(i, j int) bool {
+		if coins[i].effective != coins[j].effective {
+			return coins[i].effective > coins[j].effective
+		}
+		if coins[i].utxo.TxID != coins[j].utxo.TxID {
+			return coins[i].utxo.TxID < coins[j].utxo.TxID
+		}
+		return coins[i].utxo.Index < coins[j].utxo.Index
+	})
+
+	// Spending change later costs an input, so a change output is only worth
+	// making when the excess covers both
+	selected, change := selectBnB(coins, target, changeFee+inputFee), int64(0)
+	if selected == nil {
+		if selected, change = selectLargestFirst(coins, target, changeFee); selected == nil {
+			return nil, 0, &InsufficientFundsError{
+				Available: fromUnits(available),
+				Required:  fromUnits(target + int64(len(coins))*inputFee),
+			}
+		}
+	}
+	return selected, change, nil
+}
+
+// spendable reports whether the wallet key alone can spend utxo in the next
+// block. Time locked outputs count once their lock time has passed.
+func (b *TxBuilder) spendable(utxo *UTXO) bool {
+	if len(utxo.Script) == 0 {
+		return true
+	}
+	switch script.Classify(utxo.Script) {
+	case script.PubKeyHashTy, script.PubKeyTy:
+		return true
+	case script.LockedPubKeyHashTy:
+		lockTime, _ := script.ExtractLockTime(utxo.Script)
+		checker := txChecker{height: b.bc.Height() + 1, time: time.Now().Unix()}
+		return checker.CheckLockTime(lockTime)
+	default:
+		return false
+	}
+}
+
+// changePubKeyHash creates a fresh change address in the wallet and saves it
+func (b *TxBuilder) changePubKeyHash() ([]byte, error) {
+	var address string
+	var err error
+	if b.wallets.IsHD() {
+		address, err = b.wallets.NewChangeAddress()
+	} else {
+		address, err = b.wallets.AddWallet()
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.wallets.SaveToFile()
+
+	wallet, err := b.wallets.GetWallet(address)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.PublicKeyHash(wallet.PublicKey), nil
+}
+
+// selectBnB searches for coins whose effective value lands between target and
+// target+costOfChange, so the transaction needs no change. Among the matches
+// it picks the one wasting the least. coins must be sorted largest first.
+func selectBnB(coins []coin, target, costOfChange int64) []coin {
+	var remaining int64
+	for _, c := range coins {
+		remaining += c.effective
+	}
+	if remaining < target {
+		return nil
+	}
+
+	var best []bool
+	bestWaste := int64(math.MaxInt64)
+	current := make([]bool, len(coins))
+	tries := 0
+
+	var search func(i int, value, remaining int64)
+	search = func(i int, value, remaining int64) {
+		tries++
+		if tries > bnbMaxTries || value > target+costOfChange {
+			return
+		}
+		if value >= target {
+			if waste := value - target; waste < bestWaste {
+				bestWaste = waste
+				best = append([]bool{}, current...)
+			}
+			return
+		}
+		if i == len(coins) || value+remaining < target {
+			return
+		}
+
+		// Try including the coin first, then leaving it out
+		remaining -= coins[i].effective
+		current[i] = true
+		search(i+1, value+coins[i].effective, remaining)
+		current[i] = false
+		search(i+1, value, remaining)
+	}
+	search(0, 0, remaining)
+
+	if best == nil {
+		return nil
+	}
+	var selected []coin
+	for i, in := range best {
+		if in {
+			selected = append(selected, coins[i])
+		}
+	}
+	return selected
+}
+
+// selectLargestFirst adds the largest coins until they cover target and a
+// change output. Change below the dust threshold is left to the fee. It
+// returns nil when the coins cannot cover target.
+func selectLargestFirst(coins []coin, target, changeFee int64) ([]coin, int64) {
+	var value int64
+	for i, c := range coins {
+		value += c.effective
+		if value < target {
+			continue
+		}
+		change := value - target - changeFee
+		if change < toUnits(DustThreshold) {
+			change = 0
+		}
+		return coins[:i+1], change
+	}
+	return nil, 0
+}
@@ -5,27 +5,34 @@ import (
 	"encoding/gob"
 	"log"
 	"os"
+	"path/filepath"
+
+	"aztecs/core/script"
 )
 
 const utxoFile = "utxo.dat" // Define UTXO data file name
 
 // UTXO represents an unspent transaction output
 type UTXO struct {
-	TxID      string  // ID of the transaction the output belongs to
-	Index     int     // Index of the output in the transaction
-	Value     float64 // Value of the output
-	PubKeyHash []byte  // Public key hash of the recipient (raw bytes)
+	TxID        string  // ID of the transaction the output belongs to
+	Index       int     // Index of the output in the transaction
+	Value       float64 // Value of the output
+	PubKeyHash  []byte  // Public key hash of the recipient (raw bytes)
+	Script      []byte  // Locking script, pay to PubKeyHash when empty
+	TokenID     string  // Hex ID of the token the output carries, empty for plain coins
+	TokenAmount uint64  // Token units carried by the output
 }
 
 // UTXOSet represents the collection of unspent transaction outputs
 // Map: TxID -> Map: Vout -> UTXO
 type UTXOSet struct {
-	UTXOs map[string]map[int]*UTXO
+	UTXOs    map[string]map[int]*UTXO
+	filePath string // Location of utxo.dat inside the data directory
 }
 
-// NewUTXOSet creates a new UTXOSet or loads from file
-func NewUTXOSet() (*UTXOSet, error) {
-	utxoSet := UTXOSet{}
+// NewUTXOSet creates a new UTXOSet or loads it from utxo.dat in dataDir
+func NewUTXOSet(dataDir string) (*UTXOSet, error) {
+	utxoSet := UTXOSet{filePath: filepath.Join(dataDir, utxoFile)}
 	// Initialize the outer map
 	utxoSet.UTXOs = make(map[string]map[int]*UTXO)
 
@@ -48,7 +55,7 @@ func NewUTXOSet() (*UTXOSet, error) {
 
 // SaveToFile saves the UTXO set to a file
 func (uset *UTXOSet) SaveToFile() {
-	file, err := os.Create(utxoFile)
+	file, err := os.Create(uset.filePath)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -64,11 +71,11 @@ func (uset *UTXOSet) SaveToFile() {
 
 // LoadFromFile loads the UTXO set from a file
 func (uset *UTXOSet) LoadFromFile() error {
-	if _, err := os.Stat(utxoFile); os.IsNotExist(err) {
+	if _, err := os.Stat(uset.filePath); os.IsNotExist(err) {
 		return err // File does not exist
 	}
 
-	file, err := os.Open(utxoFile)
+	file, err := os.Open(uset.filePath)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -100,6 +107,33 @@ func (uset *UTXOSet) FindUTXOs(pubKeyHash []byte) []*UTXO {
 	return foundUTXOs
 }
 
+// TokenBalances returns the token units held by pubKeyHash per token ID
+func (uset *UTXOSet) TokenBalances(pubKeyHash []byte) map[string]uint64 {
+	balances := make(map[string]uint64)
+	for _, utxo := range uset.FindUTXOs(pubKeyHash) {
+		if utxo.TokenID != "" {
+			balances[utxo.TokenID] += utxo.TokenAmount
+		}
+	}
+	return balances
+}
+
+// FindSpendableOutputs collects outputs of pubKeyHash until their value reaches amount.
+// It returns the accumulated value and the chosen outputs as TxID -> output indices.
+func (uset *UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount float64) (float64, map[string][]int) {
+	unspentOutputs := make(map[string][]int)
+	accumulated := 0.0
+
+	for _, utxo := range uset.FindUTXOs(pubKeyHash) {
+		if accumulated >= amount {
+			break
+		}
+		accumulated += utxo.Value
+		unspentOutputs[utxo.TxID] = append(unspentOutputs[utxo.TxID], utxo.Index)
+	}
+	return accumulated, unspentOutputs
+}
+
 // BuildFromBlockchain builds the UTXO set by scanning the entire blockchain
 func (uset *UTXOSet) BuildFromBlockchain(bc *Blockchain) {
 	// Clear the existing UTXO set and re-initialize the outer map
@@ -129,6 +163,9 @@ func (uset *UTXOSet) BuildFromBlockchain(bc *Blockchain) {
 			// Add outputs to the UTXO set if they are not spent
 			txid := tx.ID
 			for voutIndex, vout := range tx.Vout {
+				if script.IsUnspendable(vout.Script) {
+					continue // Burned or data output, never spendable
+				}
 				// Check if the output has been spent
 				if spentTXOs[txid] != nil {
 					spent := false
@@ -145,10 +182,13 @@ func (uset *UTXOSet) BuildFromBlockchain(bc *Blockchain) {
 
 				// Output is unspent, add it to the UTXO set
 				utxo := UTXO{
-					TxID:      txid,
-					Index:     voutIndex,
-					Value:     vout.Value,
-					PubKeyHash: vout.PubKeyHash, // Store raw public key hash
+					TxID:        txid,
+					Index:       voutIndex,
+					Value:       vout.Value,
+					PubKeyHash:  vout.PubKeyHash, // Store raw public key hash
+					Script:      vout.Script,
+					TokenID:     vout.TokenID,
+					TokenAmount: vout.TokenAmount,
 				}
 
 				// Initialize the inner map if it doesn't exist for this TxID
@@ -194,11 +234,17 @@ func (uset *UTXOSet) Update(block *Block) {
 		// Process transaction outputs (add new UTXOs)
 		txid := tx.ID
 		for voutIndex, vout := range tx.Vout {
+			if script.IsUnspendable(vout.Script) {
+				continue // Burned or data output, never spendable
+			}
 			utxo := UTXO{
-				TxID:      txid,
-				Index:     voutIndex,
-				Value:     vout.Value,
-				PubKeyHash: vout.PubKeyHash, // Store raw public key hash
+				TxID:        txid,
+				Index:       voutIndex,
+				Value:       vout.Value,
+				PubKeyHash:  vout.PubKeyHash, // Store raw public key hash
+				Script:      vout.Script,
+				TokenID:     vout.TokenID,
+				TokenAmount: vout.TokenAmount,
 			}
 
 			// Initialize the inner map if it doesn't exist for this TxID
@@ -210,4 +256,4 @@ func (uset *UTXOSet) Update(block *Block) {
 		}
 	}
 	log.Println("UTXO set updated.")
-}
\ No newline at end of file
+}
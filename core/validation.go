@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"aztecs/params"
+)
+
+// Errors returned for transactions and blocks that double spend or create coins
+var (
+	ErrDuplicateInput = errors.New("transaction spends an output twice")
+	ErrValueCreated   = errors.New("transaction outputs exceed its inputs")
+	ErrSpentOutput    = errors.New("input spends a missing or already spent output")
+	ErrCoinbaseValue  = errors.New("coinbase pays more than the block subsidy and fees")
+	ErrTxIDMismatch   = errors.New("transaction ID does not match its contents")
+	ErrDuplicateTxID  = errors.New("transaction ID is already in use")
+)
+
+// CheckID checks that tx carries the ID its contents hash to, see CalculateHash
+func (tx *Transaction) CheckID() error {
+	if id := tx.CalculateHash(); tx.ID != id {
+		return fmt.Errorf("%w: %s hashes to %s", ErrTxIDMismatch, tx.ID, id)
+	}
+	return nil
+}
+
+// checkNewID checks that no block below height holds a transaction with
+// the ID of tx and that utxos has no outputs under it, so adding tx cannot
+// overwrite the outputs of another transaction
+func (bc *Blockchain) checkNewID(tx *Transaction, height int64, utxos *UTXOSet) error {
+	if len(utxos.UTXOs[tx.ID]) > 0 {
+		return fmt.Errorf("%w: %s has unspent outputs", ErrDuplicateTxID, tx.ID)
+	}
+	for _, block := range bc.Blocks {
+		if block.Index >= height {
+			break
+		}
+		for _, other := range block.Transactions {
+			if other.ID == tx.ID {
+				return fmt.Errorf("%w: %s is in block #%d", ErrDuplicateTxID, tx.ID, block.Index)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDistinctInputs checks that no two inputs of tx spend the same output
+func (tx *Transaction) checkDistinctInputs() error {
+	seen := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		op := outpoint(vin.Txid, vin.Vout)
+		if seen[op] {
+			return fmt.Errorf("%w: %s spends %s more than once", ErrDuplicateInput, tx.ID, op)
+		}
+		seen[op] = true
+	}
+	return nil
+}
+
+// CheckInputs checks that tx spends no output twice and that its outputs
+// hold no more coins than the outputs of prevTXs it spends. prevTXs must
+// contain every transaction referenced by the inputs.
+func (tx *Transaction) CheckInputs(prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if err := tx.checkDistinctInputs(); err != nil {
+		return err
+	}
+	var in int64
+	for i, vin := range tx.Vin {
+		prevTx, ok := prevTXs[vin.Txid]
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return fmt.Errorf("input %d of %s spends an unknown output", i, tx.ID)
+		}
+		in += toUnits(prevTx.Vout[vin.Vout].Value)
+	}
+	var out int64
+	for i, vout := range tx.Vout {
+		if vout.Value < 0 {
+			return fmt.Errorf("output %d of %s is negative", i, tx.ID)
+		}
+		out += toUnits(vout.Value)
+	}
+	if out > in {
+		return fmt.Errorf("%w: %s spends %.8f but its inputs only hold %.8f", ErrValueCreated, tx.ID, fromUnits(out), fromUnits(in))
+	}
+	return nil
+}
+
+// CheckBlock verifies the transactions of block against utxos, the unspent
+// outputs as of its parent. Every transaction must carry the ID of its
+// contents, unused by earlier transactions, pass VerifyTransactionAt and
+// spend outputs that are unspent so far, and a block holds at most one
+// coinbase, paying no more than the block subsidy plus the fees of the others.
+func (bc *Blockchain) CheckBlock(block *Block, utxos *UTXOSet) error {
+	spent := make(map[string]bool)
+	ids := make(map[string]bool)
+	var fees, reward int64
+	coinbases := 0
+	for _, tx := range block.Transactions {
+		if err := tx.CheckID(); err != nil {
+			return fmt.Errorf("block #%d: %w", block.Index, err)
+		}
+		if ids[tx.ID] {
+			return fmt.Errorf("%w: %s appears twice in block #%d", ErrDuplicateTxID, tx.ID, block.Index)
+		}
+		ids[tx.ID] = true
+		if err := bc.checkNewID(tx, block.Index, utxos); err != nil {
+			return fmt.Errorf("block #%d: %w", block.Index, err)
+		}
+		if !bc.VerifyTransactionAt(tx, block.Index, block.Timestamp) {
+			return fmt.Errorf("block #%d contains invalid transaction %s", block.Index, tx.ID)
+		}
+		if tx.IsCoinbase() {
+			coinbases++
+			for _, vout := range tx.Vout {
+				reward += toUnits(vout.Value)
+			}
+			continue
+		}
+		var fee int64
+		for _, vin := range tx.Vin {
+			op := outpoint(vin.Txid, vin.Vout)
+			utxo := utxos.UTXOs[vin.Txid][vin.Vout]
+			if utxo == nil || spent[op] {
+				return fmt.Errorf("%w: transaction %s in block #%d spends %s", ErrSpentOutput, tx.ID, block.Index, op)
+			}
+			spent[op] = true
+			fee += toUnits(utxo.Value)
+		}
+		for _, vout := range tx.Vout {
+			fee -= toUnits(vout.Value)
+		}
+		fees += fee
+	}
+	if coinbases > 1 {
+		return fmt.Errorf("block #%d contains %d coinbase transactions", block.Index, coinbases)
+	}
+	if limit := toUnits(params.Active.BlockSubsidy(block.Index)) + fees; reward > limit {
+		return fmt.Errorf("%w: block #%d pays %.8f, limit %.8f", ErrCoinbaseValue, block.Index, fromUnits(reward), fromUnits(limit))
+	}
+	return nil
+}
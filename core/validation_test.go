@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestForgedTransactionID replays the attack of a transaction spending the
+// attacker's coins under the ID of the victim's unspent coinbase, which
+// would overwrite the victim's outputs in the UTXO set
+func TestForgedTransactionID(t *testing.T) {
+	bc := newTestChain(t)
+	wallets := newTestWallets(t)
+	attacker, attackerHash := newTestAddress(t, wallets)
+	_, victimHash := newTestAddress(t, newTestWallets(t))
+	victimCoinbase := mineBlock(t, bc, victimHash).Transactions[0]
+	mineBlock(t, bc, attackerHash)
+
+	recipient, err := NewRecipient(attacker, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := NewTxBuilder(bc, wallets, nil).Build(attacker, []Recipient{recipient}, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := *tx
+	forged.ID = victimCoinbase.ID
+	forged.Vin = append([]TxInput(nil), tx.Vin...)
+	wallet, err := wallets.GetWallet(attacker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.SignTransaction(&forged, wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewMempool().Add(bc, &forged); !errors.Is(err, ErrTxIDMismatch) {
+		t.Errorf("mempool: error %v, want ErrTxIDMismatch", err)
+	}
+	block, err := nextBlock(bc, attackerHash, &forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AppendBlock(block); !errors.Is(err, ErrTxIDMismatch) {
+		t.Errorf("block: error %v, want ErrTxIDMismatch", err)
+	}
+	if got := bc.GetBalance(victimHash); got != victimCoinbase.Vout[0].Value {
+		t.Errorf("victim balance %.8f, want %.8f", got, victimCoinbase.Vout[0].Value)
+	}
+
+	// The honest transaction is still accepted
+	mp := NewMempool()
+	if err := mp.Add(bc, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(bc, tx); !errors.Is(err, ErrDuplicateTxID) {
+		t.Errorf("second add: error %v, want ErrDuplicateTxID", err)
+	}
+	mineBlock(t, bc, attackerHash, tx)
+}
+
+func TestDuplicateTransactionID(t *testing.T) {
+	bc := newTestChain(t)
+	_, pubKeyHash := newTestAddress(t, newTestWallets(t))
+	coinbase := mineBlock(t, bc, pubKeyHash).Transactions[0]
+
+	// A coinbase repeated in a later block has a valid ID, but reuses one
+	tip := bc.Blocks[len(bc.Blocks)-1]
+	block := NewBlock(tip.Index+1, tip.Timestamp, []*Transaction{coinbase}, tip.Hash)
+	block.Hash = block.CalculateHash()
+	if err := bc.AppendBlock(block); !errors.Is(err, ErrDuplicateTxID) {
+		t.Errorf("repeated coinbase: error %v, want ErrDuplicateTxID", err)
+	}
+
+	// So does a transaction appearing twice in one block
+	other := NewCoinbaseTX(pubKeyHash, "", tip.Index+1)
+	block = NewBlock(tip.Index+1, tip.Timestamp, []*Transaction{other, other}, tip.Hash)
+	block.Hash = block.CalculateHash()
+	if err := bc.AppendBlock(block); !errors.Is(err, ErrDuplicateTxID) {
+		t.Errorf("transaction twice in a block: error %v, want ErrDuplicateTxID", err)
+	}
+}
+
+func TestTransactionIDIgnoresSignatures(t *testing.T) {
+	bc := newTestChain(t)
+	wallets := newTestWallets(t)
+	from, pubKeyHash := newTestAddress(t, wallets)
+	mineBlock(t, bc, pubKeyHash)
+	recipient, err := NewRecipient(from, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := NewTxBuilder(bc, wallets, nil).Build(from, []Recipient{recipient}, DefaultFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.CheckID(); err != nil {
+		t.Fatalf("signed transaction: %v", err)
+	}
+	tx.Vout[0].Value++
+	if err := tx.CheckID(); !errors.Is(err, ErrTxIDMismatch) {
+		t.Errorf("changed output: error %v, want ErrTxIDMismatch", err)
+	}
+}
@@ -0,0 +1,178 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+
+	"aztecs/params"
+)
+
+const (
+	pubKeyHashLen       = 20 // Length of a RIPEMD-160 public key hash
+	bech32PubKeyHashVer = 0  // Leading bech32m data value of public key hash addresses
+	bech32ScriptHashVer = 1  // Leading bech32m data value of script hash addresses
+)
+
+// AddressFormat selects how a public key hash is encoded as an address
+type AddressFormat int
+
+// Supported address formats
+const (
+	AddressBase58  AddressFormat = iota // base58check with the network version byte
+	AddressBech32m                      // bech32m with the network prefix
+)
+
+// ParseAddressFormat parses "base58" or "bech32m"
+func ParseAddressFormat(name string) (AddressFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "base58":
+		return AddressBase58, nil
+	case "bech32m", "bech32":
+		return AddressBech32m, nil
+	default:
+		return 0, fmt.Errorf("unknown address format %q, want base58 or bech32m", name)
+	}
+}
+
+// EncodeAddress encodes a public key hash of the active network in format
+func EncodeAddress(pubKeyHash []byte, format AddressFormat) string {
+	return encodeAddress(params.Active.AddressVersion, pubKeyHash, format)
+}
+
+// EncodeScriptAddress encodes the hash of a redeem script, as computed by
+// PublicKeyHash, of the active network in format
+func EncodeScriptAddress(scriptHash []byte, format AddressFormat) string {
+	return encodeAddress(params.Active.ScriptVersion, scriptHash, format)
+}
+
+// encodeAddress encodes hash with the base58 version byte version in format
+func encodeAddress(version byte, hash []byte, format AddressFormat) string {
+	if format == AddressBech32m {
+		data, err := convertBits(hash, 8, 5, true)
+		if err != nil {
+			log.Panic(err)
+		}
+		kind := byte(bech32PubKeyHashVer)
+		if version == params.Active.ScriptVersion {
+			kind = bech32ScriptHashVer
+		}
+		address, err := Bech32mEncode(params.Active.Bech32HRP, append([]byte{kind}, data...))
+		if err != nil {
+			log.Panic(err)
+		}
+		return address
+	}
+
+	payload := append([]byte{version}, hash...)
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// IsScriptAddress reports whether version, as returned by DecodeAddress,
+// belongs to a script hash address
+func IsScriptAddress(version byte) bool {
+	return version == params.Active.ScriptVersion
+}
+
+// FormatAddress re-encodes a valid address of either format in format
+func FormatAddress(address string, format AddressFormat) (string, error) {
+	version, hash, err := DecodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return encodeAddress(version, hash, format), nil
+}
+
+// Errors returned by DecodeAddress
+var (
+	ErrAddressFormat   = errors.New("address is malformed")
+	ErrAddressLength   = errors.New("address has an invalid length")
+	ErrAddressChecksum = errors.New("address checksum mismatch")
+	ErrAddressNetwork  = errors.New("address belongs to another network")
+	ErrScriptAddress   = errors.New("address is a script address")
+)
+
+// DecodeAddress parses a base58check or bech32m address of the active network
+// and returns its base58 version byte and public key hash. Script addresses
+// return the script version byte and the script hash, see IsScriptAddress.
+func DecodeAddress(address string) (byte, []byte, error) {
+	if address == "" {
+		return 0, nil, fmt.Errorf("%w: empty address", ErrAddressFormat)
+	}
+	if hrp, ok := bech32Prefix(address); ok {
+		return decodeBech32Address(address, hrp)
+	}
+	payload := base58.Decode(address)
+	if len(payload) == 0 {
+		return 0, nil, fmt.Errorf("%w: %q", ErrAddressFormat, address)
+	}
+	if len(payload) != 1+pubKeyHashLen+4 {
+		return 0, nil, fmt.Errorf("%w: %q decodes to %d bytes, want %d", ErrAddressLength, address, len(payload), 1+pubKeyHashLen+4)
+	}
+
+	versioned, sum := payload[:len(payload)-4], payload[len(payload)-4:]
+	if !bytes.Equal(checksum(versioned), sum) {
+		return 0, nil, fmt.Errorf("%w: %q", ErrAddressChecksum, address)
+	}
+	version := versioned[0]
+	if version != params.Active.AddressVersion && version != params.Active.ScriptVersion {
+		return 0, nil, fmt.Errorf("%w: %q has version 0x%02x, %s uses 0x%02x", ErrAddressNetwork, address, version, params.Active.Name, params.Active.AddressVersion)
+	}
+	return version, versioned[1:], nil
+}
+
+// DecodeKeyAddress decodes an address that has to pay to a public key hash,
+// such as a block reward address, and rejects script addresses
+func DecodeKeyAddress(address string) ([]byte, error) {
+	version, pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if IsScriptAddress(version) {
+		return nil, fmt.Errorf("%w: %s", ErrScriptAddress, address)
+	}
+	return pubKeyHash, nil
+}
+
+// bech32Prefix returns the network prefix a bech32m address starts with
+func bech32Prefix(address string) (string, bool) {
+	lower := strings.ToLower(address)
+	for _, p := range params.Networks {
+		if strings.HasPrefix(lower, p.Bech32HRP+"1") {
+			return p.Bech32HRP, true
+		}
+	}
+	return "", false
+}
+
+// decodeBech32Address decodes a bech32m address whose prefix is hrp
+func decodeBech32Address(address, hrp string) (byte, []byte, error) {
+	if hrp != params.Active.Bech32HRP {
+		return 0, nil, fmt.Errorf("%w: %q has prefix %s, %s uses %s", ErrAddressNetwork, address, hrp, params.Active.Name, params.Active.Bech32HRP)
+	}
+	_, data, err := Bech32mDecode(address)
+	switch {
+	case errors.Is(err, ErrBech32Checksum):
+		return 0, nil, fmt.Errorf("%w: %q", ErrAddressChecksum, address)
+	case err != nil:
+		return 0, nil, fmt.Errorf("%w: %q: %v", ErrAddressFormat, address, err)
+	case len(data) == 0 || (data[0] != bech32PubKeyHashVer && data[0] != bech32ScriptHashVer):
+		return 0, nil, fmt.Errorf("%w: %q has an unknown address type", ErrAddressFormat, address)
+	}
+
+	pubKeyHash, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %q: %v", ErrAddressFormat, address, err)
+	}
+	if len(pubKeyHash) != pubKeyHashLen {
+		return 0, nil, fmt.Errorf("%w: %q holds %d bytes, want %d", ErrAddressLength, address, len(pubKeyHash), pubKeyHashLen)
+	}
+	if data[0] == bech32ScriptHashVer {
+		return params.Active.ScriptVersion, pubKeyHash, nil
+	}
+	return params.Active.AddressVersion, pubKeyHash, nil
+}
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Bech32m encoding as specified by BIP350. Unlike base58check it is case
+// insensitive and detects any error affecting up to four characters.
+const (
+	bech32Charset   = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32mConst    = 0x2bc830a3
+	bech32MaxLen    = 90
+	bech32ChecksumN = 6 // Checksum characters
+)
+
+// Errors returned by bech32m decoding
+var (
+	ErrBech32Checksum = errors.New("bech32m checksum mismatch")
+	ErrBech32Format   = errors.New("invalid bech32m string")
+)
+
+// bech32Polymod computes the BCH checksum over the expanded HRP and data
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand spreads the human-readable part for checksum computation
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// Bech32mEncode encodes 5-bit data values under a human-readable prefix
+func Bech32mEncode(hrp string, data []byte) (string, error) {
+	if len(hrp) == 0 || len(hrp)+1+len(data)+bech32ChecksumN > bech32MaxLen {
+		return "", fmt.Errorf("%w: bad length", ErrBech32Format)
+	}
+	hrp = strings.ToLower(hrp)
+
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, bech32ChecksumN)...)
+	polymod := bech32Polymod(values) ^ bech32mConst
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		if d > 31 {
+			return "", fmt.Errorf("%w: data value %d out of range", ErrBech32Format, d)
+		}
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < bech32ChecksumN; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+// Bech32mDecode splits a bech32m string into its prefix and 5-bit data values
+func Bech32mDecode(s string) (string, []byte, error) {
+	if len(s) > bech32MaxLen {
+		return "", nil, fmt.Errorf("%w: longer than %d characters", ErrBech32Format, bech32MaxLen)
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("%w: mixed case", ErrBech32Format)
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+1+bech32ChecksumN > len(s) {
+		return "", nil, fmt.Errorf("%w: missing separator or checksum", ErrBech32Format)
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("%w: invalid prefix character", ErrBech32Format)
+		}
+	}
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for _, c := range s[sep+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", nil, fmt.Errorf("%w: invalid character %q", ErrBech32Format, c)
+		}
+		data = append(data, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != bech32mConst {
+		return "", nil, ErrBech32Checksum
+	}
+	return hrp, data[:len(data)-bech32ChecksumN], nil
+}
+
+// convertBits regroups a byte slice between bit widths, e.g. 8 to 5 for encoding
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("%w: value out of range", ErrBech32Format)
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, fmt.Errorf("%w: invalid padding", ErrBech32Format)
+	}
+	return out, nil
+}
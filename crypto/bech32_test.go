@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test vectors of BIP350
+var (
+	validBech32m = []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"11llllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllludsr8",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	}
+	invalidBech32m = []struct {
+		s      string
+		reason string
+	}{
+		{"\x201xj0phk", "prefix character out of range"},
+		{"\x7f1g6xzxy", "prefix character out of range"},
+		{"\x801vctc34", "prefix character out of range"},
+		{"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11d6pts4", "overall max length exceeded"},
+		{"qyrz8wqd2c9m", "no separator character"},
+		{"1qyrz8wqd2c9m", "empty prefix"},
+		{"y1b0jsk6g", "invalid data character"},
+		{"lt1igcx5c0", "invalid data character"},
+		{"in1muywd", "too short checksum"},
+		{"mm1crxm3i", "invalid character in checksum"},
+		{"au1s5cgom", "invalid character in checksum"},
+		{"M1VUXWEZ", "checksum calculated with uppercase form of prefix"},
+		{"16plkw9", "empty prefix"},
+		{"1p2gdwpf", "empty prefix"},
+		{"A12UEL5L", "bech32 checksum, not bech32m"},
+	}
+)
+
+func TestBech32mValid(t *testing.T) {
+	for _, s := range validBech32m {
+		hrp, data, err := Bech32mDecode(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		encoded, err := Bech32mEncode(hrp, data)
+		if err != nil {
+			t.Errorf("%q: encode: %v", s, err)
+			continue
+		}
+		if encoded != strings.ToLower(s) {
+			t.Errorf("%q: re-encoded as %q", s, encoded)
+		}
+	}
+}
+
+func TestBech32mInvalid(t *testing.T) {
+	for _, tt := range invalidBech32m {
+		if hrp, data, err := Bech32mDecode(tt.s); err == nil {
+			t.Errorf("%q (%s): decoded to %q %v", tt.s, tt.reason, hrp, data)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+
+	"aztecs/params"
+)
+
+// Key derivation follows BIP32 on the P-256 curve, with the SLIP-10 rules for
+// master key generation and for rejecting out of range child keys.
+const (
+	HardenedKeyStart  = 0x80000000 // Child indices at or above this are hardened
+	hdMasterKeySecret = "Nist256p1 seed"
+	serializedKeyLen  = 78
+	minSeedLen        = 16
+	maxSeedLen        = 64
+)
+
+// Errors returned by hierarchical key derivation
+var (
+	ErrDeriveHardenedFromPublic = errors.New("cannot derive a hardened key from a public key")
+	ErrNotPrivateExtendedKey    = errors.New("extended key is not a private key")
+	ErrInvalidExtendedKey       = errors.New("invalid extended key")
+)
+
+// ExtendedKey is a BIP32-style extended private or public key
+type ExtendedKey struct {
+	Version   [4]byte
+	Depth     byte
+	ParentFP  [4]byte // First four bytes of the parent public key hash
+	ChildNum  uint32
+	ChainCode []byte
+	Key       []byte // 32 byte private scalar or 33 byte compressed public key
+	IsPrivate bool
+}
+
+// NewMasterKey derives the master extended private key from a seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < minSeedLen || len(seed) > maxSeedLen {
+		return nil, fmt.Errorf("seed must be between %d and %d bytes", minSeedLen, maxSeedLen)
+	}
+
+	n := elliptic.P256().Params().N
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, []byte(hdMasterKeySecret))
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		k := new(big.Int).SetBytes(sum[:32])
+		if k.Sign() != 0 && k.Cmp(n) < 0 {
+			return &ExtendedKey{
+				Version:   params.Active.HDPrivateKeyID,
+				ChainCode: sum[32:],
+				Key:       sum[:32],
+				IsPrivate: true,
+			}, nil
+		}
+		data = sum // Out of range, retry with the HMAC output as SLIP-10 specifies
+	}
+}
+
+// pubKeyBytes returns the compressed public key of the extended key
+func (k *ExtendedKey) pubKeyBytes() []byte {
+	if !k.IsPrivate {
+		return k.Key
+	}
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(k.Key)
+	return elliptic.MarshalCompressed(curve, x, y)
+}
+
+// Child derives the child key at index i. Indices at or above
+// HardenedKeyStart are hardened and need a private key.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	hardened := i >= HardenedKeyStart
+	if hardened && !k.IsPrivate {
+		return nil, ErrDeriveHardenedFromPublic
+	}
+	if k.Depth == 255 {
+		return nil, errors.New("cannot derive beyond depth 255")
+	}
+
+	var data []byte
+	if hardened {
+		data = append([]byte{0x00}, k.Key...)
+	} else {
+		data = k.pubKeyBytes()
+	}
+	data = binary.BigEndian.AppendUint32(data, i)
+
+	curve := elliptic.P256()
+	n := curve.Params().N
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		il := new(big.Int).SetBytes(sum[:32])
+		chainCode := sum[32:]
+
+		child := &ExtendedKey{
+			Version:   k.Version,
+			Depth:     k.Depth + 1,
+			ChildNum:  i,
+			ChainCode: chainCode,
+			IsPrivate: k.IsPrivate,
+		}
+		copy(child.ParentFP[:], PublicKeyHash(k.pubKeyBytes())[:4])
+
+		valid := il.Cmp(n) < 0
+		if valid && k.IsPrivate {
+			// Child private key is parse256(IL) + kpar (mod n)
+			key := new(big.Int).Add(il, new(big.Int).SetBytes(k.Key))
+			key.Mod(key, n)
+			if key.Sign() != 0 {
+				child.Key = key.FillBytes(make([]byte, 32))
+				return child, nil
+			}
+		} else if valid {
+			// Child public key is point(parse256(IL)) + Kpar
+			px, py := elliptic.UnmarshalCompressed(curve, k.Key)
+			if px == nil {
+				return nil, ErrInvalidExtendedKey
+			}
+			ix, iy := curve.ScalarBaseMult(sum[:32])
+			x, y := curve.Add(ix, iy, px, py)
+			if x.Sign() != 0 || y.Sign() != 0 {
+				child.Key = elliptic.MarshalCompressed(curve, x, y)
+				return child, nil
+			}
+		}
+
+		// Invalid child, SLIP-10 retries with 0x01 || IR || ser32(i)
+		data = append([]byte{0x01}, chainCode...)
+		data = binary.BigEndian.AppendUint32(data, i)
+	}
+}
+
+// DerivePath derives a descendant key from a path such as m/44'/0'/0'/0/5
+func (k *ExtendedKey) DerivePath(path string) (*ExtendedKey, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || (parts[0] != "m" && parts[0] != "M") {
+		return nil, fmt.Errorf("derivation path %q must start with m", path)
+	}
+
+	key := k
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		part = strings.TrimRight(part, "'h")
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path element %q", part)
+		}
+		if hardened {
+			index += HardenedKeyStart
+		}
+		if key, err = key.Child(uint32(index)); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Neuter returns the extended public key of an extended private key
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.IsPrivate {
+		return k
+	}
+	return &ExtendedKey{
+		Version:   params.Active.HDPublicKeyID,
+		Depth:     k.Depth,
+		ParentFP:  k.ParentFP,
+		ChildNum:  k.ChildNum,
+		ChainCode: k.ChainCode,
+		Key:       k.pubKeyBytes(),
+		IsPrivate: false,
+	}
+}
+
+// PublicKey returns the public key in the X || Y format used by Wallet
+func (k *ExtendedKey) PublicKey() []byte {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), k.pubKeyBytes())
+	return append(x.FillBytes(make([]byte, 32)), y.FillBytes(make([]byte, 32))...)
+}
+
+// Wallet returns a Wallet holding the private key of an extended private key
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	if !k.IsPrivate {
+		return nil, ErrNotPrivateExtendedKey
+	}
+	return NewWalletFromPrivateKey(k.Key)
+}
+
+// String serializes the key as base58check, in the xprv/xpub layout of BIP32
+func (k *ExtendedKey) String() string {
+	buf := make([]byte, 0, serializedKeyLen+4)
+	buf = append(buf, k.Version[:]...)
+	buf = append(buf, k.Depth)
+	buf = append(buf, k.ParentFP[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, k.ChildNum)
+	buf = append(buf, k.ChainCode...)
+	if k.IsPrivate {
+		buf = append(buf, 0x00)
+	}
+	buf = append(buf, k.Key...)
+	buf = append(buf, checksum(buf)...)
+	return base58.Encode(buf)
+}
+
+// ParseExtendedKey decodes a key serialized by String
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	data := base58.Decode(s)
+	if len(data) != serializedKeyLen+4 {
+		return nil, fmt.Errorf("%w: bad length", ErrInvalidExtendedKey)
+	}
+	payload, sum := data[:serializedKeyLen], data[serializedKeyLen:]
+	if string(checksum(payload)) != string(sum) {
+		return nil, fmt.Errorf("%w: bad checksum", ErrInvalidExtendedKey)
+	}
+
+	k := &ExtendedKey{
+		Depth:     payload[4],
+		ChildNum:  binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode: append([]byte{}, payload[13:45]...),
+	}
+	copy(k.Version[:], payload[:4])
+	copy(k.ParentFP[:], payload[5:9])
+
+	switch k.Version {
+	case params.Active.HDPrivateKeyID:
+		if payload[45] != 0x00 {
+			return nil, fmt.Errorf("%w: bad private key prefix", ErrInvalidExtendedKey)
+		}
+		k.IsPrivate = true
+		k.Key = append([]byte{}, payload[46:]...)
+		d := new(big.Int).SetBytes(k.Key)
+		if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+			return nil, fmt.Errorf("%w: private key out of range", ErrInvalidExtendedKey)
+		}
+	case params.Active.HDPublicKeyID:
+		k.Key = append([]byte{}, payload[45:]...)
+		if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), k.Key); x == nil {
+			return nil, fmt.Errorf("%w: public key not on curve", ErrInvalidExtendedKey)
+		}
+	default:
+		return nil, fmt.Errorf("%w: version %x is not for %s", ErrInvalidExtendedKey, k.Version, params.Active.Name)
+	}
+	return k, nil
+}
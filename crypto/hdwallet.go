@@ -0,0 +1,249 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"aztecs/params"
+)
+
+// HD wallets derive every key from one seed along <account>/<branch>/<index>,
+// where the account is m/44'/<coin type>'/0'.
+const (
+	hdReceiveBranch = 0 // Branch of addresses handed out to payers
+	hdChangeBranch  = 1 // Branch of addresses receiving change
+	HDSeedLen       = 32
+	DefaultGapLimit = 20 // Unused addresses scanned past the last used one
+)
+
+// Errors returned by HD wallet operations
+var (
+	ErrNoHDChain     = errors.New("wallet has no HD seed, create one with createhdwallet")
+	ErrHDChainExists = errors.New("wallet already has an HD seed")
+)
+
+// hdChain is the public state of the HD key chain, readable while the wallet is locked
+type hdChain struct {
+	AccountPath string    // Derivation path of the account key
+	AccountKey  string    // Extended public key of the account
+	NextIndex   [2]uint32 // Next child index of the receive and change branches
+}
+
+// NewHDSeed returns a random seed for SetHDSeed
+func NewHDSeed() ([]byte, error) {
+	seed := make([]byte, HDSeedLen)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// SetHDSeed makes the wallet deterministic, so AddWallet and NewChangeAddress
+// derive their keys from seed. Keys created before stay in the wallet.
+func (ws *Wallets) SetHDSeed(seed []byte) error {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.crypt != nil && ws.key == nil {
+		return ErrWalletLocked
+	}
+	if ws.hd != nil {
+		return ErrHDChainExists
+	}
+
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("m/44'/%d'/0'", params.Active.HDCoinType)
+	account, err := master.DerivePath(path)
+	if err != nil {
+		return err
+	}
+	ws.hd = &hdChain{AccountPath: path, AccountKey: account.Neuter().String()}
+	ws.hdSeed = append([]byte{}, seed...)
+	return nil
+}
+
+// IsHD reports whether the wallet derives its keys from an HD seed
+func (ws *Wallets) IsHD() bool {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	return ws.hd != nil
+}
+
+// HDAccountKey returns the extended public key of the HD account
+func (ws *Wallets) HDAccountKey() (string, error) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.hd == nil {
+		return "", ErrNoHDChain
+	}
+	return ws.hd.AccountKey, nil
+}
+
+// NewChangeAddress derives the next change address of an HD wallet
+func (ws *Wallets) NewChangeAddress() (string, error) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.hd == nil {
+		return "", ErrNoHDChain
+	}
+	return ws.deriveNext(hdChangeBranch)
+}
+
+// ScanHD restores the keys of an HD wallet that the chain has paid to. Each
+// branch is walked until gapLimit consecutive addresses are unused according
+// to used, which is given public key hashes. It returns the number of used
+// addresses found.
+func (ws *Wallets) ScanHD(used func(pubKeyHash []byte) bool, gapLimit int) (int, error) {
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.hd == nil {
+		return 0, ErrNoHDChain
+	}
+	found := 0
+	for _, branch := range []uint32{hdReceiveBranch, hdChangeBranch} {
+		branchKey, err := ws.branchKey(branch)
+		if err != nil {
+			return found, err
+		}
+
+		var keys []*Wallet
+		for index, gap := uint32(0), 0; gap < gapLimit; index++ {
+			wallet, err := deriveWallet(branchKey, index)
+			if err != nil {
+				return found, err
+			}
+			keys = append(keys, wallet)
+			if !used(PublicKeyHash(wallet.PublicKey)) {
+				gap++
+				continue
+			}
+			gap = 0
+			found++
+			if index+1 > ws.hd.NextIndex[branch] {
+				ws.hd.NextIndex[branch] = index + 1
+			}
+		}
+
+		// Keep every key up to the last used one so the key set has no holes
+		for _, wallet := range keys[:min(len(keys), int(ws.hd.NextIndex[branch]))] {
+			ws.Wallets[string(wallet.GetAddress())] = wallet
+		}
+	}
+	return found, nil
+}
+
+// KeyPath returns the derivation path of an HD key the wallet has handed
+// out. It works from the account's public key, so also while locked.
+func (ws *Wallets) KeyPath(pubKey []byte) (string, bool) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.hd == nil {
+		return "", false
+	}
+	account, err := ParseExtendedKey(ws.hd.AccountKey)
+	if err != nil {
+		return "", false
+	}
+	for _, branch := range []uint32{hdReceiveBranch, hdChangeBranch} {
+		branchKey, err := account.Child(branch)
+		if err != nil {
+			return "", false
+		}
+		for index := uint32(0); index < ws.hd.NextIndex[branch]; index++ {
+			key, err := branchKey.Child(index)
+			if err != nil {
+				continue
+			}
+			if bytes.Equal(key.PublicKey(), pubKey) {
+				return fmt.Sprintf("%s/%d/%d", ws.hd.AccountPath, branch, index), true
+			}
+		}
+	}
+	return "", false
+}
+
+// DeriveWallet derives the key at path of the HD account without adding it
+// to the wallet. It fails unless the derived key is pubKey.
+func (ws *Wallets) DeriveWallet(path string, pubKey []byte) (*Wallet, error) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.hd == nil {
+		return nil, ErrNoHDChain
+	}
+	if !strings.HasPrefix(path, ws.hd.AccountPath+"/") {
+		return nil, fmt.Errorf("%w: %s is outside account %s", ErrWalletNotFound, path, ws.hd.AccountPath)
+	}
+	if ws.hdSeed == nil {
+		return nil, ErrWalletLocked
+	}
+	master, err := NewMasterKey(ws.hdSeed)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.DerivePath(path)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := key.Wallet()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(wallet.PublicKey, pubKey) {
+		return nil, fmt.Errorf("%w: key at %s is not %x", ErrWalletNotFound, path, pubKey)
+	}
+	return wallet, nil
+}
+
+// deriveNext adds the next key of branch to the wallet and returns its address.
+// It must be called with the lock held.
+func (ws *Wallets) deriveNext(branch uint32) (string, error) {
+	branchKey, err := ws.branchKey(branch)
+	if err != nil {
+		return "", err
+	}
+	wallet, err := deriveWallet(branchKey, ws.hd.NextIndex[branch])
+	if err != nil {
+		return "", err
+	}
+	ws.hd.NextIndex[branch]++
+
+	address := string(wallet.GetAddress())
+	ws.Wallets[address] = wallet
+	return address, nil
+}
+
+// branchKey derives the extended private key of a branch, must be called with the lock held
+func (ws *Wallets) branchKey(branch uint32) (*ExtendedKey, error) {
+	if ws.hdSeed == nil {
+		return nil, ErrWalletLocked
+	}
+	master, err := NewMasterKey(ws.hdSeed)
+	if err != nil {
+		return nil, err
+	}
+	return master.DerivePath(fmt.Sprintf("%s/%d", ws.hd.AccountPath, branch))
+}
+
+// deriveWallet derives the key at index of a branch
+func deriveWallet(branchKey *ExtendedKey, index uint32) (*Wallet, error) {
+	key, err := branchKey.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	return key.Wallet()
+}
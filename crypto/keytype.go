@@ -0,0 +1,242 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// KeyType selects the curve and signature scheme of a key. The type of a
+// public key follows from its encoding, so verifiers need no extra field:
+//
+//	KeyP256       64 bytes X || Y     ECDSA over NIST P-256, signature r || s
+//	KeySecp256k1  33 bytes compressed ECDSA over secp256k1, signature r || s with low s
+//	KeySchnorr    32 bytes x-only     BIP340 Schnorr over secp256k1
+type KeyType byte
+
+// Supported key types
+const (
+	KeyP256 KeyType = iota
+	KeySecp256k1
+	KeySchnorr
+)
+
+// Lengths of the encodings above
+const (
+	p256PubKeyLen      = 64
+	secp256k1PubKeyLen = 33
+	schnorrPubKeyLen   = 32
+	signatureLen       = 64 // Every scheme signs with 64 bytes
+	privateKeyLen      = 32
+)
+
+// ErrUnknownKeyType is returned for public keys matching no key type
+var ErrUnknownKeyType = errors.New("unknown key type")
+
+// String returns the name accepted by ParseKeyType
+func (kt KeyType) String() string {
+	switch kt {
+	case KeyP256:
+		return "p256"
+	case KeySecp256k1:
+		return "secp256k1"
+	case KeySchnorr:
+		return "schnorr"
+	default:
+		return fmt.Sprintf("keytype(%d)", byte(kt))
+	}
+}
+
+// ParseKeyType parses "p256", "secp256k1" or "schnorr"
+func ParseKeyType(name string) (KeyType, error) {
+	switch strings.ToLower(name) {
+	case "", "p256":
+		return KeyP256, nil
+	case "secp256k1":
+		return KeySecp256k1, nil
+	case "schnorr", "bip340":
+		return KeySchnorr, nil
+	default:
+		return 0, fmt.Errorf("%w %q, want p256, secp256k1 or schnorr", ErrUnknownKeyType, name)
+	}
+}
+
+// KeyTypeOf returns the key type of an encoded public key
+func KeyTypeOf(pubKey []byte) (KeyType, error) {
+	switch {
+	case len(pubKey) == p256PubKeyLen:
+		return KeyP256, nil
+	case len(pubKey) == secp256k1PubKeyLen && (pubKey[0] == 0x02 || pubKey[0] == 0x03):
+		return KeySecp256k1, nil
+	case len(pubKey) == schnorrPubKeyLen:
+		return KeySchnorr, nil
+	default:
+		return 0, fmt.Errorf("%w: %d byte public key", ErrUnknownKeyType, len(pubKey))
+	}
+}
+
+// NewWalletOfType creates a wallet with a random key of type kt
+func NewWalletOfType(kt KeyType) *Wallet {
+	if kt == KeyP256 {
+		return NewWallet()
+	}
+	private, err := btcec.NewPrivateKey()
+	if err != nil {
+		log.Panic(err)
+	}
+	wallet, err := NewWalletFromKey(kt, private.Serialize())
+	if err != nil {
+		log.Panic(err)
+	}
+	return wallet
+}
+
+// NewWalletFromKey rebuilds a wallet of type kt from its raw private scalar
+func NewWalletFromKey(kt KeyType, d []byte) (*Wallet, error) {
+	if kt == KeyP256 {
+		return NewWalletFromPrivateKey(d)
+	}
+	if kt != KeySecp256k1 && kt != KeySchnorr {
+		return nil, fmt.Errorf("%w %d", ErrUnknownKeyType, byte(kt))
+	}
+	if len(d) > privateKeyLen {
+		return nil, fmt.Errorf("private key is %d bytes, want at most %d", len(d), privateKeyLen)
+	}
+	var scalar btcec.ModNScalar
+	if overflow := scalar.SetByteSlice(d); overflow || scalar.IsZero() {
+		return nil, errors.New("invalid private key: out of range")
+	}
+
+	private := btcec.PrivKeyFromScalar(&scalar)
+	point := private.PubKey().SerializeUncompressed() // 0x04 || X || Y
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: btcec.S256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+
+	pubKey := private.PubKey().SerializeCompressed()
+	if kt == KeySchnorr {
+		pubKey = schnorr.SerializePubKey(private.PubKey())
+	}
+	return &Wallet{PrivateKey: key, PublicKey: pubKey}, nil
+}
+
+// KeyType returns the key type of the wallet
+func (w Wallet) KeyType() KeyType {
+	kt, err := KeyTypeOf(w.PublicKey)
+	if err != nil {
+		log.Panic(err)
+	}
+	return kt
+}
+
+// Sign signs a 32 byte hash with the scheme of the wallet's key type
+func (w Wallet) Sign(hash []byte) ([]byte, error) {
+	if w.PrivateKey == nil {
+		return nil, ErrWalletLocked
+	}
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("signature hash is %d bytes, want 32", len(hash))
+	}
+
+	switch w.KeyType() {
+	case KeySecp256k1:
+		// The compact form is a recovery byte followed by r || s, with s already low
+		return btcecdsa.SignCompact(w.btcecKey(), hash, true)[1:], nil
+	case KeySchnorr:
+		var aux [32]byte
+		if _, err := rand.Read(aux[:]); err != nil {
+			return nil, err
+		}
+		sig, err := schnorr.Sign(w.btcecKey(), hash, schnorr.CustomNonce(aux))
+		if err != nil {
+			return nil, err
+		}
+		return sig.Serialize(), nil
+	default:
+		r, s, err := ecdsa.Sign(rand.Reader, w.PrivateKey, hash)
+		if err != nil {
+			return nil, err
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+	}
+}
+
+// btcecKey converts a secp256k1 private key for use with btcec
+func (w Wallet) btcecKey() *btcec.PrivateKey {
+	private, _ := btcec.PrivKeyFromBytes(w.PrivateKeyBytes())
+	return private
+}
+
+// VerifySignature checks sig over hash with the scheme given by the encoding of pubKey
+func VerifySignature(pubKey, hash, sig []byte) bool {
+	kt, err := KeyTypeOf(pubKey)
+	if err != nil || len(sig) != signatureLen || len(hash) != 32 {
+		return false
+	}
+
+	switch kt {
+	case KeySecp256k1:
+		key, err := btcec.ParsePubKey(pubKey)
+		if err != nil {
+			return false
+		}
+		var r, s btcec.ModNScalar
+		if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) || r.IsZero() || s.IsZero() {
+			return false
+		}
+		if s.IsOverHalfOrder() {
+			return false // High s values would make signatures malleable
+		}
+		return btcecdsa.NewSignature(&r, &s).Verify(hash, key)
+	case KeySchnorr:
+		key, err := schnorr.ParsePubKey(pubKey)
+		if err != nil {
+			return false
+		}
+		signature, err := schnorr.ParseSignature(sig)
+		if err != nil {
+			return false
+		}
+		return signature.Verify(hash, key)
+	default:
+		x := new(big.Int).SetBytes(pubKey[:32])
+		y := new(big.Int).SetBytes(pubKey[32:])
+		key := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(&key, hash, r, s)
+	}
+}
+
+// encodePrivateKey serializes the private key of w for storage. P-256 keys
+// keep the bare 32 byte scalar of older wallet files, other types are
+// prefixed with their key type.
+func encodePrivateKey(w *Wallet) []byte {
+	d := w.PrivateKeyBytes()
+	if kt := w.KeyType(); kt != KeyP256 {
+		return append([]byte{byte(kt)}, d...)
+	}
+	return d
+}
+
+// decodePrivateKey rebuilds a wallet from the output of encodePrivateKey
+func decodePrivateKey(data []byte) (*Wallet, error) {
+	if len(data) == privateKeyLen+1 {
+		return NewWalletFromKey(KeyType(data[0]), data[1:])
+	}
+	return NewWalletFromPrivateKey(data)
+}
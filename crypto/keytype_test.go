@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// bip340Vectors are the test vectors of BIP340 (test-vectors.csv)
+var bip340Vectors = []struct {
+	index  int
+	seckey string // Empty for verification only vectors
+	pubkey string
+	aux    string
+	msg    string
+	sig    string
+	valid  bool
+}{
+	{0, "0000000000000000000000000000000000000000000000000000000000000003",
+		"F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0", true},
+	{1, "B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A", true},
+	{2, "C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9",
+		"DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		"C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906",
+		"7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C",
+		"5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7", true},
+	{3, "0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710",
+		"25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		"7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3", true},
+	{4, "", "D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9", "",
+		"4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703",
+		"00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4", true},
+	// Public key not on the curve
+	{5, "", "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// R has an odd Y coordinate
+	{6, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2", false},
+	// Negated message
+	{7, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"1FA62E331EDBC21C394792D2AB1100A7B432B013DF3F6FF4F99FCB33E0E1515F28890B3EDB6E7189B630448B515CE4F8622A954CFE545735AAEA5134FCCDB2BD", false},
+	// Negated s
+	{8, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769961764B3AA9B2FFCB6EF947B6887A226E8D7C93E00C5ED0C1834FF0D0C2E6DA6", false},
+	// R is the point at infinity
+	{9, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"0000000000000000000000000000000000000000000000000000000000000000123DDA8328AF9C23A94C1FEECFD123BA4FB73476F0D594DCB65C6425BD186051", false},
+	{10, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"00000000000000000000000000000000000000000000000000000000000000017615FBAF5AE28864013C099742DEADB4DBA87F11AC6754F93780D5A1837CF197", false},
+	// r is not an X coordinate on the curve
+	{11, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// r equals the field size
+	{12, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// s equals the curve order
+	{13, "", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", false},
+	// Public key exceeds the field size
+	{14, "", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC30", "",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+}
+
+func TestBIP340Vectors(t *testing.T) {
+	for _, v := range bip340Vectors {
+		pubKey, msg, sig := mustHex(t, v.pubkey), mustHex(t, v.msg), mustHex(t, v.sig)
+		if got := VerifySignature(pubKey, msg, sig); got != v.valid {
+			t.Errorf("vector %d: VerifySignature = %v, want %v", v.index, got, v.valid)
+		}
+		if v.seckey == "" {
+			continue
+		}
+
+		wallet, err := NewWalletFromKey(KeySchnorr, mustHex(t, v.seckey))
+		if err != nil {
+			t.Fatalf("vector %d: %v", v.index, err)
+		}
+		if !bytes.Equal(wallet.PublicKey, pubKey) {
+			t.Errorf("vector %d: public key %X, want %s", v.index, wallet.PublicKey, v.pubkey)
+		}
+		// Sign draws fresh auxiliary randomness, so reproduce the vector with its aux
+		var aux [32]byte
+		copy(aux[:], mustHex(t, v.aux))
+		signature, err := schnorr.Sign(wallet.btcecKey(), msg, schnorr.CustomNonce(aux))
+		if err != nil {
+			t.Fatalf("vector %d: %v", v.index, err)
+		}
+		if !bytes.Equal(signature.Serialize(), sig) {
+			t.Errorf("vector %d: signature %X, want %s", v.index, signature.Serialize(), v.sig)
+		}
+		own, err := wallet.Sign(msg)
+		if err != nil || !VerifySignature(pubKey, msg, own) {
+			t.Errorf("vector %d: wallet signature does not verify: %v", v.index, err)
+		}
+	}
+}
+
+func TestSecp256k1ECDSA(t *testing.T) {
+	// The generator point is the public key of the private key 1
+	one := make([]byte, 32)
+	one[31] = 1
+	wallet, err := NewWalletFromKey(KeySecp256k1, one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"; hex.EncodeToString(wallet.PublicKey) != want {
+		t.Fatalf("public key %x, want %s", wallet.PublicKey, want)
+	}
+
+	hash := sha256.Sum256([]byte("aztecs"))
+	for i := 0; i < 20; i++ {
+		wallet := NewWalletOfType(KeySecp256k1)
+		sig, err := wallet.Sign(hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifySignature(wallet.PublicKey, hash[:], sig) {
+			t.Fatal("valid signature rejected")
+		}
+
+		var s btcec.ModNScalar
+		s.SetByteSlice(sig[32:])
+		if s.IsOverHalfOrder() {
+			t.Fatalf("signature has a high s: %x", sig)
+		}
+		// n - s is an equally valid ECDSA signature that must be rejected
+		highS := append([]byte{}, sig[:32]...)
+		negated := s.Negate().Bytes()
+		highS = append(highS, negated[:]...)
+		if VerifySignature(wallet.PublicKey, hash[:], highS) {
+			t.Fatalf("high s signature accepted: %x", highS)
+		}
+
+		tampered := append([]byte{}, sig...)
+		tampered[10] ^= 1
+		if VerifySignature(wallet.PublicKey, hash[:], tampered) {
+			t.Fatal("tampered signature accepted")
+		}
+		other := sha256.Sum256([]byte("other"))
+		if VerifySignature(wallet.PublicKey, other[:], sig) {
+			t.Fatal("signature accepted for another hash")
+		}
+	}
+
+	zero := make([]byte, signatureLen)
+	if VerifySignature(wallet.PublicKey, hash[:], zero) {
+		t.Error("zero signature accepted")
+	}
+}
+
+func TestP256RoundTrip(t *testing.T) {
+	hash := sha256.Sum256([]byte("aztecs"))
+	wallet := NewWalletOfType(KeyP256)
+	if wallet.KeyType() != KeyP256 || len(wallet.PublicKey) != p256PubKeyLen {
+		t.Fatalf("key type %v with %d byte public key", wallet.KeyType(), len(wallet.PublicKey))
+	}
+	sig, err := wallet.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != signatureLen || !VerifySignature(wallet.PublicKey, hash[:], sig) {
+		t.Fatal("valid signature rejected")
+	}
+	tampered := append([]byte{}, sig...)
+	tampered[40] ^= 1
+	if VerifySignature(wallet.PublicKey, hash[:], tampered) {
+		t.Error("tampered signature accepted")
+	}
+	if VerifySignature(NewWallet().PublicKey, hash[:], sig) {
+		t.Error("signature accepted for another key")
+	}
+
+	restored, err := NewWalletFromKey(KeyP256, wallet.PrivateKeyBytes())
+	if err != nil || !bytes.Equal(restored.PublicKey, wallet.PublicKey) {
+		t.Errorf("restored key %x, %v; want %x", restored.PublicKey, err, wallet.PublicKey)
+	}
+}
+
+func TestSignatureSchemesDoNotMix(t *testing.T) {
+	hash := sha256.Sum256([]byte("aztecs"))
+	d := sha256.Sum256([]byte("shared scalar"))
+	ecdsaWallet, _ := NewWalletFromKey(KeySecp256k1, d[:])
+	schnorrWallet, _ := NewWalletFromKey(KeySchnorr, d[:])
+
+	ecdsaSig, _ := ecdsaWallet.Sign(hash[:])
+	schnorrSig, _ := schnorrWallet.Sign(hash[:])
+	if VerifySignature(schnorrWallet.PublicKey, hash[:], ecdsaSig) {
+		t.Error("ECDSA signature accepted by a Schnorr key")
+	}
+	if VerifySignature(ecdsaWallet.PublicKey, hash[:], schnorrSig) {
+		t.Error("Schnorr signature accepted by an ECDSA key")
+	}
+	if VerifySignature(ecdsaWallet.PublicKey, hash[:16], ecdsaSig) {
+		t.Error("short hash accepted")
+	}
+}
+
+func TestKeyTypes(t *testing.T) {
+	for _, kt := range []KeyType{KeyP256, KeySecp256k1, KeySchnorr} {
+		parsed, err := ParseKeyType(kt.String())
+		if err != nil || parsed != kt {
+			t.Errorf("ParseKeyType(%q) = %v, %v", kt.String(), parsed, err)
+		}
+		wallet := NewWalletOfType(kt)
+		if got, err := KeyTypeOf(wallet.PublicKey); err != nil || got != kt {
+			t.Errorf("KeyTypeOf(%v key) = %v, %v", kt, got, err)
+		}
+		decoded, err := decodePrivateKey(encodePrivateKey(wallet))
+		if err != nil || !bytes.Equal(decoded.PublicKey, wallet.PublicKey) {
+			t.Errorf("%v private key does not survive encoding: %v", kt, err)
+		}
+	}
+	if _, err := ParseKeyType("rsa"); !errors.Is(err, ErrUnknownKeyType) {
+		t.Errorf("ParseKeyType(rsa) error %v", err)
+	}
+	if _, err := KeyTypeOf(make([]byte, 33)); !errors.Is(err, ErrUnknownKeyType) {
+		t.Errorf("33 byte key without a compressed prefix: error %v", err)
+	}
+	if _, err := NewWalletFromKey(KeySchnorr, make([]byte, 32)); err == nil {
+		t.Error("zero private key accepted")
+	}
+}
@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// messageMagic prefixes every signed message so a message signature can
+// never be replayed as a transaction signature
+const messageMagic = "Aztecs Signed Message:\n"
+
+// ErrMessageSignature is returned for signatures that cannot be decoded
+var ErrMessageSignature = errors.New("malformed message signature")
+
+// MessageHash returns the domain separated double SHA-256 digest signed for message
+func MessageHash(message string) []byte {
+	var buf bytes.Buffer
+	buf.Write(binary.AppendUvarint(nil, uint64(len(messageMagic))))
+	buf.WriteString(messageMagic)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(message))))
+	buf.WriteString(message)
+
+	first := sha256.Sum256(buf.Bytes())
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// SignMessage signs message with the wallet key. The base64 result holds the
+// public key followed by the signature, so it verifies against the address
+// for every key type.
+func (w Wallet) SignMessage(message string) (string, error) {
+	sig, err := w.Sign(MessageHash(message))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(append(append([]byte{}, w.PublicKey...), sig...)), nil
+}
+
+// VerifyMessage reports whether signature, as made by SignMessage, signs
+// message with the key of address. Malformed addresses and signatures are
+// errors rather than false.
+func VerifyMessage(address, signature, message string) (bool, error) {
+	_, pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		return false, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrMessageSignature, err)
+	}
+	if len(raw) <= signatureLen {
+		return false, fmt.Errorf("%w: %d bytes", ErrMessageSignature, len(raw))
+	}
+	pubKey, sig := raw[:len(raw)-signatureLen], raw[len(raw)-signatureLen:]
+	if _, err := KeyTypeOf(pubKey); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrMessageSignature, err)
+	}
+
+	if !bytes.Equal(PublicKeyHash(pubKey), pubKeyHash) {
+		return false, nil // Signed by a different key
+	}
+	return VerifySignature(pubKey, MessageHash(message), sig), nil
+}
@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"strings"
+)
+
+// Mnemonics follow BIP39: entropy plus a SHA-256 checksum split into 11 bit
+// word indices, stretched into a seed with PBKDF2-HMAC-SHA512.
+const (
+	MinEntropyBits     = 128
+	MaxEntropyBits     = 256
+	DefaultEntropyBits = 128 // 12 words
+	mnemonicIterations = 2048
+	englishChecksum    = 0xc1dbd296 // CRC32 of the BIP39 english.txt
+)
+
+// Errors returned by mnemonic validation
+var (
+	ErrInvalidMnemonic  = errors.New("invalid mnemonic")
+	ErrMnemonicChecksum = errors.New("mnemonic checksum mismatch")
+)
+
+//go:embed wordlists/english.txt
+var englishWordlist string
+
+// englishWords is the BIP39 English wordlist and wordIndex its reverse lookup
+var (
+	englishWords = strings.Fields(englishWordlist)
+	wordIndex    = make(map[string]int, len(englishWords))
+)
+
+func init() {
+	if crc32.ChecksumIEEE([]byte(englishWordlist)) != englishChecksum || len(englishWords) != 2048 {
+		panic("embedded BIP39 english wordlist is corrupt")
+	}
+	for i, word := range englishWords {
+		wordIndex[word] = i
+	}
+}
+
+// NewMnemonic creates a mnemonic from bits of random entropy, a multiple of 32 between 128 and 256
+func NewMnemonic(bits int) (string, error) {
+	if bits < MinEntropyBits || bits > MaxEntropyBits || bits%32 != 0 {
+		return "", fmt.Errorf("entropy must be a multiple of 32 bits between %d and %d", MinEntropyBits, MaxEntropyBits)
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return MnemonicFromEntropy(entropy)
+}
+
+// MnemonicFromEntropy encodes entropy of 16 to 32 bytes as a mnemonic
+func MnemonicFromEntropy(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < MinEntropyBits || bits > MaxEntropyBits || bits%32 != 0 {
+		return "", fmt.Errorf("entropy must be a multiple of 32 bits between %d and %d", MinEntropyBits, MaxEntropyBits)
+	}
+	checksumBits := bits / 32
+	hash := sha256.Sum256(entropy)
+
+	// Append the checksum bits to the entropy, then read 11 bits per word
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(checksumBits))
+	data.Or(data, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	words := make([]string, (bits+checksumBits)/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = englishWords[new(big.Int).And(data, mask).Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic and verifies its checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: got %d words, want 12, 15, 18, 21 or 24", ErrInvalidMnemonic, len(words))
+	}
+
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+
+	checksumBits := len(words) / 3
+	checksum := new(big.Int).And(data, big.NewInt(1<<checksumBits-1)).Int64()
+	data.Rsh(data, uint(checksumBits))
+	entropy := data.FillBytes(make([]byte, checksumBits*4))
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, ErrMnemonicChecksum
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic checks the words and checksum of a mnemonic
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
+
+// MnemonicToSeed validates a mnemonic and derives the 64 byte HD seed, with
+// an optional passphrase. Words are normalized to lower case single spaces;
+// the passphrase is used as given.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	return pbkdf2.Key(sha512.New, normalized, []byte("mnemonic"+passphrase), mnemonicIterations, 64)
+}
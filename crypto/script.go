@@ -0,0 +1,55 @@
+package crypto
+
+import "sort"
+
+// AddScript stores a redeem script, such as a multisig script, and returns
+// its base58 script address. The address is the hash of the script as
+// computed by PublicKeyHash. Adding a known script again is not an error.
+func (ws *Wallets) AddScript(redeemScript []byte) string {
+	address := EncodeScriptAddress(PublicKeyHash(redeemScript), AddressBase58)
+
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	ws.scripts[address] = redeemScript
+	return address
+}
+
+// GetScript returns the redeem script of a script address in any format
+func (ws *Wallets) GetScript(address string) ([]byte, bool) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if canonical, err := FormatAddress(address, AddressBase58); err == nil {
+		address = canonical
+	}
+	redeemScript, ok := ws.scripts[address]
+	return redeemScript, ok
+}
+
+// GetScriptAddresses returns the addresses of all stored redeem scripts
+func (ws *Wallets) GetScriptAddresses() []string {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	addresses := []string{}
+	for address := range ws.scripts {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// FindPublicKey returns the public key of a wallet address in any format,
+// which is readable while an encrypted wallet is locked
+func (ws *Wallets) FindPublicKey(address string) ([]byte, bool) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if wallet, ok := ws.Wallets[ws.resolveAddress(address)]; ok {
+		return wallet.PublicKey, true
+	}
+	if entry, ok := ws.watch[ws.resolveAddress(address)]; ok && entry.PubKey != nil {
+		return entry.PubKey, true
+	}
+	return nil, false
+}
@@ -1,14 +1,21 @@
 package crypto
 
 import (
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob" // Import encoding/gob
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"math/big"
 	"os" // Import os
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil/base58" // Import base58 library
 	"golang.org/x/crypto/ripemd160"           // For generating addresses
@@ -16,6 +23,9 @@ import (
 
 const walletFile = "wallets.dat" // Define wallet file name
 
+// ErrWalletNotFound is returned for addresses that are not in the wallet
+var ErrWalletNotFound = errors.New("wallet not found")
+
 // Wallet represents a cryptocurrency wallet
 type Wallet struct {
 	PrivateKey *ecdsa.PrivateKey
@@ -24,13 +34,39 @@ type Wallet struct {
 
 // Wallets represents a collection of wallets
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets  map[string]*Wallet
+	filePath string // Location of wallets.dat inside the data directory
+
+	mtx       sync.Mutex
+	crypt     *walletCrypt // Encrypted private keys, nil while the file is unencrypted
+	key       []byte       // Key derived from the passphrase while unlocked
+	lockTimer *time.Timer
+
+	hd     *hdChain // Deterministic key chain, nil for wallets of random keys only
+	hdSeed []byte   // Seed of hd, nil while an encrypted wallet is locked
+
+	watch   map[string]*WatchOnly // Addresses tracked without their keys
+	scripts map[string][]byte     // Script address -> redeem script
 }
 
-// NewWallets creates and returns a new Wallets instance
-func NewWallets() (*Wallets, error) {
-	wallets := Wallets{}
+// walletStore is the on-disk form of wallets.dat. Once encryption is enabled
+// Wallets stays empty and the private keys only exist inside Crypt.
+type walletStore struct {
+	Wallets    map[string]*Wallet
+	PublicKeys map[string][]byte // Address -> public key, readable while locked
+	Crypt      *walletCrypt
+	HD         *hdChain
+	HDSeed     []byte // Only written while the file is unencrypted
+	WatchOnly  map[string]*WatchOnly
+	Scripts    map[string][]byte
+}
+
+// NewWallets creates a Wallets instance, loading wallets.dat from dataDir if present
+func NewWallets(dataDir string) (*Wallets, error) {
+	wallets := Wallets{filePath: filepath.Join(dataDir, walletFile)}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.watch = make(map[string]*WatchOnly)
+	wallets.scripts = make(map[string][]byte)
 
 	err := wallets.LoadFromFile() // Call the method on the wallets instance
 	if err != nil && !os.IsNotExist(err) {
@@ -57,22 +93,68 @@ func newKeyPair() (*ecdsa.PrivateKey, []byte) {
 	if err != nil {
 		log.Panic(err)
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return private, pubKey
+	return private, encodePublicKey(&private.PublicKey)
 }
 
-// GetAddress returns the wallet address
-func (w Wallet) GetAddress() []byte {
-	pubHash := PublicKeyHash(w.PublicKey)
+// encodePublicKey serializes a public key as X || Y, each padded to 32 bytes
+func encodePublicKey(pub *ecdsa.PublicKey) []byte {
+	return append(pub.X.FillBytes(make([]byte, 32)), pub.Y.FillBytes(make([]byte, 32))...)
+}
+
+// NewWalletFromPrivateKey rebuilds a Wallet from its raw private scalar
+func NewWalletFromPrivateKey(d []byte) (*Wallet, error) {
+	if len(d) > 32 {
+		return nil, fmt.Errorf("private key is %d bytes, want at most 32", len(d))
+	}
+	padded := make([]byte, 32)
+	copy(padded[32-len(d):], d)
+
+	ecdhKey, err := ecdh.P256().NewPrivateKey(padded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	point := ecdhKey.PublicKey().Bytes() // 0x04 || X || Y
+
+	private := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(padded),
+	}
+	return &Wallet{private, encodePublicKey(&private.PublicKey)}, nil
+}
+
+// PrivateKeyBytes returns the raw 32 byte private scalar of the wallet
+func (w Wallet) PrivateKeyBytes() []byte {
+	return w.PrivateKey.D.FillBytes(make([]byte, 32))
+}
 
-	version := byte(0x00) // Mainnet version byte
-	payload := append([]byte{version}, pubHash...)
-	checksum := checksum(payload)
+// GobEncode stores only the private scalar and key type, since the curve
+// inside ecdsa.PrivateKey cannot be gob encoded
+func (w Wallet) GobEncode() ([]byte, error) {
+	return encodePrivateKey(&w), nil
+}
 
-	fullPayload := append(payload, checksum...)
-	address := base58.Encode(fullPayload) // Use base58.Encode
+// GobDecode rebuilds the wallet from the private key written by GobEncode
+func (w *Wallet) GobDecode(data []byte) error {
+	wallet, err := decodePrivateKey(data)
+	if err != nil {
+		return err
+	}
+	*w = *wallet
+	return nil
+}
 
-	return []byte(address) // Return as byte slice
+// GetAddress returns the base58check wallet address
+func (w Wallet) GetAddress() []byte {
+	return []byte(w.GetAddressAs(AddressBase58))
+}
+
+// GetAddressAs returns the wallet address in format
+func (w Wallet) GetAddressAs(format AddressFormat) string {
+	return EncodeAddress(PublicKeyHash(w.PublicKey), format)
 }
 
 // PublicKeyHash hashes the public key
@@ -102,52 +184,182 @@ func Base58Decode(input []byte) []byte {
 	return base58.Decode(string(input))
 }
 
-// ValidateAddress checks if address is valid
+// ValidateAddress checks if address is a valid address of the active network
 func ValidateAddress(address []byte) bool {
-	pubKeyHash := Base58Decode(address)
-	if len(pubKeyHash) < 4 { // Check minimum length
-		return false
+	_, _, err := DecodeAddress(string(address))
+	return err == nil
+}
+
+// AddWallet creates a new wallet, adds it to the collection and returns its address.
+// Encrypted wallets must be unlocked, since the new key has to be encrypted.
+func (ws *Wallets) AddWallet() (string, error) {
+	return ws.AddWalletOfType(KeyP256)
+}
+
+// AddWalletOfType is AddWallet with a key of type kt. HD wallets derive
+// P-256 keys only, so other types always get a random key.
+func (ws *Wallets) AddWalletOfType(kt KeyType) (string, error) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.crypt != nil && ws.key == nil {
+		return "", ErrWalletLocked
 	}
+	if ws.hd != nil && kt == KeyP256 {
+		return ws.deriveNext(hdReceiveBranch)
+	}
+	wallet := NewWalletOfType(kt)
+	address := string(wallet.GetAddress())
+	ws.Wallets[address] = wallet
+	return address, nil
+}
 
-	checksumBytes := pubKeyHash[len(pubKeyHash)-4:]
-	versionedPayload := pubKeyHash[:len(pubKeyHash)-4]
-	actualChecksum := checksum(versionedPayload)
+// GetAddresses returns the addresses of all wallets
+func (ws *Wallets) GetAddresses() []string {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	addresses := []string{}
+	for address := range ws.Wallets {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
 
-	return hex.EncodeToString(checksumBytes) == hex.EncodeToString(actualChecksum)
+// HasAddress reports whether the wallet holds a key for the address, given in any format
+func (ws *Wallets) HasAddress(address string) bool {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	_, ok := ws.Wallets[ws.resolveAddress(address)]
+	return ok
 }
 
-// SaveToFile saves the wallets to a file
+// resolveAddress maps an address in any format to the base58 key of Wallets,
+// must be called with the lock held
+func (ws *Wallets) resolveAddress(address string) string {
+	if _, ok := ws.Wallets[address]; ok {
+		return address
+	}
+	if canonical, err := FormatAddress(address, AddressBase58); err == nil {
+		return canonical
+	}
+	return address
+}
+
+// GetWallet returns the wallet for an address. Encrypted wallets must be unlocked.
+func (ws *Wallets) GetWallet(address string) (*Wallet, error) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	resolved := ws.resolveAddress(address)
+	wallet, ok := ws.Wallets[resolved]
+	if !ok {
+		if _, ok := ws.watch[resolved]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrWatchOnly, address)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+	if wallet.PrivateKey == nil {
+		return nil, ErrWalletLocked
+	}
+	return wallet, nil
+}
+
+// SaveToFile saves the wallets to a file. Private keys of an encrypted
+// wallet are only ever written inside the encrypted envelope.
 func (ws *Wallets) SaveToFile() {
-	file, err := os.Create(walletFile)
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	ws.saveToFile()
+}
+
+// saveToFile must be called with the lock held
+func (ws *Wallets) saveToFile() {
+	store := walletStore{PublicKeys: make(map[string][]byte), HD: ws.hd, WatchOnly: ws.watch, Scripts: ws.scripts}
+	for address, wallet := range ws.Wallets {
+		store.PublicKeys[address] = wallet.PublicKey
+	}
+	if ws.crypt == nil {
+		store.Wallets = ws.Wallets
+		store.HDSeed = ws.hdSeed
+	} else {
+		if ws.key != nil {
+			// Unlocked, so re-encrypt to include keys added since the last save
+			crypt, err := ws.crypt.seal(ws.key, ws.secrets())
+			if err != nil {
+				log.Panic(err)
+			}
+			ws.crypt = crypt
+		}
+		store.Crypt = ws.crypt
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated wallet
+	tmpPath := ws.filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		log.Panic(err)
 	}
-	defer file.Close()
 
 	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(ws)
+	err = encoder.Encode(store)
 	if err != nil {
 		log.Panic(err)
 	}
+	if err := file.Close(); err != nil {
+		log.Panic(err)
+	}
+	if err := os.Rename(tmpPath, ws.filePath); err != nil {
+		log.Panic(err)
+	}
 }
 
 // LoadFromFile loads wallets from a file
 func (ws *Wallets) LoadFromFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(ws.filePath); os.IsNotExist(err) {
 		return err // File does not exist, return the error
 	}
 
-	file, err := os.Open(walletFile)
+	file, err := os.Open(ws.filePath)
 	if err != nil {
 		log.Panic(err)
 	}
 	defer file.Close()
 
+	var store walletStore
 	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(ws)
+	err = decoder.Decode(&store)
 	if err != nil {
 		log.Panic(err)
 	}
 
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	ws.crypt = store.Crypt
+	ws.key = nil
+	ws.hd = store.HD
+	ws.hdSeed = store.HDSeed
+	ws.watch = store.WatchOnly
+	if ws.watch == nil {
+		ws.watch = make(map[string]*WatchOnly)
+	}
+	ws.scripts = store.Scripts
+	if ws.scripts == nil {
+		ws.scripts = make(map[string][]byte)
+	}
+	ws.Wallets = make(map[string]*Wallet)
+	if store.Crypt == nil {
+		for address, wallet := range store.Wallets {
+			ws.Wallets[address] = wallet
+		}
+		return nil
+	}
+
+	// Encrypted wallets start out locked with only their public keys loaded
+	for address, pubKey := range store.PublicKeys {
+		ws.Wallets[address] = &Wallet{PrivateKey: nil, PublicKey: pubKey}
+	}
 	return nil // Return nil on success
 }
\ No newline at end of file
@@ -0,0 +1,258 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt cost parameters for newly encrypted wallets
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltSize     = 16
+)
+
+// Errors returned by wallet encryption operations
+var (
+	ErrWalletLocked           = errors.New("wallet is locked, unlock it with walletpassphrase first")
+	ErrWalletNotEncrypted     = errors.New("wallet is not encrypted")
+	ErrWalletAlreadyEncrypted = errors.New("wallet is already encrypted")
+	ErrWrongPassphrase        = errors.New("wallet passphrase is incorrect")
+)
+
+// walletSecrets is the plaintext sealed inside a walletCrypt
+type walletSecrets struct {
+	Keys   map[string][]byte // Address -> private scalar
+	HDSeed []byte            // Seed of the HD chain, nil if the wallet has none
+}
+
+// walletCrypt is an scrypt and AES-GCM envelope around the wallet private keys
+type walletCrypt struct {
+	Salt       []byte
+	N, R, P    int // scrypt cost parameters
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// newWalletCrypt creates an empty envelope with a fresh salt and returns the key for passphrase
+func newWalletCrypt(passphrase string) (*walletCrypt, []byte, error) {
+	crypt := &walletCrypt{Salt: make([]byte, saltSize), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(crypt.Salt); err != nil {
+		return nil, nil, err
+	}
+	key, err := crypt.deriveKey(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crypt, key, nil
+}
+
+// deriveKey stretches the passphrase into an AES-256 key
+func (c *walletCrypt) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), c.Salt, c.N, c.R, c.P, scryptKeyLen)
+}
+
+// seal encrypts the wallet secrets under key
+func (c *walletCrypt) seal(key []byte, secrets *walletSecrets) (*walletCrypt, error) {
+	var plaintext bytes.Buffer
+	if err := gob.NewEncoder(&plaintext).Encode(secrets); err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := *c
+	sealed.Nonce = nonce
+	sealed.Ciphertext = aead.Seal(nil, nonce, plaintext.Bytes(), c.Salt)
+	return &sealed, nil
+}
+
+// open decrypts the wallet secrets, failing with ErrWrongPassphrase if key is wrong
+func (c *walletCrypt) open(key []byte) (*walletSecrets, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, c.Nonce, c.Ciphertext, c.Salt)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	secrets := &walletSecrets{}
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(secrets); err != nil {
+		return nil, fmt.Errorf("decode wallet keys: %w", err)
+	}
+	return secrets, nil
+}
+
+// newGCM creates an AES-GCM cipher from a 32 byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secrets collects the private keys of all wallets and the HD seed, must be called with the lock held
+func (ws *Wallets) secrets() *walletSecrets {
+	secrets := &walletSecrets{Keys: make(map[string][]byte), HDSeed: ws.hdSeed}
+	for address, wallet := range ws.Wallets {
+		if wallet.PrivateKey != nil {
+			secrets.Keys[address] = encodePrivateKey(wallet)
+		}
+	}
+	return secrets
+}
+
+// IsEncrypted reports whether the wallet file is encrypted
+func (ws *Wallets) IsEncrypted() bool {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	return ws.crypt != nil
+}
+
+// IsLocked reports whether the private keys are currently unavailable
+func (ws *Wallets) IsLocked() bool {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	return ws.crypt != nil && ws.key == nil
+}
+
+// EncryptWallet encrypts all private keys with passphrase, saves the file and locks the wallet
+func (ws *Wallets) EncryptWallet(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("passphrase must not be empty")
+	}
+
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.crypt != nil {
+		return ErrWalletAlreadyEncrypted
+	}
+	crypt, key, err := newWalletCrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	ws.crypt = crypt
+	ws.key = key
+	ws.saveToFile()
+	ws.lock()
+	return nil
+}
+
+// Unlock decrypts the private keys and keeps them in memory for timeout.
+// A timeout of zero keeps the wallet unlocked until Lock is called.
+func (ws *Wallets) Unlock(passphrase string, timeout time.Duration) error {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.crypt == nil {
+		return ErrWalletNotEncrypted
+	}
+	key, err := ws.crypt.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	secrets, err := ws.crypt.open(key)
+	if err != nil {
+		return err
+	}
+
+	for address, d := range secrets.Keys {
+		wallet, err := decodePrivateKey(d)
+		if err != nil {
+			return err
+		}
+		ws.Wallets[address] = wallet
+	}
+	ws.hdSeed = secrets.HDSeed
+	ws.key = key
+
+	if ws.lockTimer != nil {
+		ws.lockTimer.Stop()
+		ws.lockTimer = nil
+	}
+	if timeout > 0 {
+		ws.lockTimer = time.AfterFunc(timeout, ws.Lock)
+	}
+	return nil
+}
+
+// Lock forgets the decrypted private keys
+func (ws *Wallets) Lock() {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	ws.lock()
+}
+
+// lock must be called with the lock held
+func (ws *Wallets) lock() {
+	if ws.crypt == nil {
+		return
+	}
+	for address, wallet := range ws.Wallets {
+		ws.Wallets[address] = &Wallet{PrivateKey: nil, PublicKey: wallet.PublicKey}
+	}
+	ws.hdSeed = nil
+	ws.key = nil
+	if ws.lockTimer != nil {
+		ws.lockTimer.Stop()
+		ws.lockTimer = nil
+	}
+}
+
+// ChangePassphrase re-encrypts the private keys under a new passphrase and saves the file
+func (ws *Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if newPassphrase == "" {
+		return errors.New("passphrase must not be empty")
+	}
+
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.crypt == nil {
+		return ErrWalletNotEncrypted
+	}
+	oldKey, err := ws.crypt.deriveKey(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	secrets, err := ws.crypt.open(oldKey)
+	if err != nil {
+		return err
+	}
+
+	crypt, newKey, err := newWalletCrypt(newPassphrase)
+	if err != nil {
+		return err
+	}
+	if ws.crypt, err = crypt.seal(newKey, secrets); err != nil {
+		return err
+	}
+
+	// Keep the previous lock state, but under the new key
+	if ws.key != nil {
+		ws.key = newKey
+	}
+	ws.saveToFile()
+	return nil
+}
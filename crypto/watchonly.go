@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Errors returned for watch-only entries
+var (
+	ErrWatchOnly     = errors.New("address is watch-only and cannot sign")
+	ErrAddressExists = errors.New("address is already in the wallet")
+)
+
+// WatchOnly is an address tracked without its private key
+type WatchOnly struct {
+	PubKeyHash []byte
+	PubKey     []byte // Only known when a public key was imported
+	FromHeight int64  // Balance and history only count blocks from this height
+}
+
+// ImportAddress adds a watch-only entry for an address of either format and
+// returns its base58 form. Blocks below fromHeight are ignored for it.
+func (ws *Wallets) ImportAddress(address string, fromHeight int64) (string, error) {
+	pubKeyHash, err := DecodeKeyAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return ws.addWatchOnly(&WatchOnly{PubKeyHash: pubKeyHash, FromHeight: fromHeight})
+}
+
+// ImportPublicKey adds a watch-only entry for the address of pubKey
+func (ws *Wallets) ImportPublicKey(pubKey []byte, fromHeight int64) (string, error) {
+	if _, err := KeyTypeOf(pubKey); err != nil {
+		return "", err
+	}
+	return ws.addWatchOnly(&WatchOnly{PubKeyHash: PublicKeyHash(pubKey), PubKey: pubKey, FromHeight: fromHeight})
+}
+
+// addWatchOnly stores entry unless its address is already known
+func (ws *Wallets) addWatchOnly(entry *WatchOnly) (string, error) {
+	if entry.FromHeight < 0 {
+		return "", fmt.Errorf("rescan height must not be negative, got %d", entry.FromHeight)
+	}
+	address := EncodeAddress(entry.PubKeyHash, AddressBase58)
+
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if _, ok := ws.Wallets[address]; ok {
+		return "", fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+	if existing, ok := ws.watch[address]; ok {
+		// Importing the public key of a watched address fills it in
+		if existing.PubKey == nil && entry.PubKey != nil {
+			existing.PubKey = entry.PubKey
+			existing.FromHeight = min(existing.FromHeight, entry.FromHeight)
+			return address, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+	ws.watch[address] = entry
+	return address, nil
+}
+
+// GetWatchOnly returns the watch-only entry of an address in any format
+func (ws *Wallets) GetWatchOnly(address string) (*WatchOnly, bool) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if canonical, err := FormatAddress(address, AddressBase58); err == nil {
+		address = canonical
+	}
+	entry, ok := ws.watch[address]
+	return entry, ok
+}
+
+// GetWatchOnlyAddresses returns the addresses of all watch-only entries
+func (ws *Wallets) GetWatchOnlyAddresses() []string {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	addresses := []string{}
+	for address := range ws.watch {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// HistoryStart returns the first block height counted for an address: the
+// rescan height of a watch-only entry, otherwise 0
+func (ws *Wallets) HistoryStart(address string) int64 {
+	if entry, ok := ws.GetWatchOnly(address); ok {
+		return entry.FromHeight
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+
+	"aztecs/params"
+)
+
+// Errors returned by DecodePrivateKey
+var (
+	ErrPrivateKeyFormat   = errors.New("private key is malformed")
+	ErrPrivateKeyChecksum = errors.New("private key checksum mismatch")
+	ErrPrivateKeyNetwork  = errors.New("private key belongs to another network")
+)
+
+// EncodePrivateKey exports the key of w in a WIF-like base58check form: the
+// network's private key version byte, the 32 byte scalar and, for key types
+// other than P-256, a trailing key type byte
+func EncodePrivateKey(w *Wallet) string {
+	payload := append([]byte{params.Active.PrivateKeyID}, w.PrivateKeyBytes()...)
+	if kt := w.KeyType(); kt != KeyP256 {
+		payload = append(payload, byte(kt))
+	}
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// DecodePrivateKey parses a key made by EncodePrivateKey for the active network
+func DecodePrivateKey(encoded string) (*Wallet, error) {
+	raw := base58.Decode(encoded)
+	if len(raw) != 1+privateKeyLen+4 && len(raw) != 1+privateKeyLen+1+4 {
+		return nil, ErrPrivateKeyFormat
+	}
+	payload, sum := raw[:len(raw)-4], raw[len(raw)-4:]
+	if !bytes.Equal(checksum(payload), sum) {
+		return nil, ErrPrivateKeyChecksum
+	}
+	if payload[0] != params.Active.PrivateKeyID {
+		return nil, fmt.Errorf("%w: version 0x%02x, %s uses 0x%02x", ErrPrivateKeyNetwork, payload[0], params.Active.Name, params.Active.PrivateKeyID)
+	}
+
+	kt := KeyP256
+	if len(payload) == 1+privateKeyLen+1 {
+		kt = KeyType(payload[1+privateKeyLen])
+	}
+	wallet, err := NewWalletFromKey(kt, payload[1:1+privateKeyLen])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPrivateKeyFormat, err)
+	}
+	return wallet, nil
+}
+
+// DumpPrivateKey exports the private key of an address. Locked wallets and
+// watch-only entries are refused.
+func (ws *Wallets) DumpPrivateKey(address string) (string, error) {
+	wallet, err := ws.GetWallet(address)
+	if err != nil {
+		return "", err
+	}
+	return EncodePrivateKey(wallet), nil
+}
+
+// ImportPrivateKey adds an exported private key and returns its address. A
+// watch-only entry for the address is replaced. Encrypted wallets must be
+// unlocked, since the key has to be encrypted.
+func (ws *Wallets) ImportPrivateKey(encoded string) (string, error) {
+	wallet, err := DecodePrivateKey(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	if ws.crypt != nil && ws.key == nil {
+		return "", ErrWalletLocked
+	}
+	address := string(wallet.GetAddress())
+	if _, ok := ws.Wallets[address]; ok {
+		return "", fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+	delete(ws.watch, address)
+	ws.Wallets[address] = wallet
+	return address, nil
+}
@@ -5,7 +5,7 @@ import axios from 'axios'; // Import axios
 const { Title } = Typography;
 
 function WalletManager() {
-  const [wallets, setWallets] = useState([]); // wallets will now be an array of objects { address: string, balance: number }
+  const [wallets, setWallets] = useState([]); // wallets will now be an array of objects { address: string, watchOnly: boolean, balance: number }
   const [newWalletAddress, setNewWalletAddress] = useState('');
   const [loading, setLoading] = useState(false); // Add loading state
   const [fetchingWallets, setFetchingWallets] = useState(true); // Add state for fetching wallets
@@ -13,16 +13,16 @@ function WalletManager() {
   const fetchWallets = async () => { // Add fetchWallets function
     try {
       const response = await axios.get('http://localhost:8080/wallets'); // Call get wallets API
-      const addresses = response.data.wallets;
+      const entries = response.data.wallets; // { address, watchOnly } for each wallet
 
       // Fetch balance for each wallet
-      const walletsWithBalance = await Promise.all(addresses.map(async (address) => {
+      const walletsWithBalance = await Promise.all(entries.map(async ({ address, watchOnly }) => {
         try {
           const balanceResponse = await axios.get(`http://localhost:8080/wallets/${address}/balance`);
-          return { address, balance: balanceResponse.data.balance };
+          return { address, watchOnly, balance: balanceResponse.data.balance };
         } catch (balanceError) {
           console.error(`Error fetching balance for ${address}:`, balanceError);
-          return { address, balance: 'Error' }; // Handle error case
+          return { address, watchOnly, balance: 'Error' }; // Handle error case
         }
       }));
 
@@ -68,10 +68,10 @@ function WalletManager() {
         bordered
         dataSource={wallets}
         loading={fetchingWallets} // Add loading state to list
-        renderItem={(item) => ( // item is now an object { address, balance }
+        renderItem={(item) => ( // item is now an object { address, watchOnly, balance }
           <List.Item>
             <div>
-              <strong>地址:</strong> {item.address} <br />
+              <strong>地址:</strong> {item.address} {item.watchOnly && '(仅观察)'} <br />
               <strong>余额:</strong> {item.balance} AZT
             </div>
             {/* TODO: Add functionality to view wallet details */}
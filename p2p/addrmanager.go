@@ -0,0 +1,429 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const peersFile = "peers.dat" // Define peers data file name
+
+const (
+	newBucketCount     = 64   // Number of buckets for addresses we have only heard about
+	triedBucketCount   = 16   // Number of buckets for addresses we have connected to
+	newBucketSize      = 64   // Maximum addresses in a single new bucket
+	triedBucketSize    = 64   // Maximum addresses in a single tried bucket
+	newBucketsPerGroup = 8    // Source groups can only reach this many new buckets
+	maxAddrPerMessage  = 1000 // Maximum addresses sent in one addr message
+	maxFailures        = 10   // Attempts without success before an address is dropped
+	staleAfter         = 30 * 24 * time.Hour
+)
+
+// KnownAddress tracks what we know about a peer address
+type KnownAddress struct {
+	Addr        string    // Peer address in host:port form
+	Source      string    // Address of the peer that told us about it
+	LastSeen    time.Time // Last time the address was advertised or connected
+	LastAttempt time.Time // Last time we tried to connect
+	LastSuccess time.Time // Last time a connection succeeded
+	Attempts    int       // Failed attempts since the last success
+	Tried       bool      // Whether the address lives in a tried bucket
+}
+
+// isBad reports whether the address is not worth keeping
+func (ka *KnownAddress) isBad() bool {
+	if ka.Tried {
+		return false
+	}
+	if !ka.LastSeen.IsZero() && time.Since(ka.LastSeen) > staleAfter {
+		return true
+	}
+	return ka.Attempts >= maxFailures
+}
+
+// AddrManager keeps new and tried peer addresses and persists them to peers.dat
+type AddrManager struct {
+	mtx       sync.Mutex
+	filePath  string
+	key       [32]byte // Secret used to randomise bucket placement
+	addrIndex map[string]*KnownAddress
+	newBucket [newBucketCount]map[string]*KnownAddress
+	tried     [triedBucketCount]map[string]*KnownAddress
+	seeds     []string
+}
+
+// peersData is the on-disk form of the address manager
+type peersData struct {
+	Key       [32]byte
+	Addresses []*KnownAddress
+}
+
+// NewAddrManager creates an address manager backed by peers.dat in dataDir
+// and seeded with the given peer addresses
+func NewAddrManager(dataDir string, seeds []string) (*AddrManager, error) {
+	am := &AddrManager{
+		filePath:  filepath.Join(dataDir, peersFile),
+		addrIndex: make(map[string]*KnownAddress),
+		seeds:     seeds,
+	}
+	am.reset()
+
+	err := am.LoadFromFile()
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading peers from file: %v", err)
+		return nil, err
+	}
+	if os.IsNotExist(err) {
+		// Fresh address manager, pick a new bucketing key
+		if _, err := rand.Read(am.key[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Seed peers are always known, even when peers.dat already exists
+	for _, seed := range seeds {
+		am.AddAddress(seed, seed)
+	}
+
+	return am, nil
+}
+
+// reset clears all buckets and the address index
+func (am *AddrManager) reset() {
+	am.addrIndex = make(map[string]*KnownAddress)
+	for i := range am.newBucket {
+		am.newBucket[i] = make(map[string]*KnownAddress)
+	}
+	for i := range am.tried {
+		am.tried[i] = make(map[string]*KnownAddress)
+	}
+}
+
+// GroupKey returns the network group of an address. Addresses in the same
+// group (an IPv4 /16 or IPv6 /32) are assumed to be run by the same operator.
+func GroupKey(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "host:" + host // Unresolved hostnames are their own group
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return "local"
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d", ip4[0], ip4[1])
+	}
+	return fmt.Sprintf("%x", []byte(ip.To16()[:4]))
+}
+
+// hashIndex hashes the key and parts into a bucket index below n
+func (am *AddrManager) hashIndex(n int, parts ...string) int {
+	h := sha256.New()
+	h.Write(am.key[:])
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return int(binary.BigEndian.Uint64(h.Sum(nil)[:8]) % uint64(n))
+}
+
+// newBucketIndex picks the new bucket for an address heard from src.
+// A single source group can only ever reach newBucketsPerGroup buckets.
+func (am *AddrManager) newBucketIndex(addr, src string) int {
+	slot := am.hashIndex(newBucketsPerGroup, GroupKey(addr), GroupKey(src))
+	return am.hashIndex(newBucketCount, GroupKey(src), fmt.Sprint(slot))
+}
+
+// triedBucketIndex picks the tried bucket for an address
+func (am *AddrManager) triedBucketIndex(addr string) int {
+	return am.hashIndex(triedBucketCount, GroupKey(addr), addr)
+}
+
+// AddAddress records an address advertised by src
+func (am *AddrManager) AddAddress(addr, src string) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+	am.addAddress(addr, src, time.Now())
+}
+
+// AddAddresses records several addresses advertised by src
+func (am *AddrManager) AddAddresses(addrs []NetAddress, src string) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+	for _, na := range addrs {
+		seen := time.Unix(na.Timestamp, 0)
+		if na.Timestamp == 0 || seen.After(time.Now()) {
+			seen = time.Now()
+		}
+		am.addAddress(na.Addr, src, seen)
+	}
+}
+
+// addAddress must be called with the lock held
+func (am *AddrManager) addAddress(addr, src string, seen time.Time) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		log.Printf("Ignoring malformed peer address %q", addr)
+		return
+	}
+
+	if ka, ok := am.addrIndex[addr]; ok {
+		if seen.After(ka.LastSeen) {
+			ka.LastSeen = seen
+		}
+		return
+	}
+
+	ka := &KnownAddress{Addr: addr, Source: src, LastSeen: seen}
+	bucket := am.newBucket[am.newBucketIndex(addr, src)]
+	if len(bucket) >= newBucketSize {
+		am.evictNew(bucket)
+	}
+	bucket[addr] = ka
+	am.addrIndex[addr] = ka
+}
+
+// evictNew drops the worst entry from a full new bucket
+func (am *AddrManager) evictNew(bucket map[string]*KnownAddress) {
+	var oldest *KnownAddress
+	for _, ka := range bucket {
+		if ka.isBad() {
+			oldest = ka
+			break
+		}
+		if oldest == nil || ka.LastSeen.Before(oldest.LastSeen) {
+			oldest = ka
+		}
+	}
+	if oldest != nil {
+		delete(bucket, oldest.Addr)
+		delete(am.addrIndex, oldest.Addr)
+	}
+}
+
+// Attempt marks that we are trying to connect to addr
+func (am *AddrManager) Attempt(addr string) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	ka, ok := am.addrIndex[addr]
+	if !ok {
+		return
+	}
+	ka.LastAttempt = time.Now()
+	ka.Attempts++
+}
+
+// Good marks addr as reachable and moves it to a tried bucket
+func (am *AddrManager) Good(addr string) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	ka, ok := am.addrIndex[addr]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	ka.LastSeen = now
+	ka.LastSuccess = now
+	ka.LastAttempt = now
+	ka.Attempts = 0
+	if ka.Tried {
+		return
+	}
+
+	// Remove from the new buckets
+	for _, bucket := range am.newBucket {
+		delete(bucket, addr)
+	}
+
+	bucket := am.tried[am.triedBucketIndex(addr)]
+	if len(bucket) >= triedBucketSize {
+		// Demote the least recently successful address back to new
+		var oldest *KnownAddress
+		for _, other := range bucket {
+			if oldest == nil || other.LastSuccess.Before(oldest.LastSuccess) {
+				oldest = other
+			}
+		}
+		delete(bucket, oldest.Addr)
+		oldest.Tried = false
+		newBucket := am.newBucket[am.newBucketIndex(oldest.Addr, oldest.Source)]
+		if len(newBucket) >= newBucketSize {
+			am.evictNew(newBucket)
+		}
+		newBucket[oldest.Addr] = oldest
+		am.addrIndex[oldest.Addr] = oldest
+	}
+	ka.Tried = true
+	bucket[addr] = ka
+}
+
+// Remove forgets an address entirely, dropping bad entries from the new buckets
+func (am *AddrManager) Remove(addr string) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	ka, ok := am.addrIndex[addr]
+	if !ok {
+		return
+	}
+	if ka.Tried {
+		delete(am.tried[am.triedBucketIndex(addr)], addr)
+	} else {
+		for _, bucket := range am.newBucket {
+			delete(bucket, addr)
+		}
+	}
+	delete(am.addrIndex, addr)
+}
+
+// NumAddresses returns the number of known addresses
+func (am *AddrManager) NumAddresses() int {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+	return len(am.addrIndex)
+}
+
+// AddressCache returns a random sample of good addresses for an addr message
+func (am *AddrManager) AddressCache() []NetAddress {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	addrs := []NetAddress{}
+	for _, ka := range am.addrIndex {
+		if ka.isBad() {
+			continue
+		}
+		addrs = append(addrs, NetAddress{Addr: ka.Addr, Timestamp: ka.LastSeen.Unix()})
+	}
+	shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	if len(addrs) > maxAddrPerMessage {
+		addrs = addrs[:maxAddrPerMessage]
+	}
+	return addrs
+}
+
+// SelectOutbound picks up to n addresses to connect to. No two picks share
+// a network group, and groups listed in exclude (e.g. those of peers we are
+// already connected to) are skipped, so a single subnet can never fill
+// every outbound slot.
+func (am *AddrManager) SelectOutbound(n int, exclude []string) []string {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	usedGroups := make(map[string]bool)
+	for _, addr := range exclude {
+		usedGroups[GroupKey(addr)] = true
+	}
+
+	// Prefer tried addresses but always mix in new ones
+	var tried, fresh []*KnownAddress
+	for _, ka := range am.addrIndex {
+		if ka.isBad() || time.Since(ka.LastAttempt) < time.Minute {
+			continue
+		}
+		if ka.Tried {
+			tried = append(tried, ka)
+		} else {
+			fresh = append(fresh, ka)
+		}
+	}
+	shuffle(len(tried), func(i, j int) { tried[i], tried[j] = tried[j], tried[i] })
+	shuffle(len(fresh), func(i, j int) { fresh[i], fresh[j] = fresh[j], fresh[i] })
+
+	selected := []string{}
+	for len(selected) < n && (len(tried) > 0 || len(fresh) > 0) {
+		var ka *KnownAddress
+		if len(fresh) == 0 || (len(tried) > 0 && randIntn(2) == 0) {
+			ka, tried = tried[0], tried[1:]
+		} else {
+			ka, fresh = fresh[0], fresh[1:]
+		}
+		group := GroupKey(ka.Addr)
+		if usedGroups[group] && group != "local" {
+			continue
+		}
+		usedGroups[group] = true
+		selected = append(selected, ka.Addr)
+	}
+	return selected
+}
+
+// SaveToFile saves the known addresses to peers.dat
+func (am *AddrManager) SaveToFile() error {
+	am.mtx.Lock()
+	data := peersData{Key: am.key}
+	for _, ka := range am.addrIndex {
+		if !ka.isBad() {
+			data.Addresses = append(data.Addresses, ka)
+		}
+	}
+	am.mtx.Unlock()
+
+	file, err := os.Create(am.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := gob.NewEncoder(file)
+	return encoder.Encode(data)
+}
+
+// LoadFromFile loads known addresses from peers.dat
+func (am *AddrManager) LoadFromFile() error {
+	file, err := os.Open(am.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var data peersData
+	decoder := gob.NewDecoder(file)
+	if err := decoder.Decode(&data); err != nil {
+		return fmt.Errorf("decode %s: %w", am.filePath, err)
+	}
+
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	am.reset()
+	am.key = data.Key
+	for _, ka := range data.Addresses {
+		am.addrIndex[ka.Addr] = ka
+		if ka.Tried {
+			am.tried[am.triedBucketIndex(ka.Addr)][ka.Addr] = ka
+		} else {
+			am.newBucket[am.newBucketIndex(ka.Addr, ka.Source)][ka.Addr] = ka
+		}
+	}
+	log.Printf("Loaded %d peer addresses from %s", len(am.addrIndex), am.filePath)
+	return nil
+}
+
+// shuffle performs a Fisher-Yates shuffle using crypto/rand
+func shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, randIntn(i+1))
+	}
+}
+
+// randIntn returns a uniform random int in [0, n)
+func randIntn(n int) int {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Panic(err)
+	}
+	return int(binary.BigEndian.Uint64(b[:]) % uint64(n))
+}
@@ -0,0 +1,162 @@
+package p2p
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestAddrManager(t *testing.T) *AddrManager {
+	t.Helper()
+	am, err := NewAddrManager(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return am
+}
+
+// testAddr returns a routable address in its own /16 group for each i
+func testAddr(i int) string {
+	return fmt.Sprintf("%d.%d.0.1:8333", 1+i/256, i%256)
+}
+
+func TestAddrManagerBucketPlacement(t *testing.T) {
+	am := newTestAddrManager(t)
+	const src = "203.0.113.7:8333"
+
+	buckets := make(map[int]bool)
+	for i := 0; i < 500; i++ {
+		addr := testAddr(i)
+		am.AddAddress(addr, src)
+		index := am.newBucketIndex(addr, src)
+		if _, ok := am.newBucket[index][addr]; !ok {
+			t.Fatalf("%s not in new bucket %d", addr, index)
+		}
+		buckets[index] = true
+	}
+	if len(buckets) > newBucketsPerGroup {
+		t.Errorf("one source group reached %d new buckets, want at most %d", len(buckets), newBucketsPerGroup)
+	}
+
+	// Placement depends on the secret key, so another manager spreads the same addresses differently
+	other := newTestAddrManager(t)
+	moved := false
+	for i := 0; i < 500 && !moved; i++ {
+		moved = other.newBucketIndex(testAddr(i), src) != am.newBucketIndex(testAddr(i), src)
+	}
+	if !moved {
+		t.Error("bucket placement does not depend on the key")
+	}
+}
+
+func TestAddrManagerGoodPromotesToTried(t *testing.T) {
+	am := newTestAddrManager(t)
+	addr := testAddr(0)
+	am.AddAddress(addr, "203.0.113.7:8333")
+	am.Attempt(addr)
+
+	am.Good(addr)
+	ka := am.addrIndex[addr]
+	if !ka.Tried || ka.Attempts != 0 || ka.LastSuccess.IsZero() {
+		t.Errorf("after Good: tried %v, attempts %d, last success %v", ka.Tried, ka.Attempts, ka.LastSuccess)
+	}
+	if _, ok := am.tried[am.triedBucketIndex(addr)][addr]; !ok {
+		t.Error("address not in its tried bucket")
+	}
+	for i, bucket := range am.newBucket {
+		if _, ok := bucket[addr]; ok {
+			t.Errorf("address still in new bucket %d", i)
+		}
+	}
+
+	// Unknown addresses are not promoted
+	am.Good(testAddr(1))
+	if _, ok := am.addrIndex[testAddr(1)]; ok {
+		t.Error("Good added an unknown address")
+	}
+}
+
+func TestAddrManagerNewBucketEviction(t *testing.T) {
+	am := newTestAddrManager(t)
+	const src = "203.0.113.7:8333"
+	target := am.newBucketIndex(testAddr(0), src)
+
+	// Fill the target bucket, each address seen later than the one before
+	var colliding []string
+	for i := 0; len(colliding) <= newBucketSize; i++ {
+		if am.newBucketIndex(testAddr(i), src) == target {
+			colliding = append(colliding, testAddr(i))
+		}
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, addr := range colliding[:newBucketSize] {
+		am.addAddress(addr, src, base.Add(time.Duration(i)*time.Second))
+	}
+
+	am.addAddress(colliding[newBucketSize], src, time.Now())
+	bucket := am.newBucket[target]
+	if len(bucket) != newBucketSize {
+		t.Fatalf("bucket holds %d addresses, want %d", len(bucket), newBucketSize)
+	}
+	if _, ok := am.addrIndex[colliding[0]]; ok {
+		t.Error("oldest address was not evicted")
+	}
+	if _, ok := bucket[colliding[newBucketSize]]; !ok {
+		t.Error("new address was not added")
+	}
+}
+
+func TestAddrManagerTriedBucketEviction(t *testing.T) {
+	am := newTestAddrManager(t)
+	target := am.triedBucketIndex(testAddr(0))
+
+	var colliding []string
+	for i := 0; len(colliding) <= triedBucketSize; i++ {
+		if am.triedBucketIndex(testAddr(i)) == target {
+			colliding = append(colliding, testAddr(i))
+		}
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, addr := range colliding[:triedBucketSize] {
+		am.AddAddress(addr, addr)
+		am.Good(addr)
+		am.addrIndex[addr].LastSuccess = base.Add(time.Duration(i) * time.Second)
+	}
+
+	last := colliding[triedBucketSize]
+	am.AddAddress(last, last)
+	am.Good(last)
+	if len(am.tried[target]) != triedBucketSize {
+		t.Fatalf("tried bucket holds %d addresses, want %d", len(am.tried[target]), triedBucketSize)
+	}
+	if !am.addrIndex[last].Tried {
+		t.Error("new address was not promoted")
+	}
+
+	// The least recently successful address is demoted to new, not forgotten
+	demoted := colliding[0]
+	ka, ok := am.addrIndex[demoted]
+	if !ok || ka.Tried {
+		t.Fatalf("oldest address: known %v, tried %v", ok, ok && ka.Tried)
+	}
+	if _, ok := am.newBucket[am.newBucketIndex(demoted, ka.Source)][demoted]; !ok {
+		t.Error("demoted address not in its new bucket")
+	}
+}
+
+func TestAddrManagerSelectEmpty(t *testing.T) {
+	am := newTestAddrManager(t)
+	if got := am.SelectOutbound(8, nil); len(got) != 0 {
+		t.Errorf("selected %v from an empty table", got)
+	}
+	if got := am.AddressCache(); len(got) != 0 {
+		t.Errorf("address cache %v from an empty table", got)
+	}
+
+	// Addresses attempted within the last minute are not selected again
+	am.AddAddress(testAddr(0), testAddr(0))
+	am.Attempt(testAddr(0))
+	if got := am.SelectOutbound(8, nil); len(got) != 0 {
+		t.Errorf("selected %v right after an attempt", got)
+	}
+}
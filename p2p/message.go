@@ -0,0 +1,98 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"aztecs/params"
+)
+
+const maxMessageSize = 4 * 1024 * 1024 // Largest message we are willing to read
+
+// Message commands exchanged between peers
+const (
+	CmdVersion = "version"
+	CmdGetAddr = "getaddr"
+	CmdAddr    = "addr"
+)
+
+// Message is the envelope every peer message is sent in
+type Message struct {
+	Magic   uint32 // Network the message belongs to
+	Command string
+	Payload []byte
+}
+
+// VersionMessage is sent by both sides when a connection opens
+type VersionMessage struct {
+	Version    int
+	ListenAddr string // Address the sender accepts connections on, empty if none
+	Timestamp  int64
+}
+
+// NetAddress is a peer address as carried in an addr message
+type NetAddress struct {
+	Addr      string // Peer address in host:port form
+	Timestamp int64  // Unix time the address was last seen
+}
+
+// AddrMessage advertises known peer addresses
+type AddrMessage struct {
+	Addresses []NetAddress
+}
+
+// WriteMessage encodes payload and writes it to w as a command message
+func WriteMessage(w io.Writer, command string, payload interface{}) error {
+	var buf bytes.Buffer
+	if payload != nil {
+		if err := gob.NewEncoder(&buf).Encode(payload); err != nil {
+			return fmt.Errorf("encode %s: %w", command, err)
+		}
+	}
+
+	var frame bytes.Buffer
+	if err := gob.NewEncoder(&frame).Encode(Message{Magic: params.Active.Magic, Command: command, Payload: buf.Bytes()}); err != nil {
+		return err
+	}
+
+	// Messages are length-prefixed so a stream can carry many of them
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(frame.Len()))
+	if _, err := w.Write(append(header[:], frame.Bytes()...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage reads the next message from r
+func ReadMessage(r io.Reader) (*Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds limit", size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+
+	var msg Message
+	if err := gob.NewDecoder(bytes.NewReader(frame)).Decode(&msg); err != nil {
+		return nil, err
+	}
+	if msg.Magic != params.Active.Magic {
+		return nil, fmt.Errorf("message for network %#08x, expected %s", msg.Magic, params.Active.Name)
+	}
+	return &msg, nil
+}
+
+// Decode decodes the message payload into v
+func (m *Message) Decode(v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(m.Payload)).Decode(v)
+}
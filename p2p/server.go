@@ -0,0 +1,226 @@
+package p2p
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	protocolVersion    = 1
+	defaultMaxOutbound = 8
+	dialTimeout        = 10 * time.Second
+	connectInterval    = 30 * time.Second
+	saveInterval       = 10 * time.Minute
+)
+
+// Server accepts peer connections and keeps outbound slots filled from the address manager
+type Server struct {
+	ListenAddr  string
+	MaxOutbound int
+	AddrManager *AddrManager
+	Transport   *SecureTransport // Encrypts peer connections when set
+
+	mtx      sync.Mutex
+	outbound map[string]net.Conn
+	quit     chan struct{}
+	listener net.Listener
+}
+
+// NewServer creates a peer server listening on listenAddr
+func NewServer(listenAddr string, addrManager *AddrManager) *Server {
+	return &Server{
+		ListenAddr:  listenAddr,
+		MaxOutbound: defaultMaxOutbound,
+		AddrManager: addrManager,
+		outbound:    make(map[string]net.Conn),
+		quit:        make(chan struct{}),
+	}
+}
+
+// Start listens for inbound peers and begins making outbound connections
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	log.Printf("Listening for peers on %s", s.ListenAddr)
+
+	go s.acceptLoop()
+	go s.connectLoop()
+	return nil
+}
+
+// Stop closes all connections and saves known peers
+func (s *Server) Stop() {
+	close(s.quit)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mtx.Lock()
+	for _, conn := range s.outbound {
+		conn.Close()
+	}
+	s.mtx.Unlock()
+
+	if err := s.AddrManager.SaveToFile(); err != nil {
+		log.Printf("Error saving peers: %v", err)
+	}
+}
+
+// acceptLoop handles inbound connections until the server stops
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			log.Printf("Error accepting peer: %v", err)
+			continue
+		}
+		go s.handlePeer(conn, "", false)
+	}
+}
+
+// connectLoop tops up outbound connections and periodically saves peers
+func (s *Server) connectLoop() {
+	connectTicker := time.NewTicker(connectInterval)
+	saveTicker := time.NewTicker(saveInterval)
+	defer connectTicker.Stop()
+	defer saveTicker.Stop()
+
+	s.fillOutbound()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-connectTicker.C:
+			s.fillOutbound()
+		case <-saveTicker.C:
+			if err := s.AddrManager.SaveToFile(); err != nil {
+				log.Printf("Error saving peers: %v", err)
+			}
+		}
+	}
+}
+
+// fillOutbound dials new peers until all outbound slots are in use
+func (s *Server) fillOutbound() {
+	s.mtx.Lock()
+	connected := []string{}
+	for addr := range s.outbound {
+		connected = append(connected, addr)
+	}
+	s.mtx.Unlock()
+
+	free := s.MaxOutbound - len(connected)
+	if free <= 0 {
+		return
+	}
+	for _, addr := range s.AddrManager.SelectOutbound(free, connected) {
+		if addr == s.ListenAddr {
+			continue
+		}
+		s.AddrManager.Attempt(addr)
+		conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+		if err != nil {
+			log.Printf("Failed to connect to peer %s: %v", addr, err)
+			continue
+		}
+		s.mtx.Lock()
+		s.outbound[addr] = conn
+		s.mtx.Unlock()
+		go s.handlePeer(conn, addr, true)
+	}
+}
+
+// handlePeer runs the version handshake and then serves addr requests
+func (s *Server) handlePeer(conn net.Conn, addr string, outbound bool) {
+	defer func() {
+		conn.Close()
+		if outbound {
+			s.mtx.Lock()
+			delete(s.outbound, addr)
+			s.mtx.Unlock()
+		}
+	}()
+
+	if s.Transport != nil {
+		secure, err := s.Transport.Handshake(conn, outbound)
+		if err != nil {
+			log.Printf("Secure handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		log.Printf("Encrypted session with peer %x", secure.RemoteID)
+		conn = secure
+	}
+
+	version := VersionMessage{Version: protocolVersion, ListenAddr: s.ListenAddr, Timestamp: time.Now().Unix()}
+	if err := WriteMessage(conn, CmdVersion, version); err != nil {
+		return
+	}
+
+	for {
+		msg, err := ReadMessage(conn)
+		if err != nil {
+			return
+		}
+
+		switch msg.Command {
+		case CmdVersion:
+			var remote VersionMessage
+			if err := msg.Decode(&remote); err != nil {
+				log.Printf("Bad version message from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			if outbound {
+				s.AddrManager.Good(addr)
+			} else if remote.ListenAddr != "" {
+				// Remember where the inbound peer can be reached
+				s.AddrManager.AddAddress(advertisedAddr(conn, remote.ListenAddr), conn.RemoteAddr().String())
+			}
+			if err := WriteMessage(conn, CmdGetAddr, nil); err != nil {
+				return
+			}
+		case CmdGetAddr:
+			reply := AddrMessage{Addresses: s.AddrManager.AddressCache()}
+			if err := WriteMessage(conn, CmdAddr, reply); err != nil {
+				return
+			}
+		case CmdAddr:
+			var addrMsg AddrMessage
+			if err := msg.Decode(&addrMsg); err != nil {
+				log.Printf("Bad addr message from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			if len(addrMsg.Addresses) > maxAddrPerMessage {
+				log.Printf("Peer %s sent too many addresses", conn.RemoteAddr())
+				return
+			}
+			s.AddrManager.AddAddresses(addrMsg.Addresses, conn.RemoteAddr().String())
+		default:
+			log.Printf("Ignoring unknown command %q from %s", msg.Command, conn.RemoteAddr())
+		}
+	}
+}
+
+// advertisedAddr combines the remote IP with the port the peer listens on.
+// Peers that listen on all interfaces do not know their own public IP.
+func advertisedAddr(conn net.Conn, listenAddr string) string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return listenAddr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		remoteHost, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err == nil {
+			host = remoteHost
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,443 @@
+package p2p
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"aztecs/crypto"
+)
+
+// The handshake follows the Noise XX pattern with P-256 keys, AES-GCM and
+// SHA-256. Both sides prove ownership of a static key in the same format
+// crypto.Wallet uses, which doubles as the node identity: the empty payload
+// ending messages 2 and 3 is encrypted under a key mixed from the sender's
+// static key, so only its holder can produce it.
+const (
+	noiseProtocolName = "Noise_XX_P256_AESGCM_SHA256"
+	noisePrologue     = "aztecs-p2p-v1"
+	nodeKeyFile       = "nodekey.dat" // Define node identity key file name
+	handshakeTimeout  = 15 * time.Second
+	maxFrameSize      = 65535 // Largest encrypted frame, including the GCM tag
+	pointSize         = 65    // Uncompressed P-256 point
+	tagSize           = 16    // GCM authentication tag
+	staticSize        = pointSize + tagSize
+)
+
+// ErrPeerNotAllowed is returned when a peer's identity is not on the allowlist
+var ErrPeerNotAllowed = errors.New("peer identity not in allowlist")
+
+// SecureTransport wraps peer connections in an encrypted, authenticated channel
+type SecureTransport struct {
+	NodeKey   *crypto.Wallet
+	Allowlist map[string]bool // Hex encoded public keys allowed to connect, nil allows everyone
+}
+
+// NewSecureTransport creates a transport using nodeKey as the local identity.
+// allowed lists hex encoded peer public keys; an empty list admits any peer.
+func NewSecureTransport(nodeKey *crypto.Wallet, allowed []string) *SecureTransport {
+	t := &SecureTransport{NodeKey: nodeKey}
+	if len(allowed) > 0 {
+		t.Allowlist = make(map[string]bool)
+		for _, id := range allowed {
+			t.Allowlist[id] = true
+		}
+	}
+	return t
+}
+
+// NodeID returns the hex encoded public key that identifies this node
+func (t *SecureTransport) NodeID() string {
+	return hex.EncodeToString(t.NodeKey.PublicKey)
+}
+
+// LoadOrCreateNodeKey loads the node identity key from dataDir, creating one if needed
+func LoadOrCreateNodeKey(dataDir string) (*crypto.Wallet, error) {
+	path := filepath.Join(dataDir, nodeKeyFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		wallet := crypto.NewWallet()
+		encoded := hex.EncodeToString(wallet.PrivateKeyBytes())
+		if err := os.WriteFile(path, []byte(encoded), 0600); err != nil {
+			return nil, err
+		}
+		return wallet, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := hex.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return crypto.NewWalletFromPrivateKey(d)
+}
+
+// Handshake runs the Noise XX handshake over conn and returns the encrypted
+// connection. The dialing side must pass initiator as true.
+func (t *SecureTransport) Handshake(conn net.Conn, initiator bool) (*SecureConn, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	static, err := t.NodeKey.PrivateKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := newHandshakeState()
+	var remoteEphemeral, remoteStatic *ecdh.PublicKey
+
+	if initiator {
+		// -> e
+		if err := hs.writeMessage(conn, ephemeral.PublicKey().Bytes()); err != nil {
+			return nil, err
+		}
+
+		// <- e, ee, s, es
+		msg, err := readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		if remoteEphemeral, err = hs.readEphemeral(msg); err != nil {
+			return nil, err
+		}
+		if err := hs.mixDH(ephemeral, remoteEphemeral); err != nil {
+			return nil, err
+		}
+		if len(msg) < pointSize+staticSize {
+			return nil, errors.New("handshake message too short")
+		}
+		if remoteStatic, err = hs.readStatic(msg[pointSize : pointSize+staticSize]); err != nil {
+			return nil, err
+		}
+		if err := hs.mixDH(ephemeral, remoteStatic); err != nil {
+			return nil, err
+		}
+		if err := hs.readPayload(msg[pointSize+staticSize:]); err != nil {
+			return nil, err
+		}
+
+		// -> s, se
+		encStatic, err := hs.encryptAndHash(static.PublicKey().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if err := hs.mixDH(static, remoteEphemeral); err != nil {
+			return nil, err
+		}
+		payload, err := hs.encryptAndHash(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(conn, append(encStatic, payload...)); err != nil {
+			return nil, err
+		}
+	} else {
+		// -> e
+		msg, err := readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		if remoteEphemeral, err = hs.readEphemeral(msg); err != nil {
+			return nil, err
+		}
+
+		// <- e, ee, s, es
+		e := ephemeral.PublicKey().Bytes()
+		hs.mixHash(e)
+		if err := hs.mixDH(ephemeral, remoteEphemeral); err != nil {
+			return nil, err
+		}
+		encStatic, err := hs.encryptAndHash(static.PublicKey().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if err := hs.mixDH(static, remoteEphemeral); err != nil {
+			return nil, err
+		}
+		payload, err := hs.encryptAndHash(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(conn, append(append(e, encStatic...), payload...)); err != nil {
+			return nil, err
+		}
+
+		// -> s, se
+		msg, err = readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(msg) < staticSize {
+			return nil, errors.New("handshake message too short")
+		}
+		if remoteStatic, err = hs.readStatic(msg[:staticSize]); err != nil {
+			return nil, err
+		}
+		if err := hs.mixDH(ephemeral, remoteStatic); err != nil {
+			return nil, err
+		}
+		if err := hs.readPayload(msg[staticSize:]); err != nil {
+			return nil, err
+		}
+	}
+
+	sendKey, recvKey, err := hs.split(initiator)
+	if err != nil {
+		return nil, err
+	}
+	// Only now has the peer proven it holds the static key it presented
+	remoteID := identityFromPoint(remoteStatic.Bytes())
+	if t.Allowlist != nil && !t.Allowlist[hex.EncodeToString(remoteID)] {
+		return nil, fmt.Errorf("%w: %x", ErrPeerNotAllowed, remoteID)
+	}
+	return &SecureConn{Conn: conn, RemoteID: remoteID, send: sendKey, recv: recvKey}, nil
+}
+
+// identityFromPoint converts an uncompressed point into the crypto.Wallet public key format
+func identityFromPoint(point []byte) []byte {
+	return append([]byte{}, point[1:]...) // Drop the 0x04 prefix, leaving X || Y
+}
+
+// handshakeState holds the Noise chaining key, handshake hash and current key
+type handshakeState struct {
+	ck    []byte
+	h     []byte
+	key   cipher.AEAD
+	nonce uint64
+}
+
+func newHandshakeState() *handshakeState {
+	h := make([]byte, sha256.Size)
+	copy(h, noiseProtocolName)
+	hs := &handshakeState{ck: append([]byte{}, h...), h: h}
+	hs.mixHash([]byte(noisePrologue))
+	return hs
+}
+
+// mixHash folds data into the handshake hash
+func (hs *handshakeState) mixHash(data []byte) {
+	sum := sha256.Sum256(append(append([]byte{}, hs.h...), data...))
+	hs.h = sum[:]
+}
+
+// mixDH derives a new chaining key and cipher key from a DH result
+func (hs *handshakeState) mixDH(private *ecdh.PrivateKey, public *ecdh.PublicKey) error {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return err
+	}
+	out, err := hkdf.Key(sha256.New, shared, hs.ck, "", 2*sha256.Size)
+	if err != nil {
+		return err
+	}
+	hs.ck = out[:sha256.Size]
+	hs.key, err = newAEAD(out[sha256.Size:])
+	hs.nonce = 0
+	return err
+}
+
+// encryptAndHash encrypts plaintext with the handshake hash as associated data
+func (hs *handshakeState) encryptAndHash(plaintext []byte) ([]byte, error) {
+	if hs.key == nil {
+		hs.mixHash(plaintext)
+		return plaintext, nil
+	}
+	ciphertext := hs.key.Seal(nil, nonceBytes(hs.nonce), plaintext, hs.h)
+	hs.nonce++
+	hs.mixHash(ciphertext)
+	return ciphertext, nil
+}
+
+// decryptAndHash reverses encryptAndHash
+func (hs *handshakeState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	if hs.key == nil {
+		hs.mixHash(ciphertext)
+		return ciphertext, nil
+	}
+	plaintext, err := hs.key.Open(nil, nonceBytes(hs.nonce), ciphertext, hs.h)
+	if err != nil {
+		return nil, fmt.Errorf("handshake decryption failed: %w", err)
+	}
+	hs.nonce++
+	hs.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// writeMessage sends an unencrypted handshake message and mixes it into the hash
+func (hs *handshakeState) writeMessage(w io.Writer, msg []byte) error {
+	hs.mixHash(msg)
+	return writeFrame(w, msg)
+}
+
+// readEphemeral parses and mixes in the remote ephemeral key at the start of msg
+func (hs *handshakeState) readEphemeral(msg []byte) (*ecdh.PublicKey, error) {
+	if len(msg) < pointSize {
+		return nil, errors.New("handshake message too short")
+	}
+	hs.mixHash(msg[:pointSize])
+	return ecdh.P256().NewPublicKey(msg[:pointSize])
+}
+
+// readStatic decrypts and parses the remote static key
+func (hs *handshakeState) readStatic(ciphertext []byte) (*ecdh.PublicKey, error) {
+	plaintext, err := hs.decryptAndHash(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.P256().NewPublicKey(plaintext)
+}
+
+// readPayload decrypts the payload ending a handshake message, which
+// authenticates the static key of its sender. Payloads are always empty.
+func (hs *handshakeState) readPayload(ciphertext []byte) error {
+	payload, err := hs.decryptAndHash(ciphertext)
+	if err != nil {
+		return err
+	}
+	if len(payload) != 0 {
+		return errors.New("unexpected handshake payload")
+	}
+	return nil
+}
+
+// split derives the two transport keys once the handshake is complete
+func (hs *handshakeState) split(initiator bool) (*cipherState, *cipherState, error) {
+	out, err := hkdf.Key(sha256.New, nil, hs.ck, "", 2*sha256.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	first, err := newAEAD(out[:sha256.Size])
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := newAEAD(out[sha256.Size:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if initiator {
+		return &cipherState{aead: first}, &cipherState{aead: second}, nil
+	}
+	return &cipherState{aead: second}, &cipherState{aead: first}, nil
+}
+
+// cipherState encrypts one direction of an established connection
+type cipherState struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+// SecureConn is a net.Conn whose traffic is encrypted after a Noise handshake
+type SecureConn struct {
+	net.Conn
+	RemoteID []byte // Remote static public key in crypto.Wallet format
+
+	readMtx  sync.Mutex
+	writeMtx sync.Mutex
+	send     *cipherState
+	recv     *cipherState
+	pending  []byte // Decrypted bytes not yet returned by Read
+}
+
+// Read decrypts the next frame when no buffered plaintext remains
+func (c *SecureConn) Read(b []byte) (int, error) {
+	c.readMtx.Lock()
+	defer c.readMtx.Unlock()
+
+	if len(c.pending) == 0 {
+		frame, err := readFrame(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := c.recv.aead.Open(nil, nonceBytes(c.recv.nonce), frame, nil)
+		if err != nil {
+			return 0, fmt.Errorf("decrypt frame: %w", err)
+		}
+		c.recv.nonce++
+		c.pending = plaintext
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write encrypts b, splitting it into frames as needed
+func (c *SecureConn) Write(b []byte) (int, error) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	maxPlaintext := maxFrameSize - c.send.aead.Overhead()
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > maxPlaintext {
+			chunk = chunk[:maxPlaintext]
+		}
+		ciphertext := c.send.aead.Seal(nil, nonceBytes(c.send.nonce), chunk, nil)
+		c.send.nonce++
+		if err := writeFrame(c.Conn, ciphertext); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher from a 32 byte key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonceBytes encodes a counter as a 12 byte GCM nonce
+func nonceBytes(n uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+// writeFrame writes a two byte length prefix followed by data
+func writeFrame(w io.Writer, data []byte) error {
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit", len(data))
+	}
+	frame := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(frame, uint16(len(data)))
+	copy(frame[2:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads one length-prefixed frame
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
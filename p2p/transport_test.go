@@ -0,0 +1,264 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"aztecs/crypto"
+)
+
+// recordingConn keeps a copy of every byte written to the socket
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.written.Write(b)
+	return c.Conn.Write(b)
+}
+
+type handshakeResult struct {
+	conn *SecureConn
+	err  error
+}
+
+// handshakePair connects a client and a server transport over a localhost
+// socket and runs both sides of the handshake
+func handshakePair(t *testing.T, client, server *SecureTransport) (*recordingConn, handshakeResult, handshakeResult) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan handshakeResult, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			accepted <- handshakeResult{err: err}
+			return
+		}
+		secure, err := server.Handshake(conn, false)
+		if err != nil {
+			conn.Close()
+		}
+		accepted <- handshakeResult{conn: secure, err: err}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := &recordingConn{Conn: conn}
+	secure, err := client.Handshake(raw, true)
+	if err != nil {
+		conn.Close()
+	}
+	dialed := handshakeResult{conn: secure, err: err}
+	t.Cleanup(func() { conn.Close() })
+	return raw, dialed, <-accepted
+}
+
+func TestHandshakeIdentities(t *testing.T) {
+	clientKey, serverKey := crypto.NewWallet(), crypto.NewWallet()
+	_, dialed, accepted := handshakePair(t, NewSecureTransport(clientKey, nil), NewSecureTransport(serverKey, nil))
+	if dialed.err != nil || accepted.err != nil {
+		t.Fatalf("handshake failed: client %v, server %v", dialed.err, accepted.err)
+	}
+	defer accepted.conn.Close()
+	if !bytes.Equal(dialed.conn.RemoteID, serverKey.PublicKey) {
+		t.Errorf("client sees %x, want server key %x", dialed.conn.RemoteID, serverKey.PublicKey)
+	}
+	if !bytes.Equal(accepted.conn.RemoteID, clientKey.PublicKey) {
+		t.Errorf("server sees %x, want client key %x", accepted.conn.RemoteID, clientKey.PublicKey)
+	}
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	raw, dialed, accepted := handshakePair(t, NewSecureTransport(crypto.NewWallet(), nil), NewSecureTransport(crypto.NewWallet(), nil))
+	if dialed.err != nil || accepted.err != nil {
+		t.Fatalf("handshake failed: client %v, server %v", dialed.err, accepted.err)
+	}
+	defer accepted.conn.Close()
+
+	// Larger than one frame, so Write must split it
+	message := bytes.Repeat([]byte("aztecs block data "), 10000)
+	written := make(chan error, 1)
+	go func() {
+		_, err := dialed.conn.Write(message)
+		written <- err
+	}()
+	got := make([]byte, len(message))
+	if _, err := io.ReadFull(accepted.conn, got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !bytes.Equal(got, message) {
+		t.Fatal("server received different bytes than the client sent")
+	}
+
+	reply := []byte("ack")
+	if _, err := accepted.conn.Write(reply); err != nil {
+		t.Fatalf("write reply: %v", err)
+	}
+	got = make([]byte, len(reply))
+	if _, err := io.ReadFull(dialed.conn, got); err != nil || !bytes.Equal(got, reply) {
+		t.Fatalf("client read %q, %v; want %q", got, err, reply)
+	}
+
+	if bytes.Contains(raw.written.Bytes(), []byte("aztecs block data")) {
+		t.Error("plaintext visible on the wire")
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	clientKey := crypto.NewWallet()
+	tests := []struct {
+		name    string
+		allowed []string
+		wantErr bool
+	}{
+		{"empty list admits anyone", nil, false},
+		{"listed peer", []string{hex.EncodeToString(clientKey.PublicKey)}, false},
+		{"unlisted peer", []string{hex.EncodeToString(crypto.NewWallet().PublicKey)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewSecureTransport(crypto.NewWallet(), tt.allowed)
+			_, _, accepted := handshakePair(t, NewSecureTransport(clientKey, nil), server)
+			if tt.wantErr {
+				if !errors.Is(accepted.err, ErrPeerNotAllowed) {
+					t.Fatalf("server error %v, want ErrPeerNotAllowed", accepted.err)
+				}
+				return
+			}
+			if accepted.err != nil {
+				t.Fatalf("server rejected an allowed peer: %v", accepted.err)
+			}
+			accepted.conn.Close()
+		})
+	}
+}
+
+// claimStatic runs the initiator side of the handshake over conn presenting
+// the static key of claimed while holding only the private key of held
+func claimStatic(conn net.Conn, claimed, held *crypto.Wallet) error {
+	claimedStatic, err := claimed.PrivateKey.ECDH()
+	if err != nil {
+		return err
+	}
+	heldStatic, err := held.PrivateKey.ECDH()
+	if err != nil {
+		return err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	hs := newHandshakeState()
+	if err := hs.writeMessage(conn, ephemeral.PublicKey().Bytes()); err != nil {
+		return err
+	}
+	msg, err := readFrame(conn)
+	if err != nil {
+		return err
+	}
+	remoteEphemeral, err := hs.readEphemeral(msg)
+	if err != nil {
+		return err
+	}
+	if err := hs.mixDH(ephemeral, remoteEphemeral); err != nil {
+		return err
+	}
+	remoteStatic, err := hs.readStatic(msg[pointSize : pointSize+staticSize])
+	if err != nil {
+		return err
+	}
+	if err := hs.mixDH(ephemeral, remoteStatic); err != nil {
+		return err
+	}
+	if err := hs.readPayload(msg[pointSize+staticSize:]); err != nil {
+		return err
+	}
+
+	encStatic, err := hs.encryptAndHash(claimedStatic.PublicKey().Bytes())
+	if err != nil {
+		return err
+	}
+	if err := hs.mixDH(heldStatic, remoteEphemeral); err != nil {
+		return err
+	}
+	payload, err := hs.encryptAndHash(nil)
+	if err != nil {
+		return err
+	}
+	return writeFrame(conn, append(encStatic, payload...))
+}
+
+func TestHandshakeRejectsUnheldStaticKey(t *testing.T) {
+	allowed, attacker := crypto.NewWallet(), crypto.NewWallet()
+	tests := []struct {
+		name    string
+		held    *crypto.Wallet
+		wantErr bool
+	}{
+		{"holder of the allowed key", allowed, false},
+		{"allowed key without its private key", attacker, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewSecureTransport(crypto.NewWallet(), []string{hex.EncodeToString(allowed.PublicKey)})
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+
+			accepted := make(chan handshakeResult, 1)
+			go func() {
+				secure, err := server.Handshake(serverConn, false)
+				accepted <- handshakeResult{conn: secure, err: err}
+			}()
+			if err := claimStatic(clientConn, allowed, tt.held); err != nil {
+				t.Fatal(err)
+			}
+			result := <-accepted
+			if tt.wantErr {
+				if result.err == nil || result.conn != nil {
+					t.Fatalf("server accepted a peer that does not hold its key: %v", result.err)
+				}
+				return
+			}
+			if result.err != nil {
+				t.Fatalf("server rejected the key holder: %v", result.err)
+			}
+			if !bytes.Equal(result.conn.RemoteID, allowed.PublicKey) {
+				t.Errorf("server sees %x, want %x", result.conn.RemoteID, allowed.PublicKey)
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateNodeKey(t *testing.T) {
+	dir := t.TempDir()
+	created, err := LoadOrCreateNodeKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOrCreateNodeKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(created.PublicKey, loaded.PublicKey) {
+		t.Error("node key changed after reloading")
+	}
+}
@@ -0,0 +1,143 @@
+package params
+
+import (
+	"fmt"
+	"time"
+)
+
+// Params defines the consensus rules and encodings of one network
+type Params struct {
+	Name string
+
+	// Encodings
+	AddressVersion byte    // Version byte of base58 public key hash addresses
+	ScriptVersion  byte    // Version byte of base58 script hash addresses
+	Bech32HRP      string  // Human-readable prefix of bech32m addresses
+	PrivateKeyID   byte    // Version byte of exported private keys
+	Magic          uint32  // Prefix identifying peer messages of this network
+	HDPrivateKeyID [4]byte // Version bytes of serialized extended private keys
+	HDPublicKeyID  [4]byte // Version bytes of serialized extended public keys
+	HDCoinType     uint32  // Coin type used in HD derivation paths
+
+	// Default listen ports
+	DefaultAPIPort int
+	DefaultP2PPort int
+
+	// Genesis block
+	GenesisTimestamp  time.Time
+	GenesisMessage    string // Data carried by the genesis coinbase input
+	GenesisPubKeyHash []byte // Recipient of the genesis reward
+
+	// Mining
+	TargetBits             int     // Proof of work difficulty in leading zero bits
+	Subsidy                float64 // Initial block reward
+	SubsidyHalvingInterval int64   // Blocks between reward halvings, 0 disables halving
+	GenerateAllowed        bool    // Whether blocks can be mined on demand with generate
+}
+
+// MainNet is the main production network
+var MainNet = Params{
+	Name:                   "mainnet",
+	AddressVersion:         0x00,
+	ScriptVersion:          0x05,
+	Bech32HRP:              "az",
+	PrivateKeyID:           0x80,
+	Magic:                  0xa27ec501,
+	HDPrivateKeyID:         [4]byte{0x04, 0x88, 0xad, 0xe4}, // xprv
+	HDPublicKeyID:          [4]byte{0x04, 0x88, 0xb2, 0x1e}, // xpub
+	HDCoinType:             0,
+	DefaultAPIPort:         8080,
+	DefaultP2PPort:         3000,
+	GenesisTimestamp:       time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+	GenesisMessage:         "Aztecs genesis block",
+	GenesisPubKeyHash:      make([]byte, 20),
+	TargetBits:             16,
+	Subsidy:                50,
+	SubsidyHalvingInterval: 210000,
+}
+
+// TestNet is the public test network
+var TestNet = Params{
+	Name:                   "testnet",
+	AddressVersion:         0x6f,
+	ScriptVersion:          0xc4,
+	Bech32HRP:              "taz",
+	PrivateKeyID:           0xef,
+	Magic:                  0xa27ec502,
+	HDPrivateKeyID:         [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:          [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+	HDCoinType:             1,
+	DefaultAPIPort:         18080,
+	DefaultP2PPort:         13000,
+	GenesisTimestamp:       time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+	GenesisMessage:         "Aztecs testnet genesis block",
+	GenesisPubKeyHash:      make([]byte, 20),
+	TargetBits:             12,
+	Subsidy:                50,
+	SubsidyHalvingInterval: 210000,
+}
+
+// RegTest is a local network for integration tests. Blocks need almost no
+// work and can be generated on demand.
+var RegTest = Params{
+	Name:                   "regtest",
+	AddressVersion:         0x6f,
+	ScriptVersion:          0xc4,
+	Bech32HRP:              "azrt",
+	PrivateKeyID:           0xef,
+	Magic:                  0xa27ec5ff,
+	HDPrivateKeyID:         [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:          [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+	HDCoinType:             1,
+	DefaultAPIPort:         28080,
+	DefaultP2PPort:         23000,
+	GenesisTimestamp:       time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+	GenesisMessage:         "Aztecs regtest genesis block",
+	GenesisPubKeyHash:      make([]byte, 20),
+	TargetBits:             1,
+	Subsidy:                50,
+	SubsidyHalvingInterval: 150,
+	GenerateAllowed:        true,
+}
+
+// Active holds the parameters of the network the node runs on
+var Active = &MainNet
+
+// Networks lists the parameters of every known network
+var Networks = []*Params{&MainNet, &TestNet, &RegTest}
+
+// ByName returns the parameters of a network
+func ByName(name string) (*Params, error) {
+	for _, p := range Networks {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+// SetActive selects the network the node runs on
+func SetActive(name string) error {
+	p, err := ByName(name)
+	if err != nil {
+		return err
+	}
+	Active = p
+	return nil
+}
+
+// BlockSubsidy returns the block reward at height, halving every SubsidyHalvingInterval blocks
+func (p *Params) BlockSubsidy(height int64) float64 {
+	subsidy := p.Subsidy
+	if p.SubsidyHalvingInterval <= 0 {
+		return subsidy
+	}
+	halvings := height / p.SubsidyHalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	for i := int64(0); i < halvings; i++ {
+		subsidy /= 2
+	}
+	return subsidy
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt" // Import fmt package
 	"log"
+	"path/filepath"
 
 	"github.com/boltdb/bolt" // Using BoltDB for storage
 )
@@ -15,9 +16,9 @@ type BlockchainDB struct {
 	db *bolt.DB
 }
 
-// NewBlockchainDB creates or opens the BoltDB database
-func NewBlockchainDB() *BlockchainDB {
-	db, err := bolt.Open(dbFile, 0600, nil)
+// NewBlockchainDB creates or opens the BoltDB database in dataDir
+func NewBlockchainDB(dataDir string) *BlockchainDB {
+	db, err := bolt.Open(filepath.Join(dataDir, dbFile), 0600, nil)
 	if err != nil {
 		log.Panic(err)
 	}